@@ -34,6 +34,7 @@ CREATE TABLE IF NOT EXISTS index_data (
 `
 
 var _ Store = (*SqliteXStore)(nil)
+var _ IndexQuerier = (*SqliteXStoreBucket)(nil)
 
 func NewSqliteXStore(file string) (*SqliteXStore, error) {
 	dbx, err := sqlitex.NewDB(file)
@@ -515,6 +516,10 @@ func (b *SqliteXStoreBucket) QueryKeys(indexName string, lo query.LimitOffset, f
 	return b.indexManager.Query(b.name, indexName, lo, fields, sorts, search)
 }
 
+func (b *SqliteXStoreBucket) QueryIndexKeys(indexName string, q query.Query) ([]string, error) {
+	return b.indexManager.QueryKeys(b.name, indexName, q)
+}
+
 func (b *SqliteXStoreBucket) QueryDistinct(indexName string, field string) ([]string, error) {
 	return b.indexManager.QueryDistinct(b.name, indexName, field)
 }
@@ -377,24 +377,28 @@ func (im *SqliteXIndexManager) updateIndex(tx *sql.Tx, idxMeta sqliteXIndexMeta,
 	return nil
 }
 
-func sqlComparator(qc query.Comparator) string {
-	switch qc {
-	case query.ComparatorEqual:
-		return "="
-	case query.ComparatorNotEqual:
-		return "!="
-	case query.ComparatorGreater:
-		return ">"
-	case query.ComparatorGreaterEqual:
-		return ">="
-	case query.ComparatorLess:
-		return "<"
-	case query.ComparatorLessEqual:
-		return "<="
-	case query.ComparatorLike:
-		return "like"
-	default:
-		return "="
+func (m sqliteXIndexMeta) whereOptions() query.SQLWhereOptions {
+	return query.SQLWhereOptions{
+		Column: func(name string) (string, error) {
+			if !m.containsField(name) {
+				return "", fmt.Errorf("index %s contains no field with name %q", m.Name, name)
+			}
+			return name, nil
+		},
+		Value: func(val any) (any, error) {
+			if tim, ok := val.(time.Time); ok {
+				return tim.Format(time.RFC3339Nano), nil
+			}
+			// check if val is struct
+			if val != nil && reflect.TypeOf(val).Kind() == reflect.Struct {
+				stringer, ok := val.(fmt.Stringer)
+				if !ok {
+					return nil, fmt.Errorf("cannot filter for struct %T which is not a stringer", val)
+				}
+				return stringer.String(), nil
+			}
+			return val, nil
+		},
 	}
 }
 
@@ -425,70 +429,30 @@ func (im *SqliteXIndexManager) QueryDistinct(bucketName string, indexName string
 }
 
 func (im *SqliteXIndexManager) Query(bucketName string, indexName string, lo query.LimitOffset, fields []query.Condition, sorts []query.Sort, search query.Search) ([]string, error) {
+	return im.QueryKeys(bucketName, indexName, query.Query{
+		LimitOffset: lo,
+		Conditions:  fields,
+		Sorts:       sorts,
+		Search:      search,
+	})
+}
+
+func (im *SqliteXIndexManager) QueryKeys(bucketName string, indexName string, q query.Query) ([]string, error) {
 	ixkey := sqliteXIndexKey{bucketName: bucketName, indexName: indexName}
 	idxMeta, ok := im.indexes[ixkey]
 	if !ok {
 		return nil, fmt.Errorf("no such index: %s", ixkey)
 	}
 
-	// whereRValue := func(val any, paramName string) string {
-	// 	switch val.(type) {
-	// 	case int:
-	// 		return fmt.Sprintf("CAST(:%s AS INTEGER)", paramName)
-	// 	default:
-	// 		return fmt.Sprintf(":%s", paramName)
-	// 	}
-	// }
-
 	wheres := []string{}
-	args := []any{}
-	paramIdx := 0
-	for _, fq := range fields {
-		if !idxMeta.containsField(fq.Name) {
-			return nil, fmt.Errorf("index %s contains no field with name %q", indexName, fq.Name)
-		}
-		if fq.Comp == query.ComparatorIn {
-			// this one is special - for the moment only allow string slices
-			vals, ok := fq.Value.([]string)
-			if !ok {
-				return nil, fmt.Errorf("only string slices are allowed for IN queries")
-			}
-			inParamNames := []string{}
-			for _, val := range vals {
-				paramName := fmt.Sprintf("p%03d", paramIdx)
-				paramIdx++
-				inParamNames = append(inParamNames, ":"+paramName)
-				args = append(args, sql.Named(paramName, val))
-			}
-			wheres = append(wheres, fmt.Sprintf("%s IN (%s)", fq.Name, strings.Join(inParamNames, ",")))
-
-			continue
-		}
-
-		//-- check if val is struct
-		paramName := fmt.Sprintf("p%03d", paramIdx)
-		paramIdx++
-
-		//wheres = append(wheres, fmt.Sprintf("%s %s %s", fq.Name, sqlComparator(fq.Comp), whereRValue(fq.Value, paramName)))
-		wheres = append(wheres, fmt.Sprintf("%s %s :%s", fq.Name, sqlComparator(fq.Comp), paramName))
-		var val any
-		if fq.Comp == query.ComparatorLike {
-			val = fmt.Sprintf("%%%v%%", fq.Value)
-		} else {
-			val = fq.Value
-		}
-
-		// check if val is struct
-		if reflect.TypeOf(val).Kind() == reflect.Struct {
-			stringer, ok := val.(fmt.Stringer)
-			if !ok {
-				return nil, fmt.Errorf("cannot filter for struct %T which is not a stringer", val)
-			}
-			val = stringer.String()
-		}
-
-		args = append(args, sql.Named(paramName, val))
+	whereExpr, args, err := query.SQLWhere(q.Where(), idxMeta.whereOptions())
+	if err != nil {
+		return nil, fmt.Errorf("where: %w", err)
 	}
+	if whereExpr != "" {
+		wheres = append(wheres, whereExpr)
+	}
+	search := q.Search
 	if len(search.Fields) > 0 && search.Value != "" {
 		//var searchs []string
 		searchWords := strings.Split(search.Value, " ")
@@ -503,7 +467,6 @@ func (im *SqliteXIndexManager) Query(bucketName string, indexName string, lo que
 			for _, sf := range search.Fields {
 				paramName := fmt.Sprintf("search%03d", paramIdx)
 				fieldsSearchs = append(fieldsSearchs, fmt.Sprintf("(%s like :%s)", sf, paramName))
-				//args = append(args, sql.Named(paramName, fmt.Sprintf("%%%v%%", search.Value)))
 				args = append(args, sql.Named(paramName, fmt.Sprintf("%%%v%%", word)))
 				paramIdx++
 			}
@@ -513,10 +476,11 @@ func (im *SqliteXIndexManager) Query(bucketName string, indexName string, lo que
 	}
 
 	orderBys := []string{}
-	for _, fs := range sorts {
+	for _, fs := range q.Sorts {
 		orderBys = append(orderBys, fmt.Sprintf("%s %s", fs.Name, fs.Order))
 	}
 
+	lo := q.LimitOffset
 	var limitOffsetClause string
 	if lo.Limit > 0 {
 		limitOffsetClause = " LIMIT :limit OFFSET :offset"
@@ -535,14 +499,14 @@ func (im *SqliteXIndexManager) Query(bucketName string, indexName string, lo que
 		orderBy = " ORDER BY " + strings.Join(orderBys, ", ")
 	}
 
-	q := fmt.Sprintf("SELECT key FROM %s %s %s %s;", idxMeta.TableName, where, orderBy, limitOffsetClause)
+	stmt := fmt.Sprintf("SELECT key FROM %s %s %s %s;", idxMeta.TableName, where, orderBy, limitOffsetClause)
 	rows, err := im.dbx.QueryContext(
 		context.TODO(),
-		q,
+		stmt,
 		args...,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("query %q: %w", q, err)
+		return nil, fmt.Errorf("query %q: %w", stmt, err)
 	}
 	defer rows.Close()
 
@@ -556,10 +520,5 @@ func (im *SqliteXIndexManager) Query(bucketName string, indexName string, lo que
 		keys = append(keys, key)
 	}
 
-	// log.Debugf("query: %s", q)
-	// log.Debugf("lo: %v", lo)
-	// log.Debugf("fields: %v", fields)
-	// log.Debugf("result: %d keys", len(keys))
-
 	return keys, nil
 }
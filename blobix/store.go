@@ -81,6 +81,11 @@ type Bucket interface {
 	QueryDistinct(indexName string, field string) ([]string, error)
 }
 
+// IndexQuerier is implemented by buckets which support query filters
+type IndexQuerier interface {
+	QueryIndexKeys(indexName string, q query.Query) ([]string, error)
+}
+
 type Index interface {
 	Fields() []string
 }
@@ -107,15 +112,24 @@ func Values[T any](bucket Bucket, keys ...string) ([]T, error) {
 }
 
 func Query[T any](bucket Bucket, indexName string, q query.Query) ([]T, error) {
-	keys, err := bucket.QueryKeys(indexName, q.LimitOffset, q.Conditions, q.Sorts, q.Search)
+	keys, err := QueryKeys(bucket, indexName, q)
 	if err != nil {
-		return nil, fmt.Errorf("query-keys: %w", err)
+		return nil, err
 	}
 	return Values[T](bucket, keys...)
 }
 
+// QueryKeys uses QueryIndexKeys, if bucket is an IndexQuerier. Otherwise q must not have a filter.
 func QueryKeys(bucket Bucket, indexName string, q query.Query) ([]string, error) {
-	keys, err := bucket.QueryKeys(indexName, q.LimitOffset, q.Conditions, q.Sorts, q.Search)
+	var keys []string
+	var err error
+	if iq, ok := bucket.(IndexQuerier); ok {
+		keys, err = iq.QueryIndexKeys(indexName, q)
+	} else if q.Filter != nil {
+		err = fmt.Errorf("bucket %T does not support query filters", bucket)
+	} else {
+		keys, err = bucket.QueryKeys(indexName, q.LimitOffset, q.Conditions, q.Sorts, q.Search)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("query-keys: %w", err)
 	}
@@ -214,4 +214,17 @@ func testQuery(t *testing.T, store Store) {
 		{Name: "name_00005", Value: "value_00003"},
 	}
 	tx.AssertEqual(wantVals, qVals)
+
+	// buckets which are no IndexQuerier fall back to QueryKeys
+	plain := plainBucket{bucket}
+	keys, err = QueryKeys(plain, "test", q)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(wantKeys, keys)
+	q.Filter = query.C("name", query.ComparatorEqual, "name_00001")
+	_, err = QueryKeys(plain, "test", q)
+	tx.AssertErr(err)
+}
+
+type plainBucket struct {
+	Bucket
 }
@@ -0,0 +1,8 @@
+package blobix_v2
+
+import "fmt"
+
+var (
+	ErrRevisionMismatch = fmt.Errorf("revision-mismatch")
+	ErrKeyNotFound      = fmt.Errorf("key-not-found")
+)
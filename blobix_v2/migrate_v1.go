@@ -0,0 +1,226 @@
+package blobix_v2
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mazzegi/log"
+	"github.com/mazzegi/mbox/blobix"
+	"github.com/mazzegi/mbox/sqlb"
+	"github.com/mazzegi/mbox/sqlitex"
+)
+
+// v1PathTagPrefix marks index fields translated from blobix v1, the tag carries the json path of the field
+const v1PathTagPrefix = "v1-path:"
+
+// V1IndexDescriptor translates the path based fields of a blobix v1 index into a v2 index descriptor
+func V1IndexDescriptor(bucketName string, indexName string, fields ...blobix.IndexField) IndexDescriptor {
+	desc := IndexDescriptor{
+		BucketName: bucketName,
+		IndexName:  indexName,
+	}
+	for _, f := range fields {
+		desc.Fields = append(desc.Fields, IndexFieldDescriptor{
+			Name: f.Name,
+			Type: IndexFieldType(f.Type),
+			Tag:  v1PathTagPrefix + f.Path,
+		})
+	}
+	return desc
+}
+
+// v1Path returns the json path of an index field translated from blobix v1
+func v1Path(fd IndexFieldDescriptor) (string, bool) {
+	return strings.CutPrefix(fd.Tag, v1PathTagPrefix)
+}
+
+// v1IndexMeta is the index meta as stored by blobix v1
+type v1IndexMeta struct {
+	Bucket    string              `json:"bucket"`
+	Name      string              `json:"name"`
+	TableName string              `json:"table_name"`
+	Fields    []blobix.IndexField `json:"fields"`
+}
+
+type MigrateV1Result struct {
+	Buckets int
+	Keys    int
+	Indexes int
+}
+
+// MigrateV1 copies all buckets with values and meta of the blobix v1 database in v1File into store.
+// The v1 indexes are created in store with translated descriptors and their values are copied as they are.
+// Existing keys in store are overwritten. The v1 database is opened read-only and must not be written to while migrating.
+func MigrateV1(v1File string, store *SqliteXStore) (MigrateV1Result, error) {
+	var res MigrateV1Result
+	src, err := sqlitex.NewDB(v1File, sqlitex.WithReadOnly())
+	if err != nil {
+		return res, fmt.Errorf("sqlitex.newdb at %q: %w", v1File, err)
+	}
+	defer src.Close()
+
+	metas, err := loadV1IndexMetas(src)
+	if err != nil {
+		return res, fmt.Errorf("load-v1-index-metas: %w", err)
+	}
+	// create indexes before the data tx, as index creation uses a tx on its own
+	for _, meta := range metas {
+		desc := V1IndexDescriptor(meta.Bucket, meta.Name, meta.Fields...)
+		existing, ok := store.FindIndexDescriptor(meta.Bucket, meta.Name)
+		if ok && IndexDescriptorsEqual(existing, desc) {
+			continue
+		}
+		if ok {
+			err = store.DeleteIndex(meta.Bucket, meta.Name)
+			if err != nil {
+				return res, fmt.Errorf("delete-index %s/%s: %w", meta.Bucket, meta.Name, err)
+			}
+		}
+		err = store.CreateIndex(meta.Bucket, meta.Name, desc.Fields)
+		if err != nil {
+			return res, fmt.Errorf("create-index %s/%s: %w", meta.Bucket, meta.Name, err)
+		}
+	}
+
+	tx, err := store.BeginTx()
+	if err != nil {
+		return res, fmt.Errorf("begin-tx: %w", err)
+	}
+	stx := tx.(*sqliteXStoreTx)
+	res.Buckets, res.Keys, err = stx.copyV1Data(src)
+	if err != nil {
+		stx.Rollback()
+		return res, fmt.Errorf("copy-data: %w", err)
+	}
+	for _, meta := range metas {
+		err = stx.copyV1Index(src, meta)
+		if err != nil {
+			stx.Rollback()
+			return res, fmt.Errorf("copy-index %s/%s: %w", meta.Bucket, meta.Name, err)
+		}
+		res.Indexes++
+	}
+	err = stx.Commit()
+	if err != nil {
+		return res, fmt.Errorf("commit: %w", err)
+	}
+	log.Debugf("migrate-v1: %d buckets, %d keys, %d indexes", res.Buckets, res.Keys, res.Indexes)
+	return res, nil
+}
+
+func loadV1IndexMetas(src *sqlitex.DB) ([]v1IndexMeta, error) {
+	rows, err := src.Query("SELECT meta FROM index_data ORDER BY bucket, name;")
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	var metas []v1IndexMeta
+	var meta string
+	for rows.Next() {
+		err = rows.Scan(&meta)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		var m v1IndexMeta
+		err = json.Unmarshal([]byte(meta), &m)
+		if err != nil {
+			return nil, fmt.Errorf("json.unmarshal index-meta: %w", err)
+		}
+		metas = append(metas, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return metas, nil
+}
+
+// copyV1Data copies the data rows without publishing changes or archiving history
+func (stx *sqliteXStoreTx) copyV1Data(src *sqlitex.DB) (int, int, error) {
+	rows, err := src.Query("SELECT bucket, key, modified_on, meta, value FROM data ORDER BY bucket, key;")
+	if err != nil {
+		return 0, 0, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	stmt := stx.tx.Stmt(stx.store.stmtInsertData)
+	var numBuckets, numKeys int
+	var lastBucket string
+	var bucket, key, modifiedOn, meta, value sql.NullString
+	for rows.Next() {
+		err = rows.Scan(&bucket, &key, &modifiedOn, &meta, &value)
+		if err != nil {
+			return 0, 0, fmt.Errorf("scan: %w", err)
+		}
+		if numKeys == 0 || bucket.String != lastBucket {
+			numBuckets++
+			lastBucket = bucket.String
+		}
+		mod, err := time.Parse(time.RFC3339Nano, modifiedOn.String)
+		if err != nil {
+			return 0, 0, fmt.Errorf("parse modified-on of %s/%s: %w", bucket.String, key.String, err)
+		}
+		err = stx.store.saveRawStmtWithMeta(context.Background(), stmt, bucket.String, key.String, []byte(value.String), []byte(meta.String), mod, nil)
+		if err != nil {
+			return 0, 0, fmt.Errorf("save %s/%s: %w", bucket.String, key.String, err)
+		}
+		numKeys++
+	}
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("rows: %w", err)
+	}
+	return numBuckets, numKeys, nil
+}
+
+func (stx *sqliteXStoreTx) copyV1Index(src *sqlitex.DB, meta v1IndexMeta) error {
+	qtab, err := sqlb.Ident(meta.TableName)
+	if err != nil {
+		return err
+	}
+	cols := []string{"key"}
+	for _, f := range meta.Fields {
+		qcol, err := sqlb.Ident(f.Name)
+		if err != nil {
+			return err
+		}
+		cols = append(cols, qcol)
+	}
+	rows, err := src.Query(fmt.Sprintf("SELECT %s FROM %s;", strings.Join(cols, ", "), qtab))
+	if err != nil {
+		return fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	vals := make([]any, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	for rows.Next() {
+		err = rows.Scan(ptrs...)
+		if err != nil {
+			return fmt.Errorf("scan: %w", err)
+		}
+		key := fmt.Sprint(vals[0])
+		if bs, ok := vals[0].([]byte); ok {
+			key = string(bs)
+		}
+		values := map[string]any{}
+		for i, f := range meta.Fields {
+			v := vals[i+1]
+			if bs, ok := v.([]byte); ok {
+				v = string(bs)
+			}
+			values[f.Name] = v
+		}
+		err = stx.UpdateIndex(meta.Bucket, meta.Name, key, values)
+		if err != nil {
+			return fmt.Errorf("update-index for key %q: %w", key, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package blobix_v2
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mazzegi/mbox/blobix"
+	"github.com/mazzegi/mbox/query"
+	"github.com/mazzegi/mbox/sqlitex"
+	"github.com/mazzegi/mbox/testx"
+)
+
+func TestMigrateV1(t *testing.T) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_migrate_v1_%s", time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	type meta struct {
+		Author string `json:"author"`
+	}
+
+	v1File := filepath.Join(tmpFolderName, "v1.db")
+	v1Store, err := blobix.NewSqliteXStore(v1File)
+	tx.AssertNoErr(err)
+	v1Bucket := v1Store.Bucket("test_type")
+	_, err = v1Bucket.AddIndex("default",
+		blobix.TIF("int_1", "int_1", blobix.IndexFieldInt),
+		blobix.TIF("string_2", "string_2", blobix.IndexFieldString),
+	)
+	tx.AssertNoErr(err)
+	numRecords := 50
+	for n := range numRecords {
+		key := fmt.Sprintf("test_key_%06d", n)
+		err = v1Bucket.PutJSONWithMeta(key, NewTestStoreType(key, n+1), meta{Author: "bob"})
+		tx.AssertNoErr(err)
+	}
+	err = v1Store.Bucket("other").PutJSON("k", "v")
+	tx.AssertNoErr(err)
+	v1Store.Close()
+	v1DB, err := sqlitex.NewDB(v1File, sqlitex.WithJournalMode(sqlitex.JournalDelete))
+	tx.AssertNoErr(err)
+	_, err = v1DB.Settings(context.Background())
+	tx.AssertNoErr(err)
+	v1DB.Close()
+
+	store, err := NewSqliteXStore(filepath.Join(tmpFolderName, "v2.db"))
+	tx.AssertNoErr(err)
+	defer store.Close()
+	res, err := MigrateV1(v1File, store)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(MigrateV1Result{Buckets: 2, Keys: numRecords + 1, Indexes: 1}, res)
+
+	// the v1 database isn't changed, not even its journal mode
+	v1DB, err = sqlitex.NewDB(v1File, sqlitex.WithReadOnly())
+	tx.AssertNoErr(err)
+	settings, err := v1DB.Settings(context.Background())
+	tx.AssertNoErr(err)
+	tx.AssertEqual(sqlitex.JournalDelete, settings.JournalMode)
+	v1DB.Close()
+
+	// typed v2 access
+	bucket := NewBucket[TestStoreType](store, "test_type")
+	v, found, err := bucket.Find("test_key_000009")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(true), found)
+	tx.AssertEqual(NewTestStoreType("test_key_000009", 10), v)
+
+	// v1 access through the adapter
+	adapter := NewV1Store(store).Bucket("test_type")
+	var vt TestStoreType
+	qr, err := adapter.JSON("test_key_000009", &vt)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(v, vt)
+	var m meta
+	err = qr.DecodeMeta(&m)
+	tx.AssertNoErr(err)
+	tx.AssertEqual("bob", m.Author)
+
+	q := query.Query{
+		LimitOffset: query.LO(100, 0),
+		Conditions:  []query.Condition{query.C("string_2", query.ComparatorEqual, "string_2_val_3")},
+		Sorts:       []query.Sort{query.S("int_1", query.SortASC)},
+	}
+	keys, err := blobix.QueryKeys(adapter, "default", q)
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]string{"test_key_000002", "test_key_000012", "test_key_000022", "test_key_000032", "test_key_000042"}, keys)
+
+	// writes through the adapter maintain the migrated index
+	err = adapter.PutJSON("test_key_000099", NewTestStoreType("test_key_000099", 103))
+	tx.AssertNoErr(err)
+	err = adapter.Delete("test_key_000002")
+	tx.AssertNoErr(err)
+	keys, err = blobix.QueryKeys(adapter, "default", q)
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]string{"test_key_000012", "test_key_000022", "test_key_000032", "test_key_000042", "test_key_000099"}, keys)
+
+	keys, err = adapter.KeysWithPrefix("test_key_00009")
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]string{"test_key_000099"}, keys)
+
+	_, err = adapter.AddIndex("default", blobix.TIF("int_1", "int_1", blobix.IndexFieldInt))
+	tx.AssertErr(err)
+	_, err = adapter.AddOrUpdateIndex("default", blobix.TIF("int_3", "int_3", blobix.IndexFieldInt))
+	tx.AssertNoErr(err)
+	vals, err := adapter.QueryDistinct("default", "int_3")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(50, len(vals))
+
+	// index table and field names of the v1 meta are only used as quoted identifiers
+	v1DB, err = sqlitex.NewDB(v1File, sqlitex.WithJournalMode(sqlitex.JournalDelete))
+	tx.AssertNoErr(err)
+	_, err = v1DB.Exec("UPDATE index_data SET meta = json_set(meta, '$.table_name', json_extract(meta, '$.table_name') || ' WHERE 1 = 0');")
+	tx.AssertNoErr(err)
+	v1DB.Close()
+	badStore, err := NewSqliteXStore(filepath.Join(tmpFolderName, "v2_bad.db"))
+	tx.AssertNoErr(err)
+	defer badStore.Close()
+	_, err = MigrateV1(v1File, badStore)
+	tx.AssertErr(err)
+
+	// invalid modification times fail the migration
+	v1DB, err = sqlitex.NewDB(v1File, sqlitex.WithJournalMode(sqlitex.JournalDelete))
+	tx.AssertNoErr(err)
+	_, err = v1DB.Exec("UPDATE data SET modified_on = 'yesterday' WHERE key = 'k';")
+	tx.AssertNoErr(err)
+	v1DB.Close()
+	_, err = MigrateV1(v1File, store)
+	tx.AssertErr(err)
+}
@@ -3,10 +3,10 @@ package blobix_v2
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mazzegi/mbox/query"
@@ -34,14 +34,22 @@ CREATE TABLE IF NOT EXISTS index_data (
 
 var _ Store = (*SqliteXStore)(nil)
 
-func NewSqliteXStore(file string) (*SqliteXStore, error) {
-	dbx, err := sqlitex.NewDB(file)
+func NewSqliteXStore(file string, opts ...sqlitex.Option) (*SqliteXStore, error) {
+	dbx, err := sqlitex.NewDB(file, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("sqlitex.newdb at %q: %w", file, err)
 	}
-	_, err = dbx.ExecContext(context.Background(), sqlitex_v1_init)
+	err = sqlitex.Migrate(dbx, sqlitexMigrations)
 	if err != nil {
-		return nil, fmt.Errorf("exec-init: %w", err)
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+	historyBuckets, err := loadHistoryBuckets(dbx)
+	if err != nil {
+		return nil, fmt.Errorf("load-history-buckets: %w", err)
+	}
+	compressedBuckets, err := loadCompressedBuckets(dbx)
+	if err != nil {
+		return nil, fmt.Errorf("load-compressed-buckets: %w", err)
 	}
 	im, err := NewSqliteXIndexManager(dbx)
 	if err != nil {
@@ -49,8 +57,11 @@ func NewSqliteXStore(file string) (*SqliteXStore, error) {
 	}
 
 	s := &SqliteXStore{
-		dbx:          dbx,
-		indexManager: im,
+		dbx:               dbx,
+		indexManager:      im,
+		watchHub:          newWatchHub(),
+		historyBuckets:    historyBuckets,
+		compressedBuckets: compressedBuckets,
 	}
 	err = s.prepare()
 	if err != nil {
@@ -62,43 +73,89 @@ func NewSqliteXStore(file string) (*SqliteXStore, error) {
 type SqliteXStore struct {
 	dbx          *sqlitex.DB
 	indexManager *SqliteXIndexManager
+	watchHub     *watchHub
+	// commitMx keeps the order of published changes in line with the order of commits
+	commitMx sync.Mutex
+	// historyBuckets maps buckets with history enabled to their max versions
+	historyBuckets map[string]int
+	historyMx      sync.RWMutex
+	// compressedBuckets maps buckets to the compression of newly saved values
+	compressedBuckets map[string]Compression
+	compressionMx     sync.RWMutex
 
 	stmtInsertData *sql.Stmt
 	stmtQueryValue *sql.Stmt
 }
 
 func (store *SqliteXStore) Close() {
+	store.watchHub.close()
 	store.dbx.Close()
 }
 
+// Backup writes a consistent copy of the store to dstPath while it is in use
+func (store *SqliteXStore) Backup(ctx context.Context, dstPath string) error {
+	return store.dbx.Backup(ctx, dstPath)
+}
+
+// Settings returns the effective connection settings of the store
+func (store *SqliteXStore) Settings(ctx context.Context) (sqlitex.Settings, error) {
+	return store.dbx.Settings(ctx)
+}
+
 func (store *SqliteXStore) prepare() error {
 	var err error
-	store.stmtInsertData, err = store.dbx.PrepareExec("INSERT OR REPLACE INTO data (bucket ,key, modified_on, meta, value) VALUES(?,?,?,?,?);")
+	// every save increments the revision of the key. A new key continues after its history, if any.
+	store.stmtInsertData, err = store.dbx.PrepareExec(`INSERT INTO data (bucket, key, modified_on, meta, value, expires_at, encoding, revision)
+		VALUES(?1,?2,?3,?4,?5,?6,?7, COALESCE((SELECT MAX(revision) FROM history WHERE bucket = ?1 AND key = ?2), 0) + 1)
+		ON CONFLICT(bucket, key) DO UPDATE SET
+			modified_on = excluded.modified_on, meta = excluded.meta, value = excluded.value,
+			expires_at = excluded.expires_at, encoding = excluded.encoding, revision = data.revision + 1;`)
 	if err != nil {
 		return fmt.Errorf("prepare-insert-data: %w", err)
 	}
-	store.stmtQueryValue, err = store.dbx.PrepareQuery("SELECT value FROM data WHERE bucket = ? AND key = ?;")
+	store.stmtQueryValue, err = store.dbx.PrepareQuery("SELECT value, encoding FROM data WHERE " + notExpired + " AND bucket = ? AND key = ?;")
 	if err != nil {
 		return fmt.Errorf("prepare-query-value: %w", err)
 	}
 	return nil
 }
 
+// notExpired is the condition for rows of the data table which are not expired at the time passed as first argument
+const notExpired = "(expires_at IS NULL OR expires_at > ?)"
+
+func expiryNow() int64 {
+	return time.Now().UnixNano()
+}
+
 func formatTime(t time.Time) string {
 	return t.UTC().Round(time.Microsecond).Format(time.RFC3339Nano)
 }
 
 type sqliteXStoreTx struct {
-	store *SqliteXStore
-	tx    *sql.Tx
+	store   *SqliteXStore
+	tx      *sql.Tx
+	changes []ChangeEvent
 }
 
 func (stx *sqliteXStoreTx) Rollback() error {
+	stx.changes = nil
 	return stx.tx.Rollback()
 }
 
 func (stx *sqliteXStoreTx) Commit() error {
-	return stx.tx.Commit()
+	stx.store.commitMx.Lock()
+	defer stx.store.commitMx.Unlock()
+	err := stx.tx.Commit()
+	if err != nil {
+		return err
+	}
+	stx.store.watchHub.publish(stx.changes)
+	stx.changes = nil
+	return nil
+}
+
+func (store *SqliteXStore) Watch(ctx context.Context, bucket string, keyPrefix string, opts *WatchOptions) *Watcher {
+	return store.watchHub.watch(ctx, bucket, keyPrefix, opts)
 }
 
 func (store *SqliteXStore) BeginTx() (Tx, error) {
@@ -112,42 +169,142 @@ func (store *SqliteXStore) BeginTx() (Tx, error) {
 	}, nil
 }
 
+// Update runs fn in a transaction on the single writer connection. fn must not call writing methods
+// of the store or its buckets other than through tx, as they wait for the connection fn is holding.
+func (store *SqliteXStore) Update(fn func(tx TypedTx) error) error {
+	tx, err := store.BeginTx()
+	if err != nil {
+		return fmt.Errorf("begin-tx: %w", err)
+	}
+	done := false
+	defer func() {
+		if !done {
+			tx.Rollback()
+		}
+	}()
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+	done = true
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
 func (stx *sqliteXStoreTx) SaveRaw(bucket string, key string, raw []byte) error {
+	return stx.SaveRawWithTTL(bucket, key, raw, 0)
+}
+
+// SaveRawWithTTL saves raw which expires after ttl. A ttl <= 0 means no expiry.
+func (stx *sqliteXStoreTx) SaveRawWithTTL(bucket string, key string, raw []byte, ttl time.Duration) error {
+	return stx.saveRaw(bucket, key, raw, nil, ttl)
+}
+
+// SaveRawWithMeta saves raw along with the json encoded meta
+func (stx *sqliteXStoreTx) SaveRawWithMeta(bucket string, key string, raw []byte, meta []byte) error {
+	return stx.saveRaw(bucket, key, raw, meta, 0)
+}
+
+func (stx *sqliteXStoreTx) saveRaw(bucket string, key string, raw []byte, meta []byte, ttl time.Duration) error {
+	modifiedOn := modificationTime()
+	var expiresAt *int64
+	if ttl > 0 {
+		exp := modifiedOn.Add(ttl).UnixNano()
+		expiresAt = &exp
+	}
+	return stx.saveRawAt(bucket, key, raw, meta, modifiedOn, expiresAt)
+}
+
+func (stx *sqliteXStoreTx) saveRawAt(bucket string, key string, raw []byte, meta []byte, modifiedOn time.Time, expiresAt *int64) error {
 	stmt := stx.tx.Stmt(stx.store.stmtInsertData)
-	err := stx.store.saveRawStmtWithMeta(context.Background(), stmt, bucket, key, raw, nil)
+	err := stx.archive(bucket, archiveUpdate, key)
+	if err != nil {
+		return fmt.Errorf("archive: %w", err)
+	}
+	err = stx.store.saveRawStmtWithMeta(context.Background(), stmt, bucket, key, raw, meta, modifiedOn, expiresAt)
 	if err != nil {
 		return fmt.Errorf("put-json-with-meta: %w", err)
 	}
+	err = stx.store.indexManager.onSave(stx.tx, bucket, key)
+	if err != nil {
+		return fmt.Errorf("update path indexes: %w", err)
+	}
+	stx.changes = append(stx.changes, ChangeEvent{Type: ChangePut, Bucket: bucket, Key: key, ModifiedOn: modifiedOn, Value: raw})
 	return nil
 }
 
 func (stx *sqliteXStoreTx) SaveRawMany(bucket string, kvs []Tuple[string, []byte]) error {
 	stmt := stx.tx.Stmt(stx.store.stmtInsertData)
+	modifiedOn := modificationTime()
 	for _, t := range kvs {
-		err := stx.store.saveRawStmtWithMeta(context.Background(), stmt, bucket, t.Key, t.Value, nil)
+		err := stx.archive(bucket, archiveUpdate, t.Key)
+		if err != nil {
+			return fmt.Errorf("archive: %w", err)
+		}
+		err = stx.store.saveRawStmtWithMeta(context.Background(), stmt, bucket, t.Key, t.Value, nil, modifiedOn, nil)
 		if err != nil {
 			return fmt.Errorf("put-json-with-meta: %w", err)
 		}
+		err = stx.store.indexManager.onSave(stx.tx, bucket, t.Key)
+		if err != nil {
+			return fmt.Errorf("update path indexes: %w", err)
+		}
+		stx.changes = append(stx.changes, ChangeEvent{Type: ChangePut, Bucket: bucket, Key: t.Key, ModifiedOn: modifiedOn, Value: t.Value})
 	}
 	return nil
 }
 
 func (stx *sqliteXStoreTx) Delete(bucket string, keys ...string) error {
-	whereIn := make([]string, len(keys))
-	for i, k := range keys {
-		whereIn[i] = fmt.Sprintf("'%s'", k)
-	}
-	_, err := stx.tx.ExecContext(
-		context.TODO(),
-		fmt.Sprintf("DELETE FROM data WHERE bucket = ? AND key IN (%s);",
-			strings.Join(whereIn, ", ")), bucket)
-	if err != nil {
-		return fmt.Errorf("exec delete: %w", err)
-	}
+	return stx.deleteKeys(bucket, archiveDelete, keys...)
+}
 
-	err = stx.store.indexManager.onDelete(stx.tx, bucket, keys...)
-	if err != nil {
-		return fmt.Errorf("delete from indexes: %w", err)
+// deleteKeys deletes keys and archives them with reason, if history is enabled for bucket
+func (stx *sqliteXStoreTx) deleteKeys(bucket string, reason archiveReason, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	modifiedOn := modificationTime()
+	for _, chunk := range slicesx.Chunks(keys, 500) {
+		args := append([]any{bucket}, slicesx.Anys(chunk)...)
+		keyPHs := strings.Join(slicesx.Repeat("?", len(chunk)), ",")
+		err := stx.archive(bucket, reason, chunk...)
+		if err != nil {
+			return fmt.Errorf("archive: %w", err)
+		}
+		rows, err := stx.tx.QueryContext(
+			context.TODO(),
+			fmt.Sprintf("DELETE FROM data WHERE bucket = ? AND key IN (%s) RETURNING key;", keyPHs),
+			args...)
+		if err != nil {
+			return fmt.Errorf("exec delete: %w", err)
+		}
+		var key string
+		for rows.Next() {
+			err = rows.Scan(&key)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("scan: %w", err)
+			}
+			stx.changes = append(stx.changes, ChangeEvent{Type: ChangeDelete, Bucket: bucket, Key: key, ModifiedOn: modifiedOn})
+		}
+		err = rows.Close()
+		if err != nil {
+			return fmt.Errorf("exec delete: %w", err)
+		}
+		_, err = stx.tx.ExecContext(
+			context.TODO(),
+			fmt.Sprintf("DELETE FROM blobs WHERE bucket = ? AND key IN (%s);", keyPHs),
+			args...)
+		if err != nil {
+			return fmt.Errorf("exec delete blobs: %w", err)
+		}
+		err = stx.store.indexManager.onDelete(stx.tx, bucket, chunk...)
+		if err != nil {
+			return fmt.Errorf("delete from indexes: %w", err)
+		}
 	}
 	return nil
 }
@@ -156,16 +313,16 @@ func (stx *sqliteXStoreTx) UpdateIndex(bucketName string, idxName string, key st
 	return stx.store.indexManager.updateIndex(stx.tx, bucketName, idxName, key, values)
 }
 
-func (store *SqliteXStore) saveRawStmtWithMeta(ctx context.Context, stmt *sql.Stmt, bucket string, key string, raw []byte, meta any) error {
-	var metabs []byte
-	var err error
-	if meta != nil {
-		metabs, err = json.Marshal(meta)
-		if err != nil {
-			return fmt.Errorf("json.marshal meta: %w", err)
-		}
+func modificationTime() time.Time {
+	return time.Now().UTC().Round(time.Microsecond)
+}
+
+func (store *SqliteXStore) saveRawStmtWithMeta(ctx context.Context, stmt *sql.Stmt, bucket string, key string, raw []byte, meta []byte, modifiedOn time.Time, expiresAt *int64) error {
+	stored, encoding, err := store.encodeValue(bucket, raw)
+	if err != nil {
+		return fmt.Errorf("encode: %w", err)
 	}
-	_, err = stmt.ExecContext(ctx, bucket, key, formatTime(time.Now()), string(metabs), raw)
+	_, err = stmt.ExecContext(ctx, bucket, key, formatTime(modifiedOn), string(meta), stored, expiresAt, encoding)
 	if err != nil {
 		return fmt.Errorf("exec: %w", err)
 	}
@@ -173,9 +330,10 @@ func (store *SqliteXStore) saveRawStmtWithMeta(ctx context.Context, stmt *sql.St
 }
 
 func (store *SqliteXStore) FindRaw(bucket string, key string) ([]byte, query.Found, error) {
-	row := store.stmtQueryValue.QueryRowContext(context.TODO(), bucket, key)
-	var value sql.NullString
-	err := row.Scan(&value)
+	row := store.stmtQueryValue.QueryRowContext(context.TODO(), expiryNow(), bucket, key)
+	var value []byte
+	var encoding string
+	err := row.Scan(&value, &encoding)
 
 	switch {
 	case errors.Is(err, sql.ErrNoRows):
@@ -183,17 +341,99 @@ func (store *SqliteXStore) FindRaw(bucket string, key string) ([]byte, query.Fou
 	case err != nil:
 		return nil, false, fmt.Errorf("scan: %w", err)
 	}
-	return []byte(value.String), true, nil
+	raw, err := decodeValue(value, encoding)
+	if err != nil {
+		return nil, false, fmt.Errorf("decode: %w", err)
+	}
+	return raw, true, nil
+}
+
+// rawEntryColumns are the columns of the data table scanned by scanRawEntry
+const rawEntryColumns = "value, meta, modified_on, revision, encoding"
+
+// scanRawEntry scans rawEntryColumns after the leading dests
+func scanRawEntry(row rowScanner, e *RawEntry, leading ...any) error {
+	var value []byte
+	var meta, modifiedOn sql.NullString
+	var encoding string
+	err := row.Scan(append(leading, &value, &meta, &modifiedOn, &e.Revision, &encoding)...)
+	if err != nil {
+		return err
+	}
+	e.Value, err = decodeValue(value, encoding)
+	if err != nil {
+		return fmt.Errorf("decode: %w", err)
+	}
+	if meta.String != "" {
+		e.Meta = []byte(meta.String)
+	}
+	e.ModifiedOn, err = time.Parse(time.RFC3339Nano, modifiedOn.String)
+	if err != nil {
+		return fmt.Errorf("parse modified-on %q: %w", modifiedOn.String, err)
+	}
+	return nil
+}
+
+const queryRawEntry = "SELECT " + rawEntryColumns + " FROM data WHERE " + notExpired + " AND bucket = ? AND key = ?;"
+
+func (store *SqliteXStore) FindRawEntry(bucket string, key string) (RawEntry, query.Found, error) {
+	row := store.dbx.QueryRowContext(context.TODO(), queryRawEntry, expiryNow(), bucket, key)
+	return findRawEntry(row)
+}
+
+// FindRawEntry reads key within the write transaction
+func (stx *sqliteXStoreTx) FindRawEntry(bucket string, key string) (RawEntry, query.Found, error) {
+	row := stx.tx.QueryRowContext(context.TODO(), queryRawEntry, expiryNow(), bucket, key)
+	return findRawEntry(row)
+}
+
+func findRawEntry(row rowScanner) (RawEntry, query.Found, error) {
+	var e RawEntry
+	err := scanRawEntry(row, &e)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return RawEntry{}, false, nil
+	case err != nil:
+		return RawEntry{}, false, fmt.Errorf("scan: %w", err)
+	}
+	return e, true, nil
+}
+
+func (store *SqliteXStore) FindRawEntries(bucket string, keys ...string) (map[string]RawEntry, error) {
+	es := map[string]RawEntry{}
+	for _, chunk := range slicesx.Chunks(keys, 500) {
+		args := append([]any{expiryNow(), bucket}, slicesx.Anys(chunk)...)
+		keyPHs := strings.Join(slicesx.Repeat("?", len(chunk)), ",")
+		rows, err := store.dbx.Query(
+			fmt.Sprintf(`SELECT key, `+rawEntryColumns+` FROM data WHERE `+notExpired+` AND bucket = ? AND key IN (%s);`, keyPHs),
+			args...,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("query: %w", err)
+		}
+		for rows.Next() {
+			var key string
+			var e RawEntry
+			err := scanRawEntry(rows, &e, &key)
+			if err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("scan: %w", err)
+			}
+			es[key] = e
+		}
+		rows.Close()
+	}
+	return es, nil
 }
 
 func (store *SqliteXStore) FindRawMany(bucket string, keys ...string) (map[string][]byte, error) {
 	rvs := map[string][]byte{}
 	keyChunks := slicesx.Chunks(keys, 500)
 	for _, keys := range keyChunks {
-		args := append([]any{bucket}, slicesx.Anys(keys)...)
+		args := append([]any{expiryNow(), bucket}, slicesx.Anys(keys)...)
 		keyPHs := strings.Join(slicesx.Repeat("?", len(keys)), ",")
 		rows, err := store.dbx.Query(
-			fmt.Sprintf(`SELECT key, value FROM data WHERE bucket = ? AND key IN (%s);`, keyPHs),
+			fmt.Sprintf(`SELECT key, value, encoding FROM data WHERE `+notExpired+` AND bucket = ? AND key IN (%s);`, keyPHs),
 			args...,
 		)
 		if err != nil {
@@ -202,12 +442,17 @@ func (store *SqliteXStore) FindRawMany(bucket string, keys ...string) (map[strin
 		defer rows.Close()
 		for rows.Next() {
 			var key sql.NullString
-			var rv sql.NullString
-			err := rows.Scan(&key, &rv)
+			var rv []byte
+			var encoding string
+			err := rows.Scan(&key, &rv, &encoding)
 			if err != nil {
 				return nil, fmt.Errorf("scan: %w", err)
 			}
-			rvs[key.String] = []byte(rv.String)
+			raw, err := decodeValue(rv, encoding)
+			if err != nil {
+				return nil, fmt.Errorf("decode %q: %w", key.String, err)
+			}
+			rvs[key.String] = raw
 		}
 	}
 	return rvs, nil
@@ -216,8 +461,8 @@ func (store *SqliteXStore) FindRawMany(bucket string, keys ...string) (map[strin
 func (store *SqliteXStore) Keys(bucket string) ([]string, error) {
 	rows, err := store.dbx.QueryContext(
 		context.TODO(),
-		"SELECT key FROM data WHERE bucket = ?;",
-		bucket)
+		"SELECT key FROM data WHERE "+notExpired+" AND bucket = ?;",
+		expiryNow(), bucket)
 	if err != nil {
 		return nil, fmt.Errorf("query: %w", err)
 	}
@@ -236,8 +481,8 @@ func (store *SqliteXStore) Keys(bucket string) ([]string, error) {
 func (store *SqliteXStore) KeysPage(bucket string, skip, limit int, sort query.SortOrder) ([]string, error) {
 	rows, err := store.dbx.QueryContext(
 		context.TODO(),
-		fmt.Sprintf("SELECT key FROM data WHERE bucket = ? ORDER BY key %s LIMIT ? OFFSET ?;", sort),
-		bucket, limit, skip)
+		fmt.Sprintf("SELECT key FROM data WHERE "+notExpired+" AND bucket = ? ORDER BY key %s LIMIT ? OFFSET ?;", sort),
+		expiryNow(), bucket, limit, skip)
 	if err != nil {
 		return nil, fmt.Errorf("query: %w", err)
 	}
@@ -254,14 +499,53 @@ func (store *SqliteXStore) KeysPage(bucket string, skip, limit int, sort query.S
 }
 
 // Indexes
+func (store *SqliteXStore) KeysWithPrefixPage(bucket string, prefix string, skip, limit int, sort query.SortOrder) ([]string, error) {
+	rows, err := store.dbx.QueryContext(
+		context.TODO(),
+		fmt.Sprintf("SELECT key FROM data WHERE "+notExpired+" AND bucket = ? AND substr(key, 1, length(?)) = ? ORDER BY key %s LIMIT ? OFFSET ?;", sort),
+		expiryNow(), bucket, prefix, prefix, limit, skip)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	var keys []string
+	var key sql.NullString
+	for rows.Next() {
+		err = rows.Scan(&key)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		keys = append(keys, key.String)
+	}
+	return keys, nil
+}
+
 func (store *SqliteXStore) FindIndexDescriptor(bucketName string, idxName string) (IndexDescriptor, bool) {
 	return store.indexManager.findIndexDescriptor(bucketName, idxName)
 }
 
+func (store *SqliteXStore) IndexDescriptors(bucketName string) []IndexDescriptor {
+	return store.indexManager.indexDescriptors(bucketName)
+}
+
 func (store *SqliteXStore) CreateIndex(bucketName string, idxName string, fields []IndexFieldDescriptor) error {
+	if hasPathField(fields) && store.compression(bucketName) != CompressionNone {
+		return fmt.Errorf("path fields are not supported in compressed bucket %q", bucketName)
+	}
 	return store.indexManager.createIndex(bucketName, idxName, fields...)
 }
 
+// RebuildIndex refills a path only index, see IndexDescriptor.PathOnly
+func (store *SqliteXStore) RebuildIndex(bucketName string, idxName string) error {
+	return store.indexManager.rebuildIndexOnline(context.Background(), bucketName, idxName, nil, nil)
+}
+
+// RebuildIndexOnline rebuilds an index into a shadow table in batches without blocking writers for the whole rebuild.
+// The shadow table replaces the index table once it caught up with concurrent writes.
+func (store *SqliteXStore) RebuildIndexOnline(ctx context.Context, bucketName string, idxName string, values IndexValuesFunc, opts *RebuildOptions) error {
+	return store.indexManager.rebuildIndexOnline(ctx, bucketName, idxName, values, opts)
+}
+
 func (store *SqliteXStore) DeleteIndex(bucketName string, idxName string) error {
 	return store.indexManager.deleteIndex(bucketName, idxName)
 }
@@ -269,3 +553,11 @@ func (store *SqliteXStore) DeleteIndex(bucketName string, idxName string) error
 func (store *SqliteXStore) QueryKeys(bucketName string, indexName string, q query.Query) ([]string, error) {
 	return store.indexManager.QueryKeys(bucketName, indexName, q)
 }
+
+func (store *SqliteXStore) QueryKeysPage(bucketName string, indexName string, q query.Query, page PageRequest) (QueryKeysResult, error) {
+	return store.indexManager.QueryKeysPage(bucketName, indexName, q, page)
+}
+
+func (store *SqliteXStore) QueryDistinct(bucketName string, indexName string, field string) ([]string, error) {
+	return store.indexManager.QueryDistinct(bucketName, indexName, field)
+}
@@ -0,0 +1,168 @@
+package blobix_v2
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/mazzegi/mbox/query"
+)
+
+// blobs hold binary payloads attached to keys in chunks, so they can be streamed without loading them at once
+const sqlitex_blobs_init = `
+CREATE TABLE IF NOT EXISTS blobs (
+	bucket 		TEXT,
+	key	   		TEXT,
+	chunk		INTEGER,
+	data		BLOB,
+	PRIMARY KEY (bucket, key, chunk)
+);
+`
+
+// BlobChunkSize is the size of the chunks blobs are stored in
+var BlobChunkSize = 256 * 1024
+
+// WriteBlob replaces the blob of key with the content of r. Blobs are deleted along with their key,
+// so key has to exist, otherwise ErrKeyNotFound is returned.
+func (stx *sqliteXStoreTx) WriteBlob(bucket string, key string, r io.Reader) (int64, error) {
+	var exists int
+	err := stx.tx.QueryRowContext(context.TODO(),
+		"SELECT COUNT(*) FROM data WHERE "+notExpired+" AND bucket = ? AND key = ?;", expiryNow(), bucket, key).Scan(&exists)
+	if err != nil {
+		return 0, fmt.Errorf("scan: %w", err)
+	}
+	if exists == 0 {
+		return 0, fmt.Errorf("key %q in bucket %q: %w", key, bucket, ErrKeyNotFound)
+	}
+	_, err = stx.tx.ExecContext(context.TODO(), "DELETE FROM blobs WHERE bucket = ? AND key = ?;", bucket, key)
+	if err != nil {
+		return 0, fmt.Errorf("exec delete: %w", err)
+	}
+	var size int64
+	buf := make([]byte, BlobChunkSize)
+	for chunk := 0; ; chunk++ {
+		n, err := io.ReadFull(r, buf)
+		last := errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+		if err != nil && !last {
+			return size, fmt.Errorf("read chunk %d: %w", chunk, err)
+		}
+		// an empty blob still has its first chunk
+		if n > 0 || chunk == 0 {
+			_, err = stx.tx.ExecContext(context.TODO(),
+				"INSERT INTO blobs (bucket, key, chunk, data) VALUES(?,?,?,?);",
+				bucket, key, chunk, buf[:n])
+			if err != nil {
+				return size, fmt.Errorf("exec insert chunk %d: %w", chunk, err)
+			}
+			size += int64(n)
+		}
+		if last {
+			return size, nil
+		}
+	}
+}
+
+// WriteBlob reads r within a write transaction, so all other writes wait until r is drained.
+// Content coming in slowly, like an upload, should be spooled to a temp file first.
+func (store *SqliteXStore) WriteBlob(bucket string, key string, r io.Reader) (int64, error) {
+	var size int64
+	err := store.Update(func(tx TypedTx) error {
+		var err error
+		size, err = tx.WriteBlob(bucket, key, r)
+		return err
+	})
+	return size, err
+}
+
+// OpenBlob returns a reader over the blob of key, which reads one chunk at a time.
+// All chunks are read in one read transaction, so a blob which is replaced meanwhile is read as it was when opened.
+// The transaction is held until the reader hits EOF or is closed.
+func (store *SqliteXStore) OpenBlob(bucket string, key string) (io.ReadCloser, query.Found, error) {
+	tx, err := store.dbx.BeginRead(context.TODO())
+	if err != nil {
+		return nil, false, fmt.Errorf("begin-read: %w", err)
+	}
+	br := &blobReader{
+		tx:     tx,
+		bucket: bucket,
+		key:    key,
+	}
+	found, err := br.next()
+	if err != nil {
+		br.Close()
+		return nil, false, fmt.Errorf("read first chunk: %w", err)
+	}
+	if !found {
+		return nil, false, nil
+	}
+	return br, true, nil
+}
+
+// ReadBlob writes the blob of key to w
+func (store *SqliteXStore) ReadBlob(bucket string, key string, w io.Writer) (int64, query.Found, error) {
+	br, found, err := store.OpenBlob(bucket, key)
+	if err != nil || !found {
+		return 0, found, err
+	}
+	defer br.Close()
+	n, err := io.Copy(w, br)
+	if err != nil {
+		return n, true, fmt.Errorf("copy: %w", err)
+	}
+	return n, true, nil
+}
+
+type blobReader struct {
+	tx     *sql.Tx
+	bucket string
+	key    string
+	chunk  int
+	buf    []byte
+	eof    bool
+}
+
+// next loads the next chunk into buf
+func (br *blobReader) next() (bool, error) {
+	var data []byte
+	err := br.tx.QueryRowContext(context.TODO(),
+		"SELECT data FROM blobs WHERE bucket = ? AND key = ? AND chunk = ?;",
+		br.bucket, br.key, br.chunk).Scan(&data)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		br.eof = true
+		br.tx.Rollback()
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf("scan: %w", err)
+	}
+	br.buf = data
+	br.chunk++
+	return true, nil
+}
+
+func (br *blobReader) Read(p []byte) (int, error) {
+	for len(br.buf) == 0 {
+		if br.eof {
+			return 0, io.EOF
+		}
+		_, err := br.next()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, br.buf)
+	br.buf = br.buf[n:]
+	return n, nil
+}
+
+func (br *blobReader) Close() error {
+	br.buf = nil
+	br.eof = true
+	err := br.tx.Rollback()
+	if err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return fmt.Errorf("rollback: %w", err)
+	}
+	return nil
+}
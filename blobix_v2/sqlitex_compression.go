@@ -0,0 +1,183 @@
+package blobix_v2
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/mazzegi/mbox/sqlitex"
+)
+
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+)
+
+const sqlitex_compression_init = `
+CREATE TABLE IF NOT EXISTS compressed_buckets (
+	bucket 		TEXT PRIMARY KEY,
+	compression	TEXT NOT NULL
+);
+`
+
+func loadCompressedBuckets(dbx *sqlitex.DB) (map[string]Compression, error) {
+	rows, err := dbx.Query("SELECT bucket, compression FROM compressed_buckets;")
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	cbs := map[string]Compression{}
+	var bucket, compression string
+	for rows.Next() {
+		err = rows.Scan(&bucket, &compression)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		cbs[bucket] = Compression(compression)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return cbs, nil
+}
+
+// EnableCompression compresses values saved to bucket from now on. Existing values are compressed when they are saved again.
+// Path index fields can't be evaluated on compressed values, so buckets with path indexes can't be compressed.
+func (store *SqliteXStore) EnableCompression(bucket string, c Compression) error {
+	if c != CompressionGzip {
+		return fmt.Errorf("unsupported compression %q", c)
+	}
+	for _, idx := range store.IndexDescriptors(bucket) {
+		if hasPathField(idx.Fields) {
+			return fmt.Errorf("bucket %q has path index %q", bucket, idx.IndexName)
+		}
+	}
+	store.compressionMx.Lock()
+	defer store.compressionMx.Unlock()
+	_, err := store.dbx.Exec("INSERT OR REPLACE INTO compressed_buckets (bucket, compression) VALUES(?,?);", bucket, string(c))
+	if err != nil {
+		return fmt.Errorf("exec insert: %w", err)
+	}
+	store.compressedBuckets[bucket] = c
+	return nil
+}
+
+// DisableCompression stores values of bucket uncompressed from now on and decompresses the stored values,
+// so path index fields can be evaluated on all of them. Values in the history stay compressed.
+func (store *SqliteXStore) DisableCompression(bucket string) error {
+	store.compressionMx.Lock()
+	defer store.compressionMx.Unlock()
+	err := store.dbx.WriteTx(context.TODO(), func(tx *sql.Tx) error {
+		_, err := tx.Exec("DELETE FROM compressed_buckets WHERE bucket = ?;", bucket)
+		if err != nil {
+			return fmt.Errorf("exec delete: %w", err)
+		}
+		return decompressBucket(tx, bucket)
+	})
+	if err != nil {
+		return err
+	}
+	delete(store.compressedBuckets, bucket)
+	return nil
+}
+
+// decompressBucket rewrites the compressed values of bucket in place, page by page
+func decompressBucket(tx *sql.Tx, bucket string) error {
+	for {
+		rows, err := tx.Query("SELECT key, value, encoding FROM data WHERE bucket = ? AND encoding != '' LIMIT 500;", bucket)
+		if err != nil {
+			return fmt.Errorf("query: %w", err)
+		}
+		var kvs []Tuple[string, []byte]
+		for rows.Next() {
+			var key, encoding string
+			var value []byte
+			err = rows.Scan(&key, &value, &encoding)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("scan: %w", err)
+			}
+			raw, err := decodeValue(value, encoding)
+			if err != nil {
+				rows.Close()
+				return fmt.Errorf("decode %q: %w", key, err)
+			}
+			kvs = append(kvs, MkTuple(key, raw))
+		}
+		err = rows.Close()
+		if err != nil {
+			return fmt.Errorf("rows: %w", err)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("rows: %w", err)
+		}
+		if len(kvs) == 0 {
+			return nil
+		}
+		for _, kv := range kvs {
+			_, err = tx.Exec("UPDATE data SET value = ?, encoding = '' WHERE bucket = ? AND key = ?;", kv.Value, bucket, kv.Key)
+			if err != nil {
+				return fmt.Errorf("exec update %q: %w", kv.Key, err)
+			}
+		}
+	}
+}
+
+func (store *SqliteXStore) compression(bucket string) Compression {
+	store.compressionMx.RLock()
+	defer store.compressionMx.RUnlock()
+	return store.compressedBuckets[bucket]
+}
+
+func hasPathField(fields []IndexFieldDescriptor) bool {
+	return slices.ContainsFunc(fields, func(f IndexFieldDescriptor) bool { return f.Path != "" })
+}
+
+// encodeValue returns raw as it is stored in bucket along with its encoding
+func (store *SqliteXStore) encodeValue(bucket string, raw []byte) ([]byte, string, error) {
+	switch c := store.compression(bucket); c {
+	case CompressionNone:
+		return raw, "", nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		_, err := zw.Write(raw)
+		if err != nil {
+			return nil, "", fmt.Errorf("gzip.write: %w", err)
+		}
+		err = zw.Close()
+		if err != nil {
+			return nil, "", fmt.Errorf("gzip.close: %w", err)
+		}
+		return buf.Bytes(), string(c), nil
+	default:
+		return nil, "", fmt.Errorf("unsupported compression %q", c)
+	}
+}
+
+// decodeValue returns the original value of a stored value with encoding
+func decodeValue(stored []byte, encoding string) ([]byte, error) {
+	switch Compression(encoding) {
+	case CompressionNone:
+		return stored, nil
+	case CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(stored))
+		if err != nil {
+			return nil, fmt.Errorf("gzip.new-reader: %w", err)
+		}
+		defer zr.Close()
+		raw, err := io.ReadAll(zr)
+		if err != nil {
+			return nil, fmt.Errorf("gzip.read: %w", err)
+		}
+		return raw, nil
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
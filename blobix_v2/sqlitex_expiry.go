@@ -0,0 +1,80 @@
+package blobix_v2
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mazzegi/log"
+)
+
+// SweepExpired deletes all expired keys together with their index rows.
+// With history enabled, they are archived as deleted and expired.
+func (store *SqliteXStore) SweepExpired() (int, error) {
+	tx, err := store.BeginTx()
+	if err != nil {
+		return 0, fmt.Errorf("begin-tx: %w", err)
+	}
+	stx := tx.(*sqliteXStoreTx)
+	expired, err := stx.expiredKeys()
+	if err != nil {
+		stx.Rollback()
+		return 0, fmt.Errorf("expired-keys: %w", err)
+	}
+	var num int
+	for bucket, keys := range expired {
+		err = stx.deleteKeys(bucket, archiveExpire, keys...)
+		if err != nil {
+			stx.Rollback()
+			return 0, fmt.Errorf("delete expired in %q: %w", bucket, err)
+		}
+		num += len(keys)
+	}
+	err = stx.Commit()
+	if err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return num, nil
+}
+
+func (stx *sqliteXStoreTx) expiredKeys() (map[string][]string, error) {
+	rows, err := stx.tx.Query("SELECT bucket, key FROM data WHERE expires_at <= ?;", expiryNow())
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	expired := map[string][]string{}
+	var bucket, key string
+	for rows.Next() {
+		err = rows.Scan(&bucket, &key)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		expired[bucket] = append(expired[bucket], key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return expired, nil
+}
+
+// RunSweeper deletes expired keys every interval until ctx is done
+func (store *SqliteXStore) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			num, err := store.SweepExpired()
+			if err != nil {
+				log.Errorf("sweep-expired: %v", err)
+				continue
+			}
+			if num > 0 {
+				log.Debugf("sweep-expired: deleted %d keys", num)
+			}
+		}
+	}
+}
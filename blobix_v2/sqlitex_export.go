@@ -0,0 +1,421 @@
+package blobix_v2
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/mazzegi/log"
+)
+
+// exportHeader is the first line of a bucket export
+type exportHeader struct {
+	Bucket  string            `json:"bucket"`
+	Indexes []IndexDescriptor `json:"indexes"`
+}
+
+// exportEntry is one line per key of a bucket export. Values which are no valid json are exported as ValueString.
+// The blob of a key follows its entry with one line per chunk, which has BlobChunk set.
+type exportEntry struct {
+	Key         string          `json:"key"`
+	ModifiedOn  time.Time       `json:"modified_on"`
+	Revision    int64           `json:"revision,omitempty"`
+	ExpiresAt   *time.Time      `json:"expires_at,omitempty"`
+	Meta        json.RawMessage `json:"meta,omitempty"`
+	Value       json.RawMessage `json:"value,omitempty"`
+	ValueString *string         `json:"value_string,omitempty"`
+	BlobChunk   *int            `json:"blob_chunk,omitempty"`
+	Blob        []byte          `json:"blob,omitempty"`
+}
+
+type ImportPolicy string
+
+const (
+	// ImportMerge keeps existing keys and only adds the missing ones
+	ImportMerge ImportPolicy = "merge"
+	// ImportOverwrite replaces existing keys with the imported ones
+	ImportOverwrite ImportPolicy = "overwrite"
+)
+
+type ImportOptions struct {
+	Policy ImportPolicy
+	// Bucket imports into another bucket than the exported one
+	Bucket string
+	// BatchSize is the number of keys written in one transaction. Defaults to 500.
+	BatchSize int
+}
+
+type ImportResult struct {
+	Bucket   string
+	Imported int
+	Skipped  int
+	// StaleIndexes are existing indexes with value func fields, which the import can't update.
+	// They have to be rebuilt through their typed bucket.
+	StaleIndexes []string
+}
+
+const exportPageSize = 500
+
+// Buckets returns the names of all buckets containing keys
+func (store *SqliteXStore) Buckets() ([]string, error) {
+	rows, err := store.dbx.Query("SELECT DISTINCT bucket FROM data ORDER BY bucket;")
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	var buckets []string
+	var bucket string
+	for rows.Next() {
+		err = rows.Scan(&bucket)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		buckets = append(buckets, bucket)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return buckets, nil
+}
+
+type exportedEntry struct {
+	RawEntry
+	ExpiresAt *time.Time
+}
+
+// entriesAfter returns up to limit entries of bucket with keys greater than afterKey in key order
+func (store *SqliteXStore) entriesAfter(bucket string, afterKey string, limit int) ([]Tuple[string, exportedEntry], error) {
+	rows, err := store.dbx.Query(
+		"SELECT key, expires_at, "+rawEntryColumns+" FROM data WHERE "+notExpired+" AND bucket = ? AND key > ? ORDER BY key ASC LIMIT ?;",
+		expiryNow(), bucket, afterKey, limit)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	var kes []Tuple[string, exportedEntry]
+	for rows.Next() {
+		var key string
+		var expiresAt sql.NullInt64
+		var e exportedEntry
+		err = scanRawEntry(rows, &e.RawEntry, &key, &expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		if expiresAt.Valid {
+			t := time.Unix(0, expiresAt.Int64).UTC()
+			e.ExpiresAt = &t
+		}
+		kes = append(kes, MkTuple(key, e))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return kes, nil
+}
+
+// blobKeys returns the keys of bucket in (afterKey, lastKey] which have a blob
+func (store *SqliteXStore) blobKeys(bucket string, afterKey string, lastKey string) (map[string]bool, error) {
+	rows, err := store.dbx.Query("SELECT DISTINCT key FROM blobs WHERE bucket = ? AND key > ? AND key <= ?;", bucket, afterKey, lastKey)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	keys := map[string]bool{}
+	var key string
+	for rows.Next() {
+		err = rows.Scan(&key)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		keys[key] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return keys, nil
+}
+
+// exportBlob encodes the chunks of the blob of key, one line each
+func (store *SqliteXStore) exportBlob(enc *json.Encoder, bucket string, key string) error {
+	rows, err := store.dbx.Query("SELECT chunk, data FROM blobs WHERE bucket = ? AND key = ? ORDER BY chunk;", bucket, key)
+	if err != nil {
+		return fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var chunk int
+		var data []byte
+		err = rows.Scan(&chunk, &data)
+		if err != nil {
+			return fmt.Errorf("scan: %w", err)
+		}
+		err = enc.Encode(exportEntry{Key: key, BlobChunk: &chunk, Blob: data})
+		if err != nil {
+			return fmt.Errorf("encode chunk %d: %w", chunk, err)
+		}
+	}
+	return rows.Err()
+}
+
+// ExportBucket writes the index definitions and all keys of bucket with their blobs as NDJSON to w, page by page.
+// Expired keys are not exported.
+func (store *SqliteXStore) ExportBucket(bucket string, w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	err := enc.Encode(exportHeader{
+		Bucket:  bucket,
+		Indexes: store.IndexDescriptors(bucket),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("encode header: %w", err)
+	}
+	var num int
+	afterKey := ""
+	for {
+		kes, err := store.entriesAfter(bucket, afterKey, exportPageSize)
+		if err != nil {
+			return num, fmt.Errorf("entries-after %q: %w", afterKey, err)
+		}
+		if len(kes) == 0 {
+			break
+		}
+		blobKeys, err := store.blobKeys(bucket, afterKey, kes[len(kes)-1].Key)
+		if err != nil {
+			return num, fmt.Errorf("blob-keys: %w", err)
+		}
+		for _, ke := range kes {
+			ee := exportEntry{
+				Key:        ke.Key,
+				ModifiedOn: ke.Value.ModifiedOn,
+				Revision:   ke.Value.Revision,
+				ExpiresAt:  ke.Value.ExpiresAt,
+				Meta:       ke.Value.Meta,
+			}
+			if json.Valid(ke.Value.Value) {
+				ee.Value = ke.Value.Value
+			} else {
+				s := string(ke.Value.Value)
+				ee.ValueString = &s
+			}
+			err = enc.Encode(ee)
+			if err != nil {
+				return num, fmt.Errorf("encode %q: %w", ke.Key, err)
+			}
+			if blobKeys[ke.Key] {
+				err = store.exportBlob(enc, bucket, ke.Key)
+				if err != nil {
+					return num, fmt.Errorf("export blob of %q: %w", ke.Key, err)
+				}
+			}
+			num++
+		}
+		if len(kes) < exportPageSize {
+			break
+		}
+		afterKey = kes[len(kes)-1].Key
+	}
+	err = bw.Flush()
+	if err != nil {
+		return num, fmt.Errorf("flush: %w", err)
+	}
+	return num, nil
+}
+
+// ImportBucket reads an export of ExportBucket from r. Missing path only indexes are created and rebuilt.
+// Indexes with value func fields are not created, as they need their typed bucket.
+// Imported keys get at least their exported revision, so revisions don't go backwards.
+func (store *SqliteXStore) ImportBucket(r io.Reader, opts ImportOptions) (ImportResult, error) {
+	var res ImportResult
+	switch opts.Policy {
+	case ImportMerge, ImportOverwrite:
+	default:
+		return res, fmt.Errorf("invalid import policy %q", opts.Policy)
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var hdr exportHeader
+	err := dec.Decode(&hdr)
+	if err != nil {
+		return res, fmt.Errorf("decode header: %w", err)
+	}
+	res.Bucket = hdr.Bucket
+	if opts.Bucket != "" {
+		res.Bucket = opts.Bucket
+	}
+
+	// path only indexes are created before the data is written, so they are maintained on save
+	for _, idx := range hdr.Indexes {
+		if !idx.PathOnly() {
+			continue
+		}
+		if _, ok := store.FindIndexDescriptor(res.Bucket, idx.IndexName); ok {
+			continue
+		}
+		err = store.CreateIndex(res.Bucket, idx.IndexName, idx.Fields)
+		if err != nil {
+			return res, fmt.Errorf("create-index %q: %w", idx.IndexName, err)
+		}
+	}
+	for _, idx := range store.IndexDescriptors(res.Bucket) {
+		if !idx.PathOnly() && !isV1Index(idx) {
+			res.StaleIndexes = append(res.StaleIndexes, idx.IndexName)
+		}
+	}
+
+	imp := &bucketImport{
+		store:  store,
+		dec:    dec,
+		bucket: res.Bucket,
+		policy: opts.Policy,
+	}
+	for {
+		n, skipped, err := imp.batch(batchSize)
+		res.Imported += n
+		res.Skipped += skipped
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return res, fmt.Errorf("import-batch: %w", err)
+		}
+	}
+	log.Debugf("import-bucket %q: imported %d, skipped %d", res.Bucket, res.Imported, res.Skipped)
+	return res, nil
+}
+
+// SaveRawUntyped saves raw outside of a typed bucket, e.g. from tools. Path and v1 indexes are updated.
+// It fails if bucket has indexes with value func fields, as their values need the typed bucket.
+func (store *SqliteXStore) SaveRawUntyped(bucket string, key string, raw []byte) error {
+	for _, idx := range store.IndexDescriptors(bucket) {
+		if !idx.PathOnly() && !isV1Index(idx) {
+			return fmt.Errorf("index %q has value func fields, save through its typed bucket", idx.IndexName)
+		}
+	}
+	return store.Update(func(tx TypedTx) error {
+		stx := tx.(*sqliteXStoreTx)
+		err := stx.SaveRaw(bucket, key, raw)
+		if err != nil {
+			return fmt.Errorf("save-raw: %w", err)
+		}
+		err = stx.updateV1Indexes(bucket, key, raw)
+		if err != nil {
+			return fmt.Errorf("update-v1-indexes: %w", err)
+		}
+		return nil
+	})
+}
+
+type bucketImport struct {
+	store  *SqliteXStore
+	dec    *json.Decoder
+	bucket string
+	policy ImportPolicy
+	// skipKey is the last skipped key, whose blob chunks are skipped as well
+	skipKey *string
+}
+
+// batch imports up to batchSize lines in one transaction. It returns io.EOF after the last line was read.
+func (imp *bucketImport) batch(batchSize int) (int, int, error) {
+	tx, err := imp.store.BeginTx()
+	if err != nil {
+		return 0, 0, fmt.Errorf("begin-tx: %w", err)
+	}
+	stx := tx.(*sqliteXStoreTx)
+	var imported, skipped int
+	var eof bool
+	for range batchSize {
+		var ee exportEntry
+		err := imp.dec.Decode(&ee)
+		if errors.Is(err, io.EOF) {
+			eof = true
+			break
+		}
+		if err != nil {
+			stx.Rollback()
+			return 0, 0, fmt.Errorf("decode entry: %w", err)
+		}
+		if ee.BlobChunk != nil {
+			if imp.skipKey != nil && *imp.skipKey == ee.Key {
+				continue
+			}
+			_, err = stx.tx.Exec("INSERT INTO blobs (bucket, key, chunk, data) VALUES(?,?,?,?);", imp.bucket, ee.Key, *ee.BlobChunk, ee.Blob)
+			if err != nil {
+				stx.Rollback()
+				return 0, 0, fmt.Errorf("insert blob chunk %d of %q: %w", *ee.BlobChunk, ee.Key, err)
+			}
+			continue
+		}
+		ok, err := imp.entry(stx, ee)
+		if err != nil {
+			stx.Rollback()
+			return 0, 0, fmt.Errorf("import %q: %w", ee.Key, err)
+		}
+		if ok {
+			imp.skipKey = nil
+			imported++
+		} else {
+			imp.skipKey = &ee.Key
+			skipped++
+		}
+	}
+	err = stx.Commit()
+	if err != nil {
+		return 0, 0, fmt.Errorf("commit: %w", err)
+	}
+	if eof {
+		return imported, skipped, io.EOF
+	}
+	return imported, skipped, nil
+}
+
+// entry saves ee unless it is skipped by the policy. The existing blob of key is replaced by the one of ee, if any.
+func (imp *bucketImport) entry(stx *sqliteXStoreTx, ee exportEntry) (bool, error) {
+	if imp.policy == ImportMerge {
+		_, _, found, err := stx.FindRawWithRevision(imp.bucket, ee.Key)
+		if err != nil {
+			return false, fmt.Errorf("find: %w", err)
+		}
+		if found {
+			return false, nil
+		}
+	}
+	raw := []byte(ee.Value)
+	if ee.ValueString != nil {
+		raw = []byte(*ee.ValueString)
+	}
+	modifiedOn := ee.ModifiedOn
+	if modifiedOn.IsZero() {
+		modifiedOn = modificationTime()
+	}
+	var expiresAt *int64
+	if ee.ExpiresAt != nil {
+		exp := ee.ExpiresAt.UnixNano()
+		expiresAt = &exp
+	}
+	err := stx.saveRawAt(imp.bucket, ee.Key, raw, ee.Meta, modifiedOn, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("save: %w", err)
+	}
+	if ee.Revision > 0 {
+		_, err = stx.tx.Exec("UPDATE data SET revision = MAX(revision, ?) WHERE bucket = ? AND key = ?;", ee.Revision, imp.bucket, ee.Key)
+		if err != nil {
+			return false, fmt.Errorf("exec update revision: %w", err)
+		}
+	}
+	_, err = stx.tx.Exec("DELETE FROM blobs WHERE bucket = ? AND key = ?;", imp.bucket, ee.Key)
+	if err != nil {
+		return false, fmt.Errorf("exec delete blob: %w", err)
+	}
+	err = stx.updateV1Indexes(imp.bucket, ee.Key, raw)
+	if err != nil {
+		return false, fmt.Errorf("update-v1-indexes: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,211 @@
+package blobix_v2
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mazzegi/mbox/query"
+	"github.com/mazzegi/mbox/slicesx"
+	"github.com/mazzegi/mbox/sqlitex"
+)
+
+const sqlitex_history_init = `
+CREATE TABLE IF NOT EXISTS history (
+	bucket 		TEXT,
+	key	   		TEXT,
+	revision	INTEGER,
+	modified_on TEXT,
+	meta 		TEXT,
+	value  		TEXT,
+	deleted		INTEGER NOT NULL DEFAULT 0,
+	PRIMARY KEY (bucket, key, revision)
+);
+
+CREATE TABLE IF NOT EXISTS history_buckets (
+	bucket 			TEXT PRIMARY KEY,
+	max_versions	INTEGER NOT NULL
+);
+`
+
+func loadHistoryBuckets(dbx *sqlitex.DB) (map[string]int, error) {
+	rows, err := dbx.Query("SELECT bucket, max_versions FROM history_buckets;")
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	hbs := map[string]int{}
+	var bucket string
+	var maxVersions int
+	for rows.Next() {
+		err = rows.Scan(&bucket, &maxVersions)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		hbs[bucket] = maxVersions
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return hbs, nil
+}
+
+// EnableHistory keeps up to maxVersions prior versions of each key in bucket.
+// With history enabled, deleted keys are kept in the history as well and can be restored.
+func (store *SqliteXStore) EnableHistory(bucket string, maxVersions int) error {
+	if maxVersions <= 0 {
+		return fmt.Errorf("max-versions must be positive")
+	}
+	store.historyMx.Lock()
+	defer store.historyMx.Unlock()
+	_, err := store.dbx.Exec("INSERT OR REPLACE INTO history_buckets (bucket, max_versions) VALUES(?,?);", bucket, maxVersions)
+	if err != nil {
+		return fmt.Errorf("exec insert: %w", err)
+	}
+	store.historyBuckets[bucket] = maxVersions
+	return nil
+}
+
+// DisableHistory stops recording versions of keys in bucket and drops its history
+func (store *SqliteXStore) DisableHistory(bucket string) error {
+	store.historyMx.Lock()
+	defer store.historyMx.Unlock()
+	tx, err := store.dbx.Begin()
+	if err != nil {
+		return fmt.Errorf("begin: %w", err)
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("DELETE FROM history_buckets WHERE bucket = ?;", bucket)
+	if err != nil {
+		return fmt.Errorf("exec delete history-buckets: %w", err)
+	}
+	_, err = tx.Exec("DELETE FROM history WHERE bucket = ?;", bucket)
+	if err != nil {
+		return fmt.Errorf("exec delete history: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	delete(store.historyBuckets, bucket)
+	return nil
+}
+
+func (store *SqliteXStore) historyMaxVersions(bucket string) (int, bool) {
+	store.historyMx.RLock()
+	defer store.historyMx.RUnlock()
+	n, ok := store.historyBuckets[bucket]
+	return n, ok
+}
+
+const selectHistoryEntry = "SELECT revision, modified_on, meta, value, deleted, expired, encoding FROM history"
+
+func scanHistoryEntry(row rowScanner) (HistoryEntry, error) {
+	var he HistoryEntry
+	var modifiedOn string
+	var meta sql.NullString
+	var value []byte
+	var encoding string
+	err := row.Scan(&he.Revision, &modifiedOn, &meta, &value, &he.Deleted, &he.Expired, &encoding)
+	if err != nil {
+		return he, err
+	}
+	he.ModifiedOn, err = time.Parse(time.RFC3339Nano, modifiedOn)
+	if err != nil {
+		return he, fmt.Errorf("parse modified-on %q: %w", modifiedOn, err)
+	}
+	if meta.String != "" {
+		he.Meta = []byte(meta.String)
+	}
+	he.Value, err = decodeValue(value, encoding)
+	if err != nil {
+		return he, fmt.Errorf("decode: %w", err)
+	}
+	return he, nil
+}
+
+// History returns the prior versions of key, newest first. The current version is not part of the history.
+func (store *SqliteXStore) History(bucket string, key string) ([]HistoryEntry, error) {
+	rows, err := store.dbx.Query(selectHistoryEntry+" WHERE bucket = ? AND key = ? ORDER BY revision DESC;", bucket, key)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	var hes []HistoryEntry
+	for rows.Next() {
+		he, err := scanHistoryEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		hes = append(hes, he)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return hes, nil
+}
+
+// FindHistoryEntry returns the version of key at revision from the history. Revision 0 returns the newest one.
+func (stx *sqliteXStoreTx) FindHistoryEntry(bucket string, key string, revision int64) (HistoryEntry, query.Found, error) {
+	var row *sql.Row
+	if revision == 0 {
+		row = stx.tx.QueryRowContext(context.TODO(),
+			selectHistoryEntry+" WHERE bucket = ? AND key = ? ORDER BY revision DESC LIMIT 1;", bucket, key)
+	} else {
+		row = stx.tx.QueryRowContext(context.TODO(),
+			selectHistoryEntry+" WHERE bucket = ? AND key = ? AND revision = ?;", bucket, key, revision)
+	}
+	he, err := scanHistoryEntry(row)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return HistoryEntry{}, false, nil
+	case err != nil:
+		return HistoryEntry{}, false, fmt.Errorf("scan: %w", err)
+	}
+	return he, true, nil
+}
+
+// archiveReason tells why the current version of a key is archived
+type archiveReason int
+
+const (
+	archiveUpdate archiveReason = iota
+	archiveDelete
+	archiveExpire
+)
+
+// archive copies the current versions of keys into the history, if it is enabled for bucket
+func (stx *sqliteXStoreTx) archive(bucket string, reason archiveReason, keys ...string) error {
+	maxVersions, ok := stx.store.historyMaxVersions(bucket)
+	if !ok || len(keys) == 0 {
+		return nil
+	}
+	for _, chunk := range slicesx.Chunks(keys, 500) {
+		keyPHs := strings.Join(slicesx.Repeat("?", len(chunk)), ",")
+		args := append([]any{reason != archiveUpdate, reason == archiveExpire, bucket}, slicesx.Anys(chunk)...)
+		_, err := stx.tx.ExecContext(
+			context.TODO(),
+			fmt.Sprintf(`INSERT OR REPLACE INTO history (bucket, key, revision, modified_on, meta, value, encoding, deleted, expired)
+				SELECT bucket, key, revision, modified_on, meta, value, encoding, ?, ? FROM data WHERE bucket = ? AND key IN (%s);`, keyPHs),
+			args...)
+		if err != nil {
+			return fmt.Errorf("exec insert history: %w", err)
+		}
+		// drop everything at or below the revision which exceeds maxVersions
+		args = append([]any{maxVersions, bucket}, slicesx.Anys(chunk)...)
+		_, err = stx.tx.ExecContext(
+			context.TODO(),
+			fmt.Sprintf(`DELETE FROM history WHERE revision <= (
+					SELECT h.revision FROM history h WHERE h.bucket = history.bucket AND h.key = history.key
+					ORDER BY h.revision DESC LIMIT 1 OFFSET ?
+				) AND bucket = ? AND key IN (%s);`, keyPHs),
+			args...)
+		if err != nil {
+			return fmt.Errorf("exec prune history: %w", err)
+		}
+	}
+	return nil
+}
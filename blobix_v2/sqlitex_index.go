@@ -8,10 +8,12 @@ import (
 	"reflect"
 	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mazzegi/mbox/query"
 	"github.com/mazzegi/mbox/slicesx"
+	"github.com/mazzegi/mbox/sqlb"
 
 	"github.com/mazzegi/mbox/sqlitex"
 )
@@ -57,8 +59,9 @@ func (m sqliteXIndexMeta) containsField(name string) bool {
 
 func NewSqliteXIndexManager(dbx *sqlitex.DB) (*SqliteXIndexManager, error) {
 	im := &SqliteXIndexManager{
-		dbx:     dbx,
-		indexes: make(map[sqliteXIndexKey]sqliteXIndexMeta),
+		dbx:      dbx,
+		indexes:  make(map[sqliteXIndexKey]sqliteXIndexMeta),
+		rebuilds: make(map[sqliteXIndexKey]*indexRebuild),
 	}
 
 	// load indexes
@@ -94,6 +97,9 @@ func NewSqliteXIndexManager(dbx *sqlitex.DB) (*SqliteXIndexManager, error) {
 type SqliteXIndexManager struct {
 	dbx     *sqlitex.DB
 	indexes map[sqliteXIndexKey]sqliteXIndexMeta
+	// rebuilds are the running online rebuilds
+	rebuilds  map[sqliteXIndexKey]*indexRebuild
+	rebuildMx sync.Mutex
 }
 
 func (im *SqliteXIndexManager) findIndexDescriptor(bucketName string, idxName string) (IndexDescriptor, bool) {
@@ -109,11 +115,35 @@ func (im *SqliteXIndexManager) findIndexDescriptor(bucketName string, idxName st
 	}, true
 }
 
+func (im *SqliteXIndexManager) indexDescriptors(bucketName string) []IndexDescriptor {
+	var descs []IndexDescriptor
+	for key := range im.indexes {
+		if key.bucketName != bucketName {
+			continue
+		}
+		desc, _ := im.findIndexDescriptor(bucketName, key.indexName)
+		descs = append(descs, desc)
+	}
+	slices.SortFunc(descs, func(d1, d2 IndexDescriptor) int { return strings.Compare(d1.IndexName, d2.IndexName) })
+	return descs
+}
+
 func (im *SqliteXIndexManager) indexTabName(bucketName string, idxName string) string {
 	return fmt.Sprintf("_index_%s_%s", bucketName, idxName)
 }
 
 func (im *SqliteXIndexManager) createIndex(bucketName string, name string, fields ...IndexFieldDescriptor) error {
+	for _, field := range fields {
+		if field.Path != "" && !strings.HasPrefix(field.Path, "$") {
+			return fmt.Errorf("invalid path %q of field %q: must start with $", field.Path, field.Name)
+		}
+		if _, err := sqlb.Ident(field.Name); err != nil {
+			return fmt.Errorf("field: %w", err)
+		}
+	}
+	if _, err := sqlb.Ident(im.indexTabName(bucketName, name)); err != nil {
+		return fmt.Errorf("index table: %w", err)
+	}
 	idxMeta := sqliteXIndexMeta{
 		Bucket:    bucketName,
 		Name:      name,
@@ -131,77 +161,111 @@ func (im *SqliteXIndexManager) createIndex(bucketName string, name string, field
 		return fmt.Errorf("begin-tx")
 	}
 
-	sqliteDataTypeFromIndexFieldType := func(ft IndexFieldType) string {
-		switch ft {
-		case IndexFieldString:
-			return "TEXT"
-		case IndexFieldInt:
-			return "INTEGER"
-		case IndexFieldFloat:
-			return "REAL"
-		default:
-			return "TEXT"
-		}
+	err = createIndexTable(tx, idxMeta.TableName, fields)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("create index table: %w", err)
+	}
+	err = createIndexTableIndexes(tx, idxMeta)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("create index: %w", err)
+	}
+
+	// write index metadata
+	_, err = tx.ExecContext(
+		context.TODO(),
+		"INSERT INTO index_data (bucket, name, meta) VALUES(?,?,?);",
+		bucketName, name, string(bs),
+	)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("exec-create-index: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit-tx: %w", err)
 	}
+	im.indexes[idxMeta.key()] = idxMeta
+	return nil
+}
 
-	// create index table
+func sqliteDataTypeFromIndexFieldType(ft IndexFieldType) string {
+	switch ft {
+	case IndexFieldString:
+		return "TEXT"
+	case IndexFieldInt:
+		return "INTEGER"
+	case IndexFieldFloat:
+		return "REAL"
+	default:
+		return "TEXT"
+	}
+}
+
+func createIndexTable(tx *sql.Tx, tabName string, fields []IndexFieldDescriptor) error {
+	qtab, err := sqlb.Ident(tabName)
+	if err != nil {
+		return err
+	}
 	var colList []string
 	for _, field := range fields {
+		qcol, err := sqlb.Ident(field.Name)
+		if err != nil {
+			return err
+		}
 		typ := sqliteDataTypeFromIndexFieldType(field.Type)
-		colList = append(colList, fmt.Sprintf("%s %s", field.Name, typ))
+		colList = append(colList, fmt.Sprintf("%s %s", qcol, typ))
 	}
-
-	tabName := im.indexTabName(bucketName, name)
 	createTabStmt := fmt.Sprintf(`
 		CREATE TABLE %s (
 			key 	TEXT,
 			%s,
 			PRIMARY KEY (key)
 		)
-	`, tabName, strings.Join(colList, ",\n"))
+	`, qtab, strings.Join(colList, ",\n"))
 	_, err = tx.ExecContext(context.TODO(), createTabStmt)
 	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("create index table: %w", err)
+		return err
 	}
+	return nil
+}
 
-	// create indexes
-	for _, field := range fields {
-		idxName := fmt.Sprintf("ix_index_%s_%s_%s", bucketName, name, field.Name)
+// createIndexTableIndexes creates the sqlite indexes on the field columns of the index table
+func createIndexTableIndexes(tx *sql.Tx, idxMeta sqliteXIndexMeta) error {
+	qtab, err := sqlb.Ident(idxMeta.TableName)
+	if err != nil {
+		return err
+	}
+	for _, field := range idxMeta.Fields {
+		qidx, err := sqlb.Ident(fmt.Sprintf("ix_index_%s_%s_%s", idxMeta.Bucket, idxMeta.Name, field.Name))
+		if err != nil {
+			return err
+		}
+		qcol, err := sqlb.Ident(field.Name)
+		if err != nil {
+			return err
+		}
 		createIdxStmt := fmt.Sprintf(`
 			CREATE INDEX IF NOT EXISTS %s ON %s (%s);
-		`, idxName, tabName, field.Name)
+		`, qidx, qtab, qcol)
 		_, err = tx.ExecContext(context.TODO(), createIdxStmt)
 		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("create index: %w", err)
+			return err
 		}
 	}
-
-	// write index metadata
-	_, err = tx.ExecContext(
-		context.TODO(),
-		"INSERT INTO index_data (bucket, name, meta) VALUES(?,?,?);",
-		bucketName, name, string(bs),
-	)
-	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("exec-create-index: %w", err)
-	}
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("commit-tx: %w", err)
-	}
-	im.indexes[idxMeta.key()] = idxMeta
 	return nil
 }
 
 func (im *SqliteXIndexManager) deleteIndex(bucketName string, name string) error {
-	tabName := im.indexTabName(bucketName, name)
+	qtab, err := sqlb.Ident(im.indexTabName(bucketName, name))
+	if err != nil {
+		return err
+	}
 	dropTabStmt := fmt.Sprintf(`
 		DROP TABLE IF EXISTS %s;
-	`, tabName)
-	_, err := im.dbx.Exec(dropTabStmt)
+	`, qtab)
+	_, err = im.dbx.Exec(dropTabStmt)
 	if err != nil {
 		return fmt.Errorf("drop index table: %w", err)
 	}
@@ -222,6 +286,7 @@ func (im *SqliteXIndexManager) deleteIndex(bucketName string, name string) error
 }
 
 func (im *SqliteXIndexManager) onDelete(tx *sql.Tx, bucketName string, keys ...string) error {
+	im.markDirty(bucketName, keys...)
 	for idxKey, idxMeta := range im.indexes {
 		if idxKey.bucketName != bucketName {
 			continue
@@ -235,6 +300,10 @@ func (im *SqliteXIndexManager) onDelete(tx *sql.Tx, bucketName string, keys ...s
 }
 
 func (im *SqliteXIndexManager) onIndexDelete(tx *sql.Tx, idxMeta sqliteXIndexMeta, keys ...string) error {
+	qtab, err := sqlb.Ident(idxMeta.TableName)
+	if err != nil {
+		return err
+	}
 	inList := make([]string, len(keys))
 	args := make([]any, len(keys))
 	for i, key := range keys {
@@ -243,9 +312,9 @@ func (im *SqliteXIndexManager) onIndexDelete(tx *sql.Tx, idxMeta sqliteXIndexMet
 		args[i] = sql.Named(param, key)
 	}
 
-	_, err := tx.ExecContext(
+	_, err = tx.ExecContext(
 		context.TODO(),
-		fmt.Sprintf("DELETE FROM %s WHERE key IN (%s);", idxMeta.TableName, strings.Join(inList, ", ")),
+		fmt.Sprintf("DELETE FROM %s WHERE key IN (%s);", qtab, strings.Join(inList, ", ")),
 		args...,
 	)
 	if err != nil {
@@ -273,18 +342,42 @@ func (im *SqliteXIndexManager) updateIndex(tx *sql.Tx, bucketName string, idxNam
 	if !ok {
 		return fmt.Errorf("so such index: %s", idxKey.String())
 	}
+	return updateIndexTable(tx, idxMeta, idxMeta.TableName, key, values)
+}
+
+// updateIndexTable writes the index row of key into tabName, which is the index table or its shadow
+func updateIndexTable(tx *sql.Tx, idxMeta sqliteXIndexMeta, tabName string, key string, values map[string]any) error {
+	bucketName := idxMeta.Bucket
+	qtab, err := sqlb.Ident(tabName)
+	if err != nil {
+		return err
+	}
 	colList := []string{"key"}
 	placeholderList := []string{":key"}
-	for _, field := range idxMeta.Fields {
-		colList = append(colList, field.Name)
-		placeholderList = append(placeholderList, ":"+field.Name)
-	}
 	args := []any{
 		sql.Named("key", key),
+		sql.Named("bucket", bucketName),
 	}
 	for _, field := range idxMeta.Fields {
+		qcol, err := sqlb.Ident(field.Name)
+		if err != nil {
+			return err
+		}
+		colList = append(colList, qcol)
+		if _, ok := values[field.Name]; !ok && field.Path != "" {
+			// path fields without a value are evaluated on the stored value
+			placeholderList = append(placeholderList, fmt.Sprintf("(SELECT CASE WHEN encoding = '' AND json_valid(value) THEN json_extract(value, :path_%s) END FROM data WHERE bucket = :bucket AND key = :key)", field.Name))
+			args = append(args, sql.Named("path_"+field.Name, field.Path))
+			continue
+		}
+		placeholderList = append(placeholderList, ":"+field.Name)
+	}
+	for _, field := range idxMeta.Fields {
+		if _, ok := values[field.Name]; !ok && field.Path != "" {
+			continue
+		}
 		var val any
-		if vsval, ok := values[field.Name]; ok {
+		if vsval, ok := values[field.Name]; ok && vsval != nil {
 			val = vsval
 		} else {
 			args = append(args, sql.Named(field.Name, nil))
@@ -305,9 +398,9 @@ func (im *SqliteXIndexManager) updateIndex(tx *sql.Tx, bucketName string, idxNam
 	}
 
 	//
-	_, err := tx.ExecContext(
+	_, err = tx.ExecContext(
 		context.TODO(),
-		fmt.Sprintf("INSERT OR REPLACE INTO %s (%s) VALUES (%s);", idxMeta.TableName, strings.Join(colList, ", "), strings.Join(placeholderList, ", ")),
+		fmt.Sprintf("INSERT OR REPLACE INTO %s (%s) VALUES (%s);", qtab, strings.Join(colList, ", "), strings.Join(placeholderList, ", ")),
 		args...,
 	)
 	if err != nil {
@@ -316,51 +409,33 @@ func (im *SqliteXIndexManager) updateIndex(tx *sql.Tx, bucketName string, idxNam
 	return nil
 }
 
-func sqlComparator(qc query.Comparator) string {
-	switch qc {
-	case query.ComparatorEqual:
-		return "="
-	case query.ComparatorNotEqual:
-		return "!="
-	case query.ComparatorGreater:
-		return ">"
-	case query.ComparatorGreaterEqual:
-		return ">="
-	case query.ComparatorLess:
-		return "<"
-	case query.ComparatorLessEqual:
-		return "<="
-	case query.ComparatorLike:
-		return "like"
-	default:
-		return "="
+func (m sqliteXIndexMeta) whereOptions() query.SQLWhereOptions {
+	return query.SQLWhereOptions{
+		Column: func(name string) (string, error) {
+			if !m.containsField(name) {
+				return "", fmt.Errorf("index %s contains no field with name %q", m.Name, name)
+			}
+			return name, nil
+		},
+		Value: func(val any) (any, error) {
+			if tim, ok := val.(time.Time); ok {
+				return tim.Format(time.RFC3339Nano), nil
+			}
+			// check if val is struct
+			if val != nil && reflect.TypeOf(val).Kind() == reflect.Struct {
+				sval, ok := tryMarshalString(val)
+				if !ok {
+					return nil, fmt.Errorf("cannot filter for struct %T which is not a stringer", val)
+				}
+				return sval, nil
+			}
+			return val, nil
+		},
 	}
 }
 
 func (im *SqliteXIndexManager) QueryDistinct(bucketName string, indexName string, field string) ([]string, error) {
-	ixkey := sqliteXIndexKey{bucketName: bucketName, indexName: indexName}
-	idxMeta, ok := im.indexes[ixkey]
-	if !ok {
-		return nil, fmt.Errorf("no such index: %s", ixkey)
-	}
-
-	q := fmt.Sprintf("SELECT DISTINCT %s FROM %s ORDER BY %s ASC;", field, idxMeta.TableName, field)
-	rows, err := im.dbx.QueryContext(context.TODO(), q)
-	if err != nil {
-		return nil, fmt.Errorf("query %q: %w", q, err)
-	}
-	defer rows.Close()
-
-	vals := []string{}
-	var val sql.NullString
-	for rows.Next() {
-		err = rows.Scan(&val)
-		if err != nil {
-			return nil, fmt.Errorf("scan: %w", err)
-		}
-		vals = append(vals, val.String)
-	}
-	return vals, nil
+	return im.QueryDistinctWithConditions(bucketName, indexName, field, nil)
 }
 
 func (im *SqliteXIndexManager) QueryDistinctWithConditions(bucketName string, indexName string, field string, conds []query.Condition) ([]string, error) {
@@ -369,65 +444,18 @@ func (im *SqliteXIndexManager) QueryDistinctWithConditions(bucketName string, in
 	if !ok {
 		return nil, fmt.Errorf("no such index: %s", ixkey)
 	}
-
-	// build where clause
-	wheres := []string{}
-	args := []any{}
-	paramIdx := 0
-	for _, cond := range conds {
-		if !idxMeta.containsField(cond.Name) {
-			return nil, fmt.Errorf("index %s contains no field with name %q", indexName, cond.Name)
-		}
-		if cond.Comp == query.ComparatorIn {
-			// this one is special - for the moment only allow string slices
-			vals, ok := cond.Value.([]string)
-			if !ok {
-				return nil, fmt.Errorf("only string slices are allowed for IN queries")
-			}
-			inParamNames := []string{}
-			for _, val := range vals {
-				paramName := fmt.Sprintf("p%03d", paramIdx)
-				paramIdx++
-				inParamNames = append(inParamNames, ":"+paramName)
-				args = append(args, sql.Named(paramName, val))
-			}
-			wheres = append(wheres, fmt.Sprintf("%s IN (%s)", cond.Name, strings.Join(inParamNames, ",")))
-			continue
-		}
-
-		//-- check if val is struct
-		paramName := fmt.Sprintf("p%03d", paramIdx)
-		paramIdx++
-
-		wheres = append(wheres, fmt.Sprintf("%s %s :%s", cond.Name, sqlComparator(cond.Comp), paramName))
-		var val any
-		if cond.Comp == query.ComparatorLike {
-			val = fmt.Sprintf("%%%v%%", cond.Value)
-		} else {
-			val = cond.Value
-		}
-
-		// check if val is struct
-		if reflect.TypeOf(val).Kind() == reflect.Struct {
-			//stringer, ok := val.(fmt.Stringer)
-			sval, ok := tryMarshalString(val)
-			if !ok {
-				return nil, fmt.Errorf("cannot filter for struct %T which is not a stringer", val)
-			}
-			val = sval
-		}
-
-		args = append(args, sql.Named(paramName, val))
+	if !idxMeta.containsField(field) {
+		return nil, fmt.Errorf("index %s has no field %q", ixkey, field)
 	}
 
-	var where string
-	if len(wheres) > 0 {
-		where = " WHERE " + strings.Join(wheres, " AND ")
+	stmt, args, err := sqlb.Select(field).Distinct().
+		From(idxMeta.TableName).
+		Where(sqlb.Filter(query.Query{Conditions: conds}.Where(), idxMeta.whereOptions())).
+		OrderBy(field, query.SortASC).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("build: %w", err)
 	}
-
-	//
-
-	stmt := fmt.Sprintf("SELECT DISTINCT %s FROM %s %s ORDER BY %s ASC;", field, idxMeta.TableName, where, field)
 	rows, err := im.dbx.QueryContext(context.TODO(), stmt, args...)
 	if err != nil {
 		return nil, fmt.Errorf("query %q: %w", stmt, err)
@@ -446,110 +474,70 @@ func (im *SqliteXIndexManager) QueryDistinctWithConditions(bucketName string, in
 	return vals, nil
 }
 
-// func (im *SqliteXIndexManager) Query(bucketName string, indexName string, lo query.LimitOffset, fields []query.Condition, sorts []query.Sort, search query.Search) ([]string, error) {
-func (im *SqliteXIndexManager) QueryKeys(bucketName string, indexName string, q query.Query) ([]string, error) {
-	ixkey := sqliteXIndexKey{bucketName: bucketName, indexName: indexName}
-	idxMeta, ok := im.indexes[ixkey]
-	if !ok {
-		return nil, fmt.Errorf("no such index: %s", ixkey)
+// queryWheres returns the conditions for the filter and search of q
+func (m sqliteXIndexMeta) queryWheres(q query.Query) ([]sqlb.Cond, error) {
+	wheres := []sqlb.Cond{
+		sqlb.Filter(q.Where(), m.whereOptions()),
 	}
-
-	wheres := []string{}
-	args := []any{}
-	paramIdx := 0
-	for _, fq := range q.Conditions {
-		if !idxMeta.containsField(fq.Name) {
-			return nil, fmt.Errorf("index %s contains no field with name %q", indexName, fq.Name)
-		}
-		if fq.Comp == query.ComparatorIn {
-			// this one is special - for the moment only allow string slices
-			vals, ok := fq.Value.([]string)
-			if !ok {
-				return nil, fmt.Errorf("only string slices are allowed for IN queries")
-			}
-			inParamNames := []string{}
-			for _, val := range vals {
-				paramName := fmt.Sprintf("p%03d", paramIdx)
-				paramIdx++
-				inParamNames = append(inParamNames, ":"+paramName)
-				args = append(args, sql.Named(paramName, val))
-			}
-			wheres = append(wheres, fmt.Sprintf("%s IN (%s)", fq.Name, strings.Join(inParamNames, ",")))
-
-			continue
-		}
-
-		//-- check if val is struct
-		paramName := fmt.Sprintf("p%03d", paramIdx)
-		paramIdx++
-
-		wheres = append(wheres, fmt.Sprintf("%s %s :%s", fq.Name, sqlComparator(fq.Comp), paramName))
-		var val any
-		if fq.Comp == query.ComparatorLike {
-			val = fmt.Sprintf("%%%v%%", fq.Value)
-		} else {
-			val = fq.Value
-		}
-
-		// check if val is struct
-		if reflect.TypeOf(val).Kind() == reflect.Struct {
-			sval, ok := tryMarshalString(val)
-			if !ok {
-				return nil, fmt.Errorf("cannot filter for struct %T which is not a stringer", val)
+	if len(q.Search.Fields) > 0 && q.Search.Value != "" {
+		for _, sf := range q.Search.Fields {
+			if !m.containsField(sf) {
+				return nil, fmt.Errorf("index %s contains no search field with name %q", m.Name, sf)
 			}
-			val = sval
 		}
-
-		args = append(args, sql.Named(paramName, val))
-	}
-	if len(q.Search.Fields) > 0 && q.Search.Value != "" {
 		searchWords := strings.Split(q.Search.Value, " ")
 		searchWords = slicesx.Map(searchWords, strings.TrimSpace)
-		//searchWords = slices.DeleteFunc( RemoveAll(searchWords, "")
 		searchWords = slices.DeleteFunc(searchWords, func(s string) bool { return s == "" })
 		searchWords = slicesx.Dedup(searchWords)
 
-		paramIdx := 0
-		var wordsSearchs []string
+		var wordsSearchs []sqlb.Cond
 		for _, word := range searchWords {
-			var fieldsSearchs []string
+			var fieldsSearchs []sqlb.Cond
 			for _, sf := range q.Search.Fields {
-				paramName := fmt.Sprintf("search%03d", paramIdx)
-				fieldsSearchs = append(fieldsSearchs, fmt.Sprintf("(%s like :%s)", sf, paramName))
-				args = append(args, sql.Named(paramName, fmt.Sprintf("%%%v%%", word)))
-				paramIdx++
+				fieldsSearchs = append(fieldsSearchs, sqlb.Contains(sf, word))
 			}
-			wordsSearchs = append(wordsSearchs, "("+strings.Join(fieldsSearchs, " OR ")+")")
+			wordsSearchs = append(wordsSearchs, sqlb.Or(fieldsSearchs...))
 		}
-		wheres = append(wheres, "("+strings.Join(wordsSearchs, " AND ")+")")
-	}
+		wheres = append(wheres, sqlb.And(wordsSearchs...))
+	}
+	// expired but not yet swept keys are not found
+	wheres = append(wheres, sqlb.NotExists(sqlb.SelectExpr("1").From("data").Where(
+		sqlb.Eq("data.bucket", m.Bucket),
+		sqlb.EqCol("data.key", m.TableName+".key"),
+		sqlb.Le("data.expires_at", expiryNow()),
+	)))
+	return wheres, nil
+}
 
-	orderBys := []string{}
-	for _, fs := range q.Sorts {
-		orderBys = append(orderBys, fmt.Sprintf("%s %s", fs.Name, fs.Order))
+func (im *SqliteXIndexManager) QueryKeys(bucketName string, indexName string, q query.Query) ([]string, error) {
+	ixkey := sqliteXIndexKey{bucketName: bucketName, indexName: indexName}
+	idxMeta, ok := im.indexes[ixkey]
+	if !ok {
+		return nil, fmt.Errorf("no such index: %s", ixkey)
 	}
 
-	args = append(args,
-		sql.Named("limit", q.LimitOffset.Limit),
-		sql.Named("offset", q.LimitOffset.Offset),
-	)
-	var where string
-	if len(wheres) > 0 {
-		where = " WHERE " + strings.Join(wheres, " AND ")
+	wheres, err := idxMeta.queryWheres(q)
+	if err != nil {
+		return nil, err
 	}
-	var orderBy string
-	if len(orderBys) > 0 {
-		orderBy = " ORDER BY " + strings.Join(orderBys, ", ")
+	b := sqlb.Select("key").From(idxMeta.TableName).Where(wheres...)
+	for _, fs := range q.Sorts {
+		if fs.Name != "key" && !idxMeta.containsField(fs.Name) {
+			return nil, fmt.Errorf("index %s contains no field with name %q", idxMeta.Name, fs.Name)
+		}
+		b.OrderBy(fs.Name, fs.Order)
+	}
+	stmt, args, err := b.Limit(q.LimitOffset.Limit, q.LimitOffset.Offset).Build()
+	if err != nil {
+		return nil, fmt.Errorf("build: %w", err)
 	}
-
-	stmt := fmt.Sprintf("SELECT key FROM %s %s %s LIMIT :limit OFFSET :offset;", idxMeta.TableName, where, orderBy)
 	rows, err := im.dbx.QueryContext(
 		context.TODO(),
 		stmt,
 		args...,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("query %q: %w", q, err)
+		return nil, fmt.Errorf("query %q: %w", stmt, err)
 	}
 	defer rows.Close()
 
@@ -0,0 +1,244 @@
+package blobix_v2
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/mazzegi/mbox/query"
+	"github.com/mazzegi/mbox/sqlb"
+)
+
+// pageCursor holds the sort values of the last row of a page
+type pageCursor struct {
+	Sorts  []string `json:"s"`
+	Values []any    `json:"v"`
+	Key    string   `json:"k"`
+}
+
+func encodePageCursor(c pageCursor) (string, error) {
+	bs, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("json.marshal: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(bs), nil
+}
+
+func decodePageCursor(s string) (pageCursor, error) {
+	bs, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("base64.decode: %w", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	dec.UseNumber()
+	var c pageCursor
+	err = dec.Decode(&c)
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("json.decode: %w", err)
+	}
+	for i, v := range c.Values {
+		var num json.Number
+		switch v := v.(type) {
+		case nil, string, bool:
+			continue
+		case json.Number:
+			num = v
+		default:
+			return pageCursor{}, fmt.Errorf("invalid cursor value of type %T", v)
+		}
+		if n, err := num.Int64(); err == nil {
+			c.Values[i] = n
+		} else if f, err := num.Float64(); err == nil {
+			c.Values[i] = f
+		} else {
+			return pageCursor{}, fmt.Errorf("invalid number %q", num)
+		}
+	}
+	return c, nil
+}
+
+type pageSort struct {
+	column string
+	desc   bool
+}
+
+func (ps pageSort) String() string {
+	if ps.desc {
+		return ps.column + ":" + string(query.SortDESC)
+	}
+	return ps.column + ":" + string(query.SortASC)
+}
+
+// pageSorts validates the sorts of q against the index and appends the key as tie breaker
+func (m sqliteXIndexMeta) pageSorts(sorts []query.Sort) ([]pageSort, error) {
+	var pss []pageSort
+	for _, s := range sorts {
+		if s.Name != "key" && !m.containsField(s.Name) {
+			return nil, fmt.Errorf("index %s contains no field with name %q", m.Name, s.Name)
+		}
+		var desc bool
+		switch s.Order {
+		case query.SortASC, query.SortNone, "":
+		case query.SortDESC:
+			desc = true
+		default:
+			return nil, fmt.Errorf("invalid sort order %q", s.Order)
+		}
+		pss = append(pss, pageSort{column: s.Name, desc: desc})
+		if s.Name == "key" {
+			return pss, nil
+		}
+	}
+	return append(pss, pageSort{column: "key"}), nil
+}
+
+// keysetWhere returns a condition which selects all rows after the cursor position
+func keysetWhere(pss []pageSort, vals []any) sqlb.Cond {
+	var ors []sqlb.Cond
+	for i, ps := range pss {
+		var ands []sqlb.Cond
+		for j := 0; j < i; j++ {
+			if vals[j] == nil {
+				ands = append(ands, sqlb.IsNull(pss[j].column))
+			} else {
+				ands = append(ands, sqlb.Eq(pss[j].column, vals[j]))
+			}
+		}
+		// NULLs sort first in ascending order
+		switch {
+		case !ps.desc && vals[i] == nil:
+			ands = append(ands, sqlb.NotNull(ps.column))
+		case !ps.desc:
+			ands = append(ands, sqlb.Gt(ps.column, vals[i]))
+		case vals[i] == nil:
+			// nothing comes after NULL in descending order
+			continue
+		default:
+			ands = append(ands, sqlb.Or(sqlb.Lt(ps.column, vals[i]), sqlb.IsNull(ps.column)))
+		}
+		ors = append(ors, sqlb.And(ands...))
+	}
+	if len(ors) == 0 {
+		return sqlb.False()
+	}
+	return sqlb.Or(ors...)
+}
+
+func (im *SqliteXIndexManager) QueryKeysPage(bucketName string, indexName string, q query.Query, page PageRequest) (QueryKeysResult, error) {
+	ixkey := sqliteXIndexKey{bucketName: bucketName, indexName: indexName}
+	idxMeta, ok := im.indexes[ixkey]
+	if !ok {
+		return QueryKeysResult{}, fmt.Errorf("no such index: %s", ixkey)
+	}
+	pss, err := idxMeta.pageSorts(q.Sorts)
+	if err != nil {
+		return QueryKeysResult{}, err
+	}
+	sortSig := make([]string, len(pss))
+	for i, ps := range pss {
+		sortSig[i] = ps.String()
+	}
+	wheres, err := idxMeta.queryWheres(q)
+	if err != nil {
+		return QueryKeysResult{}, err
+	}
+
+	var res QueryKeysResult
+	if page.WithTotal {
+		stmt, args, err := sqlb.SelectExpr("COUNT(*)").From(idxMeta.TableName).Where(wheres...).Build()
+		if err != nil {
+			return QueryKeysResult{}, fmt.Errorf("build: %w", err)
+		}
+		err = im.dbx.QueryRowContext(context.TODO(), stmt, args...).Scan(&res.Total)
+		if err != nil {
+			return QueryKeysResult{}, fmt.Errorf("query %q: %w", stmt, err)
+		}
+	}
+
+	offset := q.LimitOffset.Offset
+	if page.Cursor != "" {
+		cursor, err := decodePageCursor(page.Cursor)
+		if err != nil {
+			return QueryKeysResult{}, fmt.Errorf("invalid cursor: %w", err)
+		}
+		if !slices.Equal(cursor.Sorts, sortSig) || len(cursor.Values) != len(pss)-1 {
+			return QueryKeysResult{}, fmt.Errorf("cursor does not match the sort order of the query")
+		}
+		wheres = append(wheres, keysetWhere(pss, append(slices.Clone(cursor.Values), cursor.Key)))
+		offset = 0
+	}
+
+	cols := make([]string, len(pss))
+	for i, ps := range pss {
+		cols[i] = ps.column
+	}
+	b := sqlb.Select(cols...).From(idxMeta.TableName).Where(wheres...)
+	for _, ps := range pss {
+		if ps.desc {
+			b.OrderBy(ps.column, query.SortDESC)
+		} else {
+			b.OrderBy(ps.column, query.SortASC)
+		}
+	}
+	limit := q.LimitOffset.Limit
+	if limit <= 0 {
+		limit = -1
+	} else {
+		// fetch one more to find out if there is a next page
+		limit++
+	}
+	stmt, args, err := b.Limit(limit, offset).Build()
+	if err != nil {
+		return QueryKeysResult{}, fmt.Errorf("build: %w", err)
+	}
+	rows, err := im.dbx.QueryContext(context.TODO(), stmt, args...)
+	if err != nil {
+		return QueryKeysResult{}, fmt.Errorf("query %q: %w", stmt, err)
+	}
+	defer rows.Close()
+
+	res.Keys = []string{}
+	var last []any
+	vals := make([]any, len(cols))
+	ptrs := make([]any, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	for rows.Next() {
+		if q.LimitOffset.Limit > 0 && len(res.Keys) == q.LimitOffset.Limit {
+			cursor, err := encodePageCursor(pageCursor{
+				Sorts:  sortSig,
+				Values: last[:len(last)-1],
+				Key:    res.Keys[len(res.Keys)-1],
+			})
+			if err != nil {
+				return QueryKeysResult{}, fmt.Errorf("encode cursor: %w", err)
+			}
+			res.NextCursor = cursor
+			break
+		}
+		err = rows.Scan(ptrs...)
+		if err != nil {
+			return QueryKeysResult{}, fmt.Errorf("scan: %w", err)
+		}
+		last = make([]any, len(vals))
+		for i, v := range vals {
+			if bs, ok := v.([]byte); ok {
+				v = string(bs)
+			}
+			last[i] = v
+		}
+		key, ok := last[len(last)-1].(string)
+		if !ok {
+			return QueryKeysResult{}, fmt.Errorf("key of type %T is no string", last[len(last)-1])
+		}
+		res.Keys = append(res.Keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return QueryKeysResult{}, fmt.Errorf("rows: %w", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,24 @@
+package blobix_v2
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// onSave marks keys for running rebuilds and updates the path only indexes of bucket,
+// which are maintained by the store on every save
+func (im *SqliteXIndexManager) onSave(tx *sql.Tx, bucketName string, keys ...string) error {
+	im.markDirty(bucketName, keys...)
+	for idxKey, idxMeta := range im.indexes {
+		if idxKey.bucketName != bucketName || !pathOnly(idxMeta.Fields) {
+			continue
+		}
+		for _, key := range keys {
+			err := im.updateIndex(tx, bucketName, idxKey.indexName, key, nil)
+			if err != nil {
+				return fmt.Errorf("update-index %s: %w", idxKey, err)
+			}
+		}
+	}
+	return nil
+}
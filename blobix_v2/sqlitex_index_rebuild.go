@@ -0,0 +1,326 @@
+package blobix_v2
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mazzegi/log"
+	"github.com/mazzegi/mbox/sqlb"
+)
+
+type RebuildProgress struct {
+	// Processed is the number of keys written to the shadow table, including keys which were processed again
+	Processed int
+	// Total is the number of keys in the bucket when the rebuild started
+	Total int
+	// Pending is the number of keys changed during the rebuild which still need to be caught up on
+	Pending int
+}
+
+type RebuildOptions struct {
+	// BatchSize is the number of keys processed in one write transaction. Defaults to 500.
+	BatchSize int
+	// Progress is called after each batch
+	Progress func(RebuildProgress)
+}
+
+// IndexValuesFunc computes the index values of a stored entry. Path fields missing in the result are evaluated by the store.
+type IndexValuesFunc func(key string, e RawEntry) (map[string]any, error)
+
+// indexRebuild collects the keys which changed while an index is rebuilt
+type indexRebuild struct {
+	dirty map[string]struct{}
+}
+
+func (im *SqliteXIndexManager) startRebuild(idxKey sqliteXIndexKey) error {
+	im.rebuildMx.Lock()
+	defer im.rebuildMx.Unlock()
+	if _, ok := im.rebuilds[idxKey]; ok {
+		return fmt.Errorf("index %s is already being rebuilt", idxKey)
+	}
+	im.rebuilds[idxKey] = &indexRebuild{dirty: map[string]struct{}{}}
+	return nil
+}
+
+func (im *SqliteXIndexManager) stopRebuild(idxKey sqliteXIndexKey) {
+	im.rebuildMx.Lock()
+	defer im.rebuildMx.Unlock()
+	delete(im.rebuilds, idxKey)
+}
+
+// markDirty records keys of bucket for all running rebuilds of its indexes
+func (im *SqliteXIndexManager) markDirty(bucketName string, keys ...string) {
+	im.rebuildMx.Lock()
+	defer im.rebuildMx.Unlock()
+	for idxKey, rb := range im.rebuilds {
+		if idxKey.bucketName != bucketName {
+			continue
+		}
+		for _, key := range keys {
+			rb.dirty[key] = struct{}{}
+		}
+	}
+}
+
+// takeDirty removes up to max dirty keys and returns them along with the number of keys left
+func (im *SqliteXIndexManager) takeDirty(idxKey sqliteXIndexKey, max int) ([]string, int) {
+	im.rebuildMx.Lock()
+	defer im.rebuildMx.Unlock()
+	rb, ok := im.rebuilds[idxKey]
+	if !ok {
+		return nil, 0
+	}
+	var keys []string
+	for key := range rb.dirty {
+		if len(keys) >= max {
+			break
+		}
+		keys = append(keys, key)
+		delete(rb.dirty, key)
+	}
+	return keys, len(rb.dirty)
+}
+
+func (im *SqliteXIndexManager) numDirty(idxKey sqliteXIndexKey) int {
+	im.rebuildMx.Lock()
+	defer im.rebuildMx.Unlock()
+	if rb, ok := im.rebuilds[idxKey]; ok {
+		return len(rb.dirty)
+	}
+	return 0
+}
+
+// rebuildIndexOnline fills a shadow table of the index in batches, each in its own write transaction, so writers are
+// only blocked for a batch. Keys written meanwhile are caught up on, and the last catch up batch swaps the shadow table in.
+// A nil values func evaluates all fields by path.
+func (im *SqliteXIndexManager) rebuildIndexOnline(ctx context.Context, bucketName string, idxName string, values IndexValuesFunc, opts *RebuildOptions) error {
+	idxKey := sqliteXIndexKey{bucketName: bucketName, indexName: idxName}
+	idxMeta, ok := im.indexes[idxKey]
+	if !ok {
+		return fmt.Errorf("no such index: %s", idxKey)
+	}
+	if values == nil && !pathOnly(idxMeta.Fields) {
+		return fmt.Errorf("index %s has fields without path and needs a values func", idxKey)
+	}
+	batchSize := 500
+	var progress func(RebuildProgress)
+	if opts != nil {
+		if opts.BatchSize > 0 {
+			batchSize = opts.BatchSize
+		}
+		progress = opts.Progress
+	}
+
+	err := im.startRebuild(idxKey)
+	if err != nil {
+		return err
+	}
+	defer im.stopRebuild(idxKey)
+
+	shadow := idxMeta.TableName + "_shadow"
+	qshadow, err := sqlb.Ident(shadow)
+	if err != nil {
+		return err
+	}
+	err = im.createShadowTable(idxMeta, shadow)
+	if err != nil {
+		return fmt.Errorf("create-shadow-table: %w", err)
+	}
+	swapped := false
+	defer func() {
+		if swapped {
+			return
+		}
+		_, err := im.dbx.Exec(fmt.Sprintf("DROP TABLE IF EXISTS %s;", qshadow))
+		if err != nil {
+			log.Errorf("drop shadow table %q: %v", shadow, err)
+		}
+	}()
+
+	var prog RebuildProgress
+	err = im.dbx.QueryRow("SELECT COUNT(*) FROM data WHERE bucket = ?;", bucketName).Scan(&prog.Total)
+	if err != nil {
+		return fmt.Errorf("count: %w", err)
+	}
+	report := func(n int) {
+		prog.Processed += n
+		prog.Pending = im.numDirty(idxKey)
+		if progress != nil {
+			progress(prog)
+		}
+	}
+
+	// main pass in key order
+	lastKey := ""
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, last, err := im.rebuildBatch(idxMeta, shadow, values, lastKey, batchSize)
+		if err != nil {
+			return fmt.Errorf("rebuild-batch after %q: %w", lastKey, err)
+		}
+		report(n)
+		if n < batchSize {
+			break
+		}
+		lastKey = last
+	}
+
+	// catch up on keys written meanwhile
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, done, err := im.catchUpBatch(idxMeta, shadow, values, batchSize)
+		if err != nil {
+			return fmt.Errorf("catch-up-batch: %w", err)
+		}
+		if done {
+			swapped = true
+			report(n)
+			log.Debugf("rebuild-index %s: swapped in after %d keys", idxKey, prog.Processed)
+			return nil
+		}
+		report(n)
+	}
+}
+
+func (im *SqliteXIndexManager) createShadowTable(idxMeta sqliteXIndexMeta, shadow string) error {
+	qshadow, err := sqlb.Ident(shadow)
+	if err != nil {
+		return err
+	}
+	tx, err := im.dbx.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return fmt.Errorf("begin-tx: %w", err)
+	}
+	defer tx.Rollback()
+	_, err = tx.ExecContext(context.TODO(), fmt.Sprintf("DROP TABLE IF EXISTS %s;", qshadow))
+	if err != nil {
+		return fmt.Errorf("exec drop: %w", err)
+	}
+	err = createIndexTable(tx, shadow, idxMeta.Fields)
+	if err != nil {
+		return fmt.Errorf("exec create: %w", err)
+	}
+	return tx.Commit()
+}
+
+func shadowValues(values IndexValuesFunc, key string, e RawEntry) (map[string]any, error) {
+	if values == nil {
+		return nil, nil
+	}
+	return values(key, e)
+}
+
+func (im *SqliteXIndexManager) rebuildBatch(idxMeta sqliteXIndexMeta, shadow string, values IndexValuesFunc, afterKey string, limit int) (int, string, error) {
+	tx, err := im.dbx.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return 0, "", fmt.Errorf("begin-tx: %w", err)
+	}
+	defer tx.Rollback()
+	rows, err := tx.QueryContext(
+		context.TODO(),
+		"SELECT key, "+rawEntryColumns+" FROM data WHERE bucket = ? AND key > ? ORDER BY key ASC LIMIT ?;",
+		idxMeta.Bucket, afterKey, limit)
+	if err != nil {
+		return 0, "", fmt.Errorf("query: %w", err)
+	}
+	type keyEntry struct {
+		key   string
+		entry RawEntry
+	}
+	var kes []keyEntry
+	for rows.Next() {
+		var ke keyEntry
+		err = scanRawEntry(rows, &ke.entry, &ke.key)
+		if err != nil {
+			rows.Close()
+			return 0, "", fmt.Errorf("scan: %w", err)
+		}
+		kes = append(kes, ke)
+	}
+	rows.Close()
+	var lastKey string
+	for _, ke := range kes {
+		vals, err := shadowValues(values, ke.key, ke.entry)
+		if err != nil {
+			return 0, "", fmt.Errorf("values of %q: %w", ke.key, err)
+		}
+		err = updateIndexTable(tx, idxMeta, shadow, ke.key, vals)
+		if err != nil {
+			return 0, "", fmt.Errorf("update shadow for %q: %w", ke.key, err)
+		}
+		lastKey = ke.key
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, "", fmt.Errorf("commit: %w", err)
+	}
+	return len(kes), lastKey, nil
+}
+
+// catchUpBatch processes dirty keys. If none are left afterwards, the shadow table is swapped in within the same transaction,
+// which holds the only writer, so no write can slip through.
+func (im *SqliteXIndexManager) catchUpBatch(idxMeta sqliteXIndexMeta, shadow string, values IndexValuesFunc, limit int) (int, bool, error) {
+	qshadow, err := sqlb.Ident(shadow)
+	if err != nil {
+		return 0, false, err
+	}
+	qtab, err := sqlb.Ident(idxMeta.TableName)
+	if err != nil {
+		return 0, false, err
+	}
+	tx, err := im.dbx.BeginTx(context.TODO(), nil)
+	if err != nil {
+		return 0, false, fmt.Errorf("begin-tx: %w", err)
+	}
+	defer tx.Rollback()
+	keys, remaining := im.takeDirty(idxMeta.key(), limit)
+	for _, key := range keys {
+		var e RawEntry
+		row := tx.QueryRowContext(context.TODO(), "SELECT "+rawEntryColumns+" FROM data WHERE bucket = ? AND key = ?;", idxMeta.Bucket, key)
+		err := scanRawEntry(row, &e)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			_, err = tx.ExecContext(context.TODO(), fmt.Sprintf("DELETE FROM %s WHERE key = ?;", qshadow), key)
+			if err != nil {
+				return 0, false, fmt.Errorf("delete %q from shadow: %w", key, err)
+			}
+			continue
+		case err != nil:
+			return 0, false, fmt.Errorf("scan: %w", err)
+		}
+		vals, err := shadowValues(values, key, e)
+		if err != nil {
+			return 0, false, fmt.Errorf("values of %q: %w", key, err)
+		}
+		err = updateIndexTable(tx, idxMeta, shadow, key, vals)
+		if err != nil {
+			return 0, false, fmt.Errorf("update shadow for %q: %w", key, err)
+		}
+	}
+	done := remaining == 0
+	if done {
+		_, err = tx.ExecContext(context.TODO(), fmt.Sprintf("DROP TABLE %s;", qtab))
+		if err != nil {
+			return 0, false, fmt.Errorf("drop index table: %w", err)
+		}
+		_, err = tx.ExecContext(context.TODO(), fmt.Sprintf("ALTER TABLE %s RENAME TO %s;", qshadow, qtab))
+		if err != nil {
+			return 0, false, fmt.Errorf("rename shadow table: %w", err)
+		}
+		err = createIndexTableIndexes(tx, idxMeta)
+		if err != nil {
+			return 0, false, fmt.Errorf("create indexes: %w", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return 0, false, fmt.Errorf("commit: %w", err)
+	}
+	return len(keys), done, nil
+}
@@ -0,0 +1,30 @@
+package blobix_v2
+
+import (
+	"database/sql"
+
+	"github.com/mazzegi/mbox/sqlitex"
+)
+
+// sqlitexMigrations evolve the store schema. Released migrations must not be changed, add new ones instead.
+// The early ones are idempotent, as they also run on stores created before the schema was migrated.
+var sqlitexMigrations = []sqlitex.Migration{
+	{Version: 1, Name: "init", SQL: sqlitex_v1_init},
+	{Version: 2, Name: "data add expires_at", Func: addColumn("data", "expires_at", "INTEGER")},
+	{Version: 3, Name: "data add revision", Func: addColumn("data", "revision", "INTEGER NOT NULL DEFAULT 0")},
+	{Version: 4, Name: "history", SQL: sqlitex_history_init},
+	{Version: 5, Name: "data index expires_at", SQL: "CREATE INDEX IF NOT EXISTS ix_data_expires_at ON data (expires_at);"},
+	{Version: 6, Name: "data add encoding", Func: addColumn("data", "encoding", "TEXT NOT NULL DEFAULT ''")},
+	{Version: 7, Name: "history add encoding", Func: addColumn("history", "encoding", "TEXT NOT NULL DEFAULT ''")},
+	{Version: 8, Name: "compressed buckets", SQL: sqlitex_compression_init},
+	{Version: 9, Name: "blobs", SQL: sqlitex_blobs_init},
+	{Version: 10, Name: "history add expired", Func: addColumn("history", "expired", "INTEGER NOT NULL DEFAULT 0")},
+	// keys saved before revisions existed got revision 0, which means "doesn't exist"
+	{Version: 11, Name: "data backfill revision", SQL: "UPDATE data SET revision = 1 WHERE revision = 0;"},
+}
+
+func addColumn(table string, column string, decl string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		return sqlitex.AddColumnIfNotExists(tx, table, column, decl)
+	}
+}
@@ -0,0 +1,73 @@
+package blobix_v2
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/mazzegi/mbox/query"
+)
+
+const queryValueWithRevision = "SELECT value, revision, encoding FROM data WHERE " + notExpired + " AND bucket = ? AND key = ?;"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanValueWithRevision(row rowScanner) ([]byte, int64, query.Found, error) {
+	var value []byte
+	var revision int64
+	var encoding string
+	err := row.Scan(&value, &revision, &encoding)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, 0, false, nil
+	case err != nil:
+		return nil, 0, false, fmt.Errorf("scan: %w", err)
+	}
+	raw, err := decodeValue(value, encoding)
+	if err != nil {
+		return nil, 0, false, fmt.Errorf("decode: %w", err)
+	}
+	return raw, revision, true, nil
+}
+
+func (store *SqliteXStore) FindRawWithRevision(bucket string, key string) ([]byte, int64, query.Found, error) {
+	row := store.dbx.QueryRowContext(context.TODO(), queryValueWithRevision, expiryNow(), bucket, key)
+	return scanValueWithRevision(row)
+}
+
+// FindRawWithRevision reads key within the write transaction, so the result can't be changed by others until commit
+func (stx *sqliteXStoreTx) FindRawWithRevision(bucket string, key string) ([]byte, int64, query.Found, error) {
+	row := stx.tx.QueryRowContext(context.TODO(), queryValueWithRevision, expiryNow(), bucket, key)
+	return scanValueWithRevision(row)
+}
+
+// SaveRawIfRevision replaces only the value of key, its meta and expiry are kept
+func (stx *sqliteXStoreTx) SaveRawIfRevision(bucket string, key string, raw []byte, revision int64) error {
+	var current int64
+	var meta []byte
+	var expiresAt sql.NullInt64
+	err := stx.tx.QueryRowContext(context.TODO(),
+		"SELECT revision, meta, expires_at FROM data WHERE "+notExpired+" AND bucket = ? AND key = ?;",
+		expiryNow(), bucket, key).Scan(&current, &meta, &expiresAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("scan: %w", err)
+	}
+	if current != revision {
+		return fmt.Errorf("key %q has revision %d, want %d: %w", key, current, revision, ErrRevisionMismatch)
+	}
+	var exp *int64
+	if expiresAt.Valid {
+		exp = &expiresAt.Int64
+	}
+	if len(meta) == 0 {
+		meta = nil
+	}
+	err = stx.saveRawAt(bucket, key, raw, meta, modificationTime(), exp)
+	if err != nil {
+		return fmt.Errorf("save-raw: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package blobix_v2
+
+import (
+	"fmt"
+	"iter"
+	"strings"
+)
+
+// ScanRange restricts a scan to keys in [From, To) which start with Prefix. Empty bounds are open.
+type ScanRange struct {
+	From    string
+	To      string
+	Prefix  string
+	Reverse bool
+}
+
+// ScanPageSize is the number of keys a scan reads per query
+var ScanPageSize = 500
+
+// prefixEnd returns the smallest key greater than all keys starting with prefix or "" if there is none
+func prefixEnd(prefix string) string {
+	b := []byte(prefix)
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] < 0xff {
+			b[i]++
+			return string(b[:i+1])
+		}
+	}
+	return ""
+}
+
+// bounds returns the effective [lower, upper) bounds of r. Empty bounds are open.
+func (r ScanRange) bounds() (string, string) {
+	lower, upper := r.From, r.To
+	if r.Prefix > lower {
+		lower = r.Prefix
+	}
+	if pe := prefixEnd(r.Prefix); pe != "" && (upper == "" || pe < upper) {
+		upper = pe
+	}
+	return lower, upper
+}
+
+// scanPage returns up to limit keys of r after cursor in scan order. Values are nil if keysOnly is set.
+// Paging by key instead of offset keeps full scans linear.
+func (store *SqliteXStore) scanPage(bucket string, r ScanRange, cursor *string, limit int, keysOnly bool) ([]Tuple[string, []byte], error) {
+	conds := []string{notExpired, "bucket = ?"}
+	args := []any{expiryNow(), bucket}
+	lower, upper := r.bounds()
+	if lower != "" {
+		conds = append(conds, "key >= ?")
+		args = append(args, lower)
+	}
+	if upper != "" {
+		conds = append(conds, "key < ?")
+		args = append(args, upper)
+	}
+	order := "ASC"
+	if r.Reverse {
+		order = "DESC"
+	}
+	if cursor != nil {
+		if r.Reverse {
+			conds = append(conds, "key < ?")
+		} else {
+			conds = append(conds, "key > ?")
+		}
+		args = append(args, *cursor)
+	}
+	cols := "value, encoding"
+	if keysOnly {
+		cols = "NULL, ''"
+	}
+	args = append(args, limit)
+	rows, err := store.dbx.Query(
+		fmt.Sprintf("SELECT key, %s FROM data WHERE %s ORDER BY key %s LIMIT ?;", cols, strings.Join(conds, " AND "), order),
+		args...)
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	var kvs []Tuple[string, []byte]
+	for rows.Next() {
+		var kv Tuple[string, []byte]
+		var value []byte
+		var encoding string
+		err = rows.Scan(&kv.Key, &value, &encoding)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		if !keysOnly {
+			kv.Value, err = decodeValue(value, encoding)
+			if err != nil {
+				return nil, fmt.Errorf("decode %q: %w", kv.Key, err)
+			}
+		}
+		kvs = append(kvs, kv)
+	}
+	return kvs, rows.Err()
+}
+
+func (store *SqliteXStore) scan(bucket string, r ScanRange, keysOnly bool) iter.Seq2[Tuple[string, []byte], error] {
+	return func(yield func(Tuple[string, []byte], error) bool) {
+		var cursor *string
+		for {
+			kvs, err := store.scanPage(bucket, r, cursor, ScanPageSize, keysOnly)
+			if err != nil {
+				yield(Tuple[string, []byte]{}, fmt.Errorf("scan-page: %w", err))
+				return
+			}
+			for _, kv := range kvs {
+				if !yield(kv, nil) {
+					return
+				}
+			}
+			if len(kvs) < ScanPageSize {
+				return
+			}
+			cursor = &kvs[len(kvs)-1].Key
+		}
+	}
+}
+
+func (store *SqliteXStore) ScanRaw(bucket string, r ScanRange) iter.Seq2[Tuple[string, []byte], error] {
+	return store.scan(bucket, r, false)
+}
+
+func (store *SqliteXStore) ScanKeys(bucket string, r ScanRange) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		for kv, err := range store.scan(bucket, r, true) {
+			if !yield(kv.Key, err) || err != nil {
+				return
+			}
+		}
+	}
+}
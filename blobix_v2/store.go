@@ -1,27 +1,96 @@
 package blobix_v2
 
-import "github.com/mazzegi/mbox/query"
+import (
+	"context"
+	"io"
+	"iter"
+	"time"
 
-type Tx interface {
-	Rollback() error
-	Commit() error
+	"github.com/mazzegi/mbox/query"
+)
+
+type RawEntry struct {
+	Value      []byte
+	Meta       []byte
+	ModifiedOn time.Time
+	Revision   int64
+}
+
+// TypedTx is the part of Tx which typed buckets write through in Store.Update
+type TypedTx interface {
 	SaveRaw(bucket string, key string, raw []byte) error
+	SaveRawWithTTL(bucket string, key string, raw []byte, ttl time.Duration) error
+	SaveRawWithMeta(bucket string, key string, raw []byte, meta []byte) error
 	SaveRawMany(bucket string, kvs []Tuple[string, []byte]) error
+	// SaveRawIfRevision saves raw only if the current revision of key is revision, otherwise it returns ErrRevisionMismatch.
+	// Revision 0 means the key must not exist. The meta and expiry of key are kept.
+	SaveRawIfRevision(bucket string, key string, raw []byte, revision int64) error
+	FindRawWithRevision(bucket string, key string) ([]byte, int64, query.Found, error)
+	FindRawEntry(bucket string, key string) (RawEntry, query.Found, error)
 	Delete(bucket string, keys ...string) error
 	UpdateIndex(bucketName string, idxName string, key string, values map[string]any) error
+	// WriteBlob replaces the binary payload attached to key with the content of r. It returns ErrKeyNotFound if key doesn't exist.
+	WriteBlob(bucket string, key string, r io.Reader) (int64, error)
+	// FindHistoryEntry returns the version of key at revision from the history. Revision 0 returns the newest one.
+	FindHistoryEntry(bucket string, key string, revision int64) (HistoryEntry, query.Found, error)
+}
+type Tx interface {
+	TypedTx
+	Rollback() error
+	Commit() error
 }
 type Store interface {
 	BeginTx() (Tx, error)
+	// Update runs fn in one transaction, which is committed if fn returns nil and rolled back otherwise.
+	// The store has a single writer connection, which fn holds until it returns. So fn must write through tx only,
+	// e.g. with Bucket.SaveTx. Calling a writing method like Bucket.Save or Store.Update within fn blocks forever.
+	Update(fn func(tx TypedTx) error) error
 	FindRaw(bucket string, key string) ([]byte, query.Found, error)
 	FindRawMany(bucket string, keys ...string) (map[string][]byte, error)
+	// FindRawWithRevision returns the value of key along with its revision, which is incremented on every save
+	FindRawWithRevision(bucket string, key string) ([]byte, int64, query.Found, error)
+	// FindRawEntry returns the value of key along with meta, modification time and revision
+	FindRawEntry(bucket string, key string) (RawEntry, query.Found, error)
+	FindRawEntries(bucket string, keys ...string) (map[string]RawEntry, error)
 	Keys(bucket string) ([]string, error)
 	KeysPage(bucket string, skip, limit int, sort query.SortOrder) ([]string, error)
+	// KeysWithPrefixPage returns all keys if limit is negative
+	KeysWithPrefixPage(bucket string, prefix string, skip, limit int, sort query.SortOrder) ([]string, error)
+	// ScanRaw iterates keys and values in r in key order, paging by key
+	ScanRaw(bucket string, r ScanRange) iter.Seq2[Tuple[string, []byte], error]
+	ScanKeys(bucket string, r ScanRange) iter.Seq2[string, error]
 
 	// Index stuff
 	FindIndexDescriptor(bucketName string, idxName string) (IndexDescriptor, bool)
+	IndexDescriptors(bucketName string) []IndexDescriptor
 	CreateIndex(bucketName string, idxName string, fields []IndexFieldDescriptor) error
 	DeleteIndex(bucketName string, idxName string) error
+	// RebuildIndex refills an index whose fields all have a path from the stored values
+	RebuildIndex(bucketName string, idxName string) error
+	// RebuildIndexOnline rebuilds an index in batches into a shadow table, which is swapped in when done
+	RebuildIndexOnline(ctx context.Context, bucketName string, idxName string, values IndexValuesFunc, opts *RebuildOptions) error
+
+	// Blobs are binary payloads attached to keys, which are streamed in chunks.
+	// WriteBlob holds the single writer until r is drained, so r should be a local file or buffer, not a slow network stream.
+	WriteBlob(bucket string, key string, r io.Reader) (int64, error)
+	OpenBlob(bucket string, key string) (io.ReadCloser, query.Found, error)
+	ReadBlob(bucket string, key string, w io.Writer) (int64, query.Found, error)
+
+	// Compression applies to values saved after it was enabled
+	EnableCompression(bucket string, c Compression) error
+	DisableCompression(bucket string) error
+
+	// History keeps prior versions of keys in buckets with history enabled
+	EnableHistory(bucket string, maxVersions int) error
+	DisableHistory(bucket string) error
+	History(bucket string, key string) ([]HistoryEntry, error)
+
+	// Watch emits changes of keys in bucket starting with keyPrefix after they were committed.
+	// Events which don't fit into the buffer are dropped, see Watcher.Dropped.
+	Watch(ctx context.Context, bucket string, keyPrefix string, opts *WatchOptions) *Watcher
 
 	// query
 	QueryKeys(bucketName string, indexName string, q query.Query) ([]string, error)
+	QueryKeysPage(bucketName string, indexName string, q query.Query, page PageRequest) (QueryKeysResult, error)
+	QueryDistinct(bucketName string, indexName string, field string) ([]string, error)
 }
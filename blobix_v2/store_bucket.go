@@ -1,12 +1,15 @@
 package blobix_v2
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"iter"
+	"time"
 
 	"github.com/mazzegi/log"
 	"github.com/mazzegi/mbox/query"
+	"github.com/mazzegi/mbox/slicesx"
 )
 
 type BucketIndex[T any] struct {
@@ -14,24 +17,51 @@ type BucketIndex[T any] struct {
 	Fields    []IndexField[T]
 }
 
+func (idx BucketIndex[T]) pathOnly() bool {
+	return pathOnly(slicesx.Map(idx.Fields, func(f IndexField[T]) IndexFieldDescriptor { return f.Descriptor }))
+}
+
+// metaIndex is an index over value and meta, with the meta type erased
+type metaIndex[T any] struct {
+	IndexName string
+	Values    func(t T, meta []byte) (map[string]any, error)
+}
+
+func (idx metaIndex[T]) valuesFunc() IndexValuesFunc {
+	return func(key string, e RawEntry) (map[string]any, error) {
+		var t T
+		err := json.Unmarshal(e.Value, &t)
+		if err != nil {
+			return nil, fmt.Errorf("json.unmarshal: %w", err)
+		}
+		return idx.Values(t, e.Meta)
+	}
+}
+
 // Typed Bucket funcs
 func NewBucket[T any](store Store, name string) *Bucket[T] {
 	return &Bucket[T]{
-		name:    name,
-		store:   store,
-		indexes: make(map[string]BucketIndex[T]),
+		name:        name,
+		store:       store,
+		indexes:     make(map[string]BucketIndex[T]),
+		metaIndexes: make(map[string]metaIndex[T]),
 	}
 }
 
 type Bucket[T any] struct {
-	name    string
-	store   Store
-	indexes map[string]BucketIndex[T]
+	name        string
+	store       Store
+	indexes     map[string]BucketIndex[T]
+	metaIndexes map[string]metaIndex[T]
 }
 
 func indexValues[T any](fields []IndexField[T], t T) map[string]any {
 	values := map[string]any{}
 	for _, field := range fields {
+		if field.ValueFunc == nil {
+			// path fields are evaluated by the store
+			continue
+		}
 		val := field.ValueFunc(t)
 		values[field.Descriptor.Name] = val
 	}
@@ -39,87 +69,62 @@ func indexValues[T any](fields []IndexField[T], t T) map[string]any {
 }
 
 func (b *Bucket[T]) Save(key string, t T) error {
-	raw, err := json.Marshal(t)
-	if err != nil {
-		return fmt.Errorf("json.marshal: %w", err)
-	}
-	tx, err := b.store.BeginTx()
-	if err != nil {
-		return fmt.Errorf("begin-tx: %w", err)
-	}
-	err = tx.SaveRaw(b.name, key, raw)
-	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("save-raw: %w", err)
+	return b.save(key, t, 0)
+}
+
+// SaveWithTTL saves t which is treated as not found after ttl and deleted by the sweeper
+func (b *Bucket[T]) SaveWithTTL(key string, t T, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("ttl must be positive")
 	}
+	return b.save(key, t, ttl)
+}
+
+func (b *Bucket[T]) save(key string, t T, ttl time.Duration) error {
+	return b.store.Update(func(tx TypedTx) error {
+		return b.saveTx(tx, key, t, ttl)
+	})
+}
+
+func (b *Bucket[T]) updateIndexes(tx TypedTx, key string, t T, meta []byte) error {
 	for _, idx := range b.indexes {
+		if idx.pathOnly() {
+			// maintained by the store
+			continue
+		}
 		values := indexValues(idx.Fields, t)
 		err := tx.UpdateIndex(b.name, idx.IndexName, key, values)
 		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("update-index: %w", err)
+			return fmt.Errorf("update-index %q: %w", idx.IndexName, err)
 		}
 	}
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("commit: %w", err)
-	}
-	return nil
-}
-
-func (b *Bucket[T]) SaveMany(kvs []Tuple[string, T]) error {
-	rawKVs := make([]Tuple[string, []byte], len(kvs))
-	for i, kvv := range kvs {
-		raw, err := json.Marshal(kvv.Value)
+	for _, idx := range b.metaIndexes {
+		values, err := idx.Values(t, meta)
 		if err != nil {
-			return fmt.Errorf("json.marshal: %w", err)
+			return fmt.Errorf("meta-index-values %q: %w", idx.IndexName, err)
 		}
-		rawKVs[i] = MkTuple(kvv.Key, raw)
-	}
-
-	tx, err := b.store.BeginTx()
-	if err != nil {
-		return fmt.Errorf("begin-tx: %w", err)
-	}
-	err = tx.SaveRawMany(b.name, rawKVs)
-	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("save-raw: %w", err)
-	}
-	// indexes
-	for _, kvv := range kvs {
-		for _, idx := range b.indexes {
-			values := indexValues(idx.Fields, kvv.Value)
-			err := tx.UpdateIndex(b.name, idx.IndexName, kvv.Key, values)
-			if err != nil {
-				tx.Rollback()
-				return fmt.Errorf("update-index: %w", err)
-			}
+		err = tx.UpdateIndex(b.name, idx.IndexName, key, values)
+		if err != nil {
+			return fmt.Errorf("update-index %q: %w", idx.IndexName, err)
 		}
 	}
-
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("commit: %w", err)
-	}
 	return nil
 }
 
+func (b *Bucket[T]) SaveMany(kvs []Tuple[string, T]) error {
+	return b.store.Update(func(tx TypedTx) error {
+		return b.SaveManyTx(tx, kvs)
+	})
+}
+
 func (b *Bucket[T]) Delete(keys ...string) error {
-	tx, err := b.store.BeginTx()
-	if err != nil {
-		return fmt.Errorf("begin-tx: %w", err)
-	}
-	err = tx.Delete(b.name, keys...)
-	if err != nil {
-		tx.Rollback()
-		return fmt.Errorf("delete: %w", err)
-	}
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("commit: %w", err)
-	}
-	return nil
+	return b.store.Update(func(tx TypedTx) error {
+		return b.DeleteTx(tx, keys...)
+	})
+}
+
+func (b *Bucket[T]) Watch(ctx context.Context, keyPrefix string, opts *WatchOptions) *Watcher {
+	return b.store.Watch(ctx, b.name, keyPrefix, opts)
 }
 
 func (b *Bucket[T]) Find(key string) (T, query.Found, error) {
@@ -256,25 +261,26 @@ func ValuesTyped[DESTTYPE any](store Store, bucketName string, keys ...string) (
 }
 
 func (b *Bucket[T]) IterKeys() iter.Seq2[string, error] {
-	return func(yield func(string, error) bool) {
-		skip := 0
-		pageLimit := 50
-		for {
-			ks, err := b.store.KeysPage(b.name, skip, pageLimit, query.SortASC)
+	return b.store.ScanKeys(b.name, ScanRange{})
+}
+
+// Scan iterates keys and values in r in key order. Iteration stops after the first error.
+func (b *Bucket[T]) Scan(r ScanRange) iter.Seq2[Tuple[string, T], error] {
+	return func(yield func(Tuple[string, T], error) bool) {
+		for kv, err := range b.store.ScanRaw(b.name, r) {
 			if err != nil {
-				yield("", fmt.Errorf("keys-page: %w", err))
+				yield(Tuple[string, T]{}, fmt.Errorf("scan-raw: %w", err))
 				return
 			}
-			for _, k := range ks {
-				ok := yield(k, nil)
-				if !ok {
-					return
-				}
+			var t T
+			err = json.Unmarshal(kv.Value, &t)
+			if err != nil {
+				yield(Tuple[string, T]{}, fmt.Errorf("json.unmarshal %q: %w", kv.Key, err))
+				return
 			}
-			if len(ks) < pageLimit {
+			if !yield(MkTuple(kv.Key, t), nil) {
 				return
 			}
-			skip += pageLimit
 		}
 	}
 }
@@ -0,0 +1,33 @@
+package blobix_v2
+
+import (
+	"io"
+
+	"github.com/mazzegi/mbox/query"
+)
+
+// WriteBlob attaches the content of r to key, e.g. the file described by the value of key.
+// Other writes of the store wait until r is drained.
+func (b *Bucket[T]) WriteBlob(key string, r io.Reader) (int64, error) {
+	return b.store.WriteBlob(b.name, key, r)
+}
+
+func (b *Bucket[T]) WriteBlobTx(tx TypedTx, key string, r io.Reader) (int64, error) {
+	return tx.WriteBlob(b.name, key, r)
+}
+
+func (b *Bucket[T]) OpenBlob(key string) (io.ReadCloser, query.Found, error) {
+	return b.store.OpenBlob(b.name, key)
+}
+
+func (b *Bucket[T]) ReadBlob(key string, w io.Writer) (int64, query.Found, error) {
+	return b.store.ReadBlob(b.name, key, w)
+}
+
+func (b *Bucket[T]) EnableCompression(c Compression) error {
+	return b.store.EnableCompression(b.name, c)
+}
+
+func (b *Bucket[T]) DisableCompression() error {
+	return b.store.DisableCompression(b.name)
+}
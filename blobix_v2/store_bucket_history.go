@@ -0,0 +1,111 @@
+package blobix_v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// HistoryEntry is a prior version of a key. Deleted is set if the key was deleted at this version,
+// Expired is set additionally if it was deleted by the expiry sweeper.
+type HistoryEntry struct {
+	Revision   int64
+	ModifiedOn time.Time
+	Meta       []byte
+	Value      []byte
+	Deleted    bool
+	Expired    bool
+}
+
+type Version[T any] struct {
+	Revision   int64
+	ModifiedOn time.Time
+	Deleted    bool
+	Expired    bool
+	Value      T
+}
+
+func (b *Bucket[T]) EnableHistory(maxVersions int) error {
+	return b.store.EnableHistory(b.name, maxVersions)
+}
+
+func (b *Bucket[T]) DisableHistory() error {
+	return b.store.DisableHistory(b.name)
+}
+
+// History returns the prior versions of key, newest first
+func (b *Bucket[T]) History(key string) ([]Version[T], error) {
+	hes, err := b.store.History(b.name, key)
+	if err != nil {
+		return nil, fmt.Errorf("store.history: %w", err)
+	}
+	vs := make([]Version[T], len(hes))
+	for i, he := range hes {
+		vs[i] = Version[T]{
+			Revision:   he.Revision,
+			ModifiedOn: he.ModifiedOn,
+			Deleted:    he.Deleted,
+			Expired:    he.Expired,
+		}
+		err := json.Unmarshal(he.Value, &vs[i].Value)
+		if err != nil {
+			return nil, fmt.Errorf("json.unmarshal revision %d: %w", he.Revision, err)
+		}
+	}
+	return vs, nil
+}
+
+// Restore saves the value and meta of key at revision from the history as a new version
+func (b *Bucket[T]) Restore(key string, revision int64) error {
+	if revision <= 0 {
+		return fmt.Errorf("revision must be positive")
+	}
+	return b.store.Update(func(tx TypedTx) error {
+		he, found, err := tx.FindHistoryEntry(b.name, key, revision)
+		if err != nil {
+			return fmt.Errorf("find-history-entry: %w", err)
+		}
+		if !found {
+			return fmt.Errorf("revision %d of key %q not found in history", revision, key)
+		}
+		return b.restoreTx(tx, key, he)
+	})
+}
+
+// Undelete restores the value and meta of the last version of a deleted key
+func (b *Bucket[T]) Undelete(key string) error {
+	return b.store.Update(func(tx TypedTx) error {
+		_, _, found, err := tx.FindRawWithRevision(b.name, key)
+		if err != nil {
+			return fmt.Errorf("find-raw-with-revision: %w", err)
+		}
+		if found {
+			return fmt.Errorf("key %q is not deleted", key)
+		}
+		he, found, err := tx.FindHistoryEntry(b.name, key, 0)
+		if err != nil {
+			return fmt.Errorf("find-history-entry: %w", err)
+		}
+		if !bool(found) || !he.Deleted {
+			return fmt.Errorf("key %q is not deleted", key)
+		}
+		return b.restoreTx(tx, key, he)
+	})
+}
+
+func (b *Bucket[T]) restoreTx(tx TypedTx, key string, he HistoryEntry) error {
+	var t T
+	err := json.Unmarshal(he.Value, &t)
+	if err != nil {
+		return fmt.Errorf("json.unmarshal revision %d: %w", he.Revision, err)
+	}
+	err = tx.SaveRawWithMeta(b.name, key, he.Value, he.Meta)
+	if err != nil {
+		return fmt.Errorf("save-raw-with-meta: %w", err)
+	}
+	err = b.updateIndexes(tx, key, t, he.Meta)
+	if err != nil {
+		return fmt.Errorf("update-indexes: %w", err)
+	}
+	return nil
+}
@@ -1,94 +1,81 @@
 package blobix_v2
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 
-	"github.com/mazzegi/log"
 	"github.com/mazzegi/mbox/slicesx"
 )
 
 func (b Bucket[T]) AddOrUpdateIndex(idxName string, fields ...IndexField[T]) error {
 	fieldDescs := slicesx.Map(fields, func(field IndexField[T]) IndexFieldDescriptor { return field.Descriptor })
+	err := b.ensureIndex(idxName, fieldDescs, func() error {
+		return b.updateAllIndexValues(idxName, fields...)
+	})
+	if err != nil {
+		return err
+	}
+	delete(b.metaIndexes, idxName)
+	b.indexes[idxName] = BucketIndex[T]{
+		IndexName: idxName,
+		Fields:    fields,
+	}
+	return nil
+}
 
+// ensureIndex creates the index if it doesn't exist or drops and re-creates it, if its fields changed.
+// In both cases the index is filled by rebuild.
+func (b Bucket[T]) ensureIndex(idxName string, fieldDescs []IndexFieldDescriptor, rebuild func() error) error {
 	existingIdx, ok := b.store.FindIndexDescriptor(b.name, idxName)
-	if !ok {
-		err := b.store.CreateIndex(b.name, idxName, fieldDescs)
-		if err != nil {
-			return fmt.Errorf("store.create-index %q: %w", idxName, err)
-		}
-		err = b.updateAllIndexValues(idxName, fields...)
-		if err != nil {
-			return fmt.Errorf("pupdate-all-index-values: %w", err)
+	if ok {
+		newIdx := IndexDescriptor{
+			BucketName: b.name,
+			IndexName:  idxName,
+			Fields:     fieldDescs,
 		}
-		b.indexes[idxName] = BucketIndex[T]{
-			IndexName: idxName,
-			Fields:    fields,
+		if IndexDescriptorsEqual(existingIdx, newIdx) {
+			return nil
 		}
-		return nil
-	}
-	newIdx := IndexDescriptor{
-		BucketName: b.name,
-		IndexName:  idxName,
-		Fields:     fieldDescs,
-	}
-	if IndexDescriptorsEqual(existingIdx, newIdx) {
-		b.indexes[idxName] = BucketIndex[T]{
-			IndexName: idxName,
-			Fields:    fields,
+		// ok - something changed - drop existing, create new, rebuild
+		err := b.store.DeleteIndex(b.name, idxName)
+		if err != nil {
+			return fmt.Errorf("store.delete-index %q: %w", idxName, err)
 		}
-		return nil
-	}
-	// ok - something changed - drop existing, create new, rebuild
-	err := b.store.DeleteIndex(b.name, idxName)
-	if err != nil {
-		return fmt.Errorf("store.delete-index %q: %w", idxName, err)
 	}
-	err = b.store.CreateIndex(b.name, idxName, fieldDescs)
+	err := b.store.CreateIndex(b.name, idxName, fieldDescs)
 	if err != nil {
 		return fmt.Errorf("store.create-index %q: %w", idxName, err)
 	}
-	b.indexes[idxName] = BucketIndex[T]{
-		IndexName: idxName,
-		Fields:    fields,
-	}
-	// ... and rebuild
-	err = b.updateAllIndexValues(idxName, fields...)
+	err = rebuild()
 	if err != nil {
 		return fmt.Errorf("pupdate-all-index-values: %w", err)
 	}
-
 	return nil
 }
 
 func (b Bucket[T]) updateAllIndexValues(idxName string, fields ...IndexField[T]) error {
-	tx, err := b.store.BeginTx()
-	if err != nil {
-		return fmt.Errorf("begin-tx: %w", err)
-	}
-	for kp := range StreamKeys(b.store, b.name, 500) {
-		if kp.Error != nil {
-			tx.Rollback()
-			return fmt.Errorf("stream-keys: %w", kp.Error)
-		}
-		kvs, err := b.KeyValues(kp.Keys...)
+	return b.store.RebuildIndexOnline(context.Background(), b.name, idxName, bucketIndexValuesFunc(fields), nil)
+}
+
+func bucketIndexValuesFunc[T any](fields []IndexField[T]) IndexValuesFunc {
+	return func(key string, e RawEntry) (map[string]any, error) {
+		var t T
+		err := json.Unmarshal(e.Value, &t)
 		if err != nil {
-			tx.Rollback()
-			return fmt.Errorf("key-values: %w", err)
+			return nil, fmt.Errorf("json.unmarshal: %w", err)
 		}
+		return indexValues(fields, t), nil
+	}
+}
 
-		log.Debugf("rebuild-index: page %d (%d keys)", kp.Idx+1, len(kp.Keys))
-		for key, val := range kvs {
-			values := indexValues(fields, val)
-			err = tx.UpdateIndex(b.name, idxName, key, values)
-			if err != nil {
-				tx.Rollback()
-				return fmt.Errorf("update-index for key %q: %w", key, err)
-			}
-		}
+// RebuildIndex rebuilds an index of the bucket in batches while writers may continue, see Store.RebuildIndexOnline
+func (b Bucket[T]) RebuildIndex(ctx context.Context, idxName string, opts *RebuildOptions) error {
+	if idx, ok := b.indexes[idxName]; ok {
+		return b.store.RebuildIndexOnline(ctx, b.name, idxName, bucketIndexValuesFunc(idx.Fields), opts)
 	}
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("commit: %w", err)
+	if idx, ok := b.metaIndexes[idxName]; ok {
+		return b.store.RebuildIndexOnline(ctx, b.name, idxName, idx.valuesFunc(), opts)
 	}
-	return nil
+	return fmt.Errorf("no index %q in bucket %q", idxName, b.name)
 }
@@ -0,0 +1,154 @@
+package blobix_v2
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mazzegi/mbox/query"
+	"github.com/mazzegi/mbox/slicesx"
+)
+
+// ValueMeta is what meta index fields are evaluated on
+type ValueMeta[T any, M any] struct {
+	Value T
+	Meta  M
+}
+
+type MetaEntry[T any, M any] struct {
+	Value      T
+	Meta       M
+	ModifiedOn time.Time
+	Revision   int64
+}
+
+// MetaBucket is a Bucket with typed meta data stored alongside each value.
+// Saving through the plain Bucket funcs stores no meta, which reads as the zero M.
+type MetaBucket[T any, M any] struct {
+	*Bucket[T]
+}
+
+func NewMetaBucket[T any, M any](store Store, name string) *MetaBucket[T, M] {
+	return &MetaBucket[T, M]{
+		Bucket: NewBucket[T](store, name),
+	}
+}
+
+func decodeMeta[M any](raw []byte) (M, error) {
+	var m M
+	if len(raw) == 0 {
+		return m, nil
+	}
+	err := json.Unmarshal(raw, &m)
+	if err != nil {
+		return m, fmt.Errorf("json.unmarshal meta: %w", err)
+	}
+	return m, nil
+}
+
+func (b *MetaBucket[T, M]) SaveWithMeta(key string, t T, m M) error {
+	return b.store.Update(func(tx TypedTx) error {
+		return b.SaveWithMetaTx(tx, key, t, m)
+	})
+}
+
+func (b *MetaBucket[T, M]) SaveWithMetaTx(tx TypedTx, key string, t T, m M) error {
+	raw, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("json.marshal: %w", err)
+	}
+	meta, err := json.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("json.marshal meta: %w", err)
+	}
+	err = tx.SaveRawWithMeta(b.name, key, raw, meta)
+	if err != nil {
+		return fmt.Errorf("save-raw-with-meta: %w", err)
+	}
+	err = b.updateIndexes(tx, key, t, meta)
+	if err != nil {
+		return fmt.Errorf("update-indexes: %w", err)
+	}
+	return nil
+}
+
+func (b *MetaBucket[T, M]) FindWithMeta(key string) (MetaEntry[T, M], query.Found, error) {
+	re, found, err := b.store.FindRawEntry(b.name, key)
+	if err != nil {
+		return MetaEntry[T, M]{}, false, fmt.Errorf("find-raw-entry: %w", err)
+	}
+	if !found {
+		return MetaEntry[T, M]{}, false, nil
+	}
+	e, err := decodeMetaEntry[T, M](re)
+	if err != nil {
+		return MetaEntry[T, M]{}, false, err
+	}
+	return e, true, nil
+}
+
+func decodeMetaEntry[T any, M any](re RawEntry) (MetaEntry[T, M], error) {
+	e := MetaEntry[T, M]{
+		ModifiedOn: re.ModifiedOn,
+		Revision:   re.Revision,
+	}
+	err := json.Unmarshal(re.Value, &e.Value)
+	if err != nil {
+		return e, fmt.Errorf("json.unmarshal: %w", err)
+	}
+	e.Meta, err = decodeMeta[M](re.Meta)
+	if err != nil {
+		return e, err
+	}
+	return e, nil
+}
+
+// QueryWithMeta returns the entries of the keys found by q on the index indexName
+func (b *MetaBucket[T, M]) QueryWithMeta(indexName string, q query.Query) ([]MetaEntry[T, M], error) {
+	keys, err := b.store.QueryKeys(b.name, indexName, q)
+	if err != nil {
+		return nil, fmt.Errorf("store.query-keys: %w", err)
+	}
+	res, err := b.store.FindRawEntries(b.name, keys...)
+	if err != nil {
+		return nil, fmt.Errorf("find-raw-entries: %w", err)
+	}
+	var es []MetaEntry[T, M]
+	for _, key := range keys {
+		re, ok := res[key]
+		if !ok {
+			continue
+		}
+		e, err := decodeMetaEntry[T, M](re)
+		if err != nil {
+			return nil, fmt.Errorf("decode %q: %w", key, err)
+		}
+		es = append(es, e)
+	}
+	return es, nil
+}
+
+// AddOrUpdateMetaIndex adds an index whose fields may be evaluated on value and meta
+func (b *MetaBucket[T, M]) AddOrUpdateMetaIndex(idxName string, fields ...IndexField[ValueMeta[T, M]]) error {
+	fieldDescs := slicesx.Map(fields, func(field IndexField[ValueMeta[T, M]]) IndexFieldDescriptor { return field.Descriptor })
+	idx := metaIndex[T]{
+		IndexName: idxName,
+		Values: func(t T, meta []byte) (map[string]any, error) {
+			m, err := decodeMeta[M](meta)
+			if err != nil {
+				return nil, err
+			}
+			return indexValues(fields, ValueMeta[T, M]{Value: t, Meta: m}), nil
+		},
+	}
+	err := b.ensureIndex(idxName, fieldDescs, func() error {
+		return b.store.RebuildIndexOnline(context.Background(), b.name, idxName, idx.valuesFunc(), nil)
+	})
+	if err != nil {
+		return err
+	}
+	delete(b.indexes, idxName)
+	b.metaIndexes[idxName] = idx
+	return nil
+}
@@ -0,0 +1,89 @@
+package blobix_v2
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/mazzegi/mbox/query"
+)
+
+// UpdateMaxAttempts is the number of attempts Update makes before giving up on conflicting writes
+var UpdateMaxAttempts = 10
+
+// FindWithRevision returns the value of key and its revision. The revision of a non existing key is 0.
+func (b *Bucket[T]) FindWithRevision(key string) (T, int64, query.Found, error) {
+	var t T
+	raw, rev, found, err := b.store.FindRawWithRevision(b.name, key)
+	if err != nil {
+		return t, 0, false, fmt.Errorf("find-raw-with-revision: %w", err)
+	}
+	if !found {
+		return t, 0, false, nil
+	}
+	err = json.Unmarshal(raw, &t)
+	if err != nil {
+		return t, 0, false, fmt.Errorf("json.unmarshal: %w", err)
+	}
+	return t, rev, true, nil
+}
+
+// SaveIfRevision saves t only if key is still at revision, otherwise it returns ErrRevisionMismatch.
+// Use revision 0 to save only if key doesn't exist. The meta and expiry of key are kept.
+//
+// Revisions continue after the history of a deleted key. Without history a deleted and recreated key starts at revision 1 again,
+// so a client holding revision 1 of the deleted key may overwrite the new one. Enable history on buckets where this matters.
+func (b *Bucket[T]) SaveIfRevision(key string, t T, revision int64) error {
+	raw, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("json.marshal: %w", err)
+	}
+	tx, err := b.store.BeginTx()
+	if err != nil {
+		return fmt.Errorf("begin-tx: %w", err)
+	}
+	e, _, err := tx.FindRawEntry(b.name, key)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("find-raw-entry: %w", err)
+	}
+	err = tx.SaveRawIfRevision(b.name, key, raw, revision)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("save-raw-if-revision: %w", err)
+	}
+	err = b.updateIndexes(tx, key, t, e.Meta)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("update-indexes: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// Update reads key, applies fn and saves the result if key wasn't changed in the meantime.
+// On a conflict the whole cycle is retried, so fn may be called multiple times. A non existing key is passed as zero value.
+func (b *Bucket[T]) Update(key string, fn func(T) (T, error)) error {
+	for range UpdateMaxAttempts {
+		t, rev, _, err := b.FindWithRevision(key)
+		if err != nil {
+			return fmt.Errorf("find-with-revision: %w", err)
+		}
+		t, err = fn(t)
+		if err != nil {
+			return err
+		}
+		err = b.SaveIfRevision(key, t, rev)
+		switch {
+		case errors.Is(err, ErrRevisionMismatch):
+			continue
+		case err != nil:
+			return fmt.Errorf("save-if-revision: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("update %q: giving up after %d attempts: %w", key, UpdateMaxAttempts, ErrRevisionMismatch)
+}
@@ -0,0 +1,89 @@
+package blobix_v2
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mazzegi/mbox/query"
+)
+
+// The Tx funcs write within the transaction of Store.Update, so several buckets can be written atomically:
+//
+//	err := store.Update(func(tx TypedTx) error {
+//		err := orders.SaveTx(tx, orderID, order)
+//		if err != nil {
+//			return err
+//		}
+//		return items.SaveManyTx(tx, lineItems)
+//	})
+//
+// Within the callback, the funcs without Tx like Save or Delete must not be used. They start their own transaction,
+// which waits for the single writer connection held by the callback and so never starts.
+
+func (b *Bucket[T]) SaveTx(tx TypedTx, key string, t T) error {
+	return b.saveTx(tx, key, t, 0)
+}
+
+func (b *Bucket[T]) saveTx(tx TypedTx, key string, t T, ttl time.Duration) error {
+	raw, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("json.marshal: %w", err)
+	}
+	err = tx.SaveRawWithTTL(b.name, key, raw, ttl)
+	if err != nil {
+		return fmt.Errorf("save-raw: %w", err)
+	}
+	err = b.updateIndexes(tx, key, t, nil)
+	if err != nil {
+		return fmt.Errorf("update-indexes: %w", err)
+	}
+	return nil
+}
+
+func (b *Bucket[T]) SaveManyTx(tx TypedTx, kvs []Tuple[string, T]) error {
+	rawKVs := make([]Tuple[string, []byte], len(kvs))
+	for i, kvv := range kvs {
+		raw, err := json.Marshal(kvv.Value)
+		if err != nil {
+			return fmt.Errorf("json.marshal: %w", err)
+		}
+		rawKVs[i] = MkTuple(kvv.Key, raw)
+	}
+	err := tx.SaveRawMany(b.name, rawKVs)
+	if err != nil {
+		return fmt.Errorf("save-raw: %w", err)
+	}
+	for _, kvv := range kvs {
+		err := b.updateIndexes(tx, kvv.Key, kvv.Value, nil)
+		if err != nil {
+			return fmt.Errorf("update-indexes: %w", err)
+		}
+	}
+	return nil
+}
+
+func (b *Bucket[T]) DeleteTx(tx TypedTx, keys ...string) error {
+	err := tx.Delete(b.name, keys...)
+	if err != nil {
+		return fmt.Errorf("delete: %w", err)
+	}
+	return nil
+}
+
+// FindTx reads key within tx, so it sees the uncommitted writes of tx
+func (b *Bucket[T]) FindTx(tx TypedTx, key string) (T, query.Found, error) {
+	var t T
+	raw, _, found, err := tx.FindRawWithRevision(b.name, key)
+	if err != nil {
+		return t, false, fmt.Errorf("find-raw-with-revision: %w", err)
+	}
+	if !found {
+		return t, false, nil
+	}
+	err = json.Unmarshal(raw, &t)
+	if err != nil {
+		return t, false, fmt.Errorf("json.unmarshal: %w", err)
+	}
+	return t, true, nil
+}
@@ -13,6 +13,8 @@ type IndexFieldDescriptor struct {
 	Name string         `json:"name"`
 	Type IndexFieldType `json:"type"`
 	Tag  string         `json:"tag"`
+	// Path is a json path (like $.a.b[0]) evaluated on the stored value, for fields without a ValueFunc
+	Path string `json:"path,omitempty"`
 }
 
 type IndexField[T any] struct {
@@ -31,10 +33,21 @@ func IF[T any](name string, typ IndexFieldType, tag string, valueFnc func(T) any
 	}
 }
 
+// PIF is an index field evaluated by the store on the stored json value
+func PIF[T any](name string, typ IndexFieldType, path string) IndexField[T] {
+	return IndexField[T]{
+		Descriptor: IndexFieldDescriptor{
+			Name: name,
+			Type: typ,
+			Path: path,
+		},
+	}
+}
+
 type IndexDescriptor struct {
-	BucketName string
-	IndexName  string
-	Fields     []IndexFieldDescriptor
+	BucketName string                 `json:"bucket_name"`
+	IndexName  string                 `json:"index_name"`
+	Fields     []IndexFieldDescriptor `json:"fields"`
 }
 
 func IndexDescriptorsEqual(id1, id2 IndexDescriptor) bool {
@@ -53,3 +66,20 @@ func IndexDescriptorsEqual(id1, id2 IndexDescriptor) bool {
 	}
 	return true
 }
+
+// PathOnly is true if all fields have a path, so the index is maintained by the store alone
+func (d IndexDescriptor) PathOnly() bool {
+	return pathOnly(d.Fields)
+}
+
+func pathOnly(fields []IndexFieldDescriptor) bool {
+	if len(fields) == 0 {
+		return false
+	}
+	for _, f := range fields {
+		if f.Path == "" {
+			return false
+		}
+	}
+	return true
+}
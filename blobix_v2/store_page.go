@@ -0,0 +1,44 @@
+package blobix_v2
+
+import (
+	"fmt"
+
+	"github.com/mazzegi/mbox/query"
+)
+
+// PageRequest selects a page of a query. The page size is the limit of the query.
+// If Cursor is set, the page starts after the position it denotes and the offset of the query is ignored.
+type PageRequest struct {
+	Cursor    string
+	WithTotal bool
+}
+
+// QueryKeysResult is a page of keys. Total is only set if it was requested,
+// NextCursor is empty if there are no more pages.
+type QueryKeysResult struct {
+	Keys       []string
+	Total      int
+	NextCursor string
+}
+
+type QueryPage[T any] struct {
+	Items      []T
+	Total      int
+	NextCursor string
+}
+
+func (b *Bucket[T]) QueryPage(indexName string, q query.Query, page PageRequest) (QueryPage[T], error) {
+	res, err := b.store.QueryKeysPage(b.name, indexName, q, page)
+	if err != nil {
+		return QueryPage[T]{}, fmt.Errorf("store.query-keys-page: %w", err)
+	}
+	vs, err := b.Values(res.Keys...)
+	if err != nil {
+		return QueryPage[T]{}, fmt.Errorf("values: %w", err)
+	}
+	return QueryPage[T]{
+		Items:      vs,
+		Total:      res.Total,
+		NextCursor: res.NextCursor,
+	}, nil
+}
@@ -1,15 +1,25 @@
 package blobix_v2
 
 import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/mazzegi/mbox/mathx"
 	"github.com/mazzegi/mbox/query"
+	"github.com/mazzegi/mbox/slicesx"
+	"github.com/mazzegi/mbox/sqlitex"
 	"github.com/mazzegi/mbox/testx"
 )
 
@@ -46,15 +56,23 @@ func NewTestStoreType(key string, n int) TestStoreType {
 }
 
 func TestStoreBase(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testStoreBase(t, d)
+		})
+	}
+}
+
+func testStoreBase(t *testing.T, d sqlitex.Driver) {
 	tx := testx.NewTx(t)
 
-	tmpFolderName := fmt.Sprintf("test_%s", time.Now().Format("20060102_150405"))
+	tmpFolderName := fmt.Sprintf("test_%s_%s", d, time.Now().Format("20060102_150405"))
 	err := os.MkdirAll(tmpFolderName, os.ModePerm)
 	tx.AssertNoErr(err)
 	defer os.RemoveAll(tmpFolderName)
 
 	storeFile := filepath.Join(tmpFolderName, "test.db")
-	store, err := NewSqliteXStore(storeFile)
+	store, err := NewSqliteXStore(storeFile, sqlitex.WithDriver(d))
 	tx.AssertNoErr(err)
 	defer store.Close()
 
@@ -105,15 +123,23 @@ func TestStoreBase(t *testing.T) {
 }
 
 func TestStoreIndex(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testStoreIndex(t, d)
+		})
+	}
+}
+
+func testStoreIndex(t *testing.T, d sqlitex.Driver) {
 	tx := testx.NewTx(t)
 
-	tmpFolderName := fmt.Sprintf("test_index_%s", time.Now().Format("20060102_150405"))
+	tmpFolderName := fmt.Sprintf("test_index_%s_%s", d, time.Now().Format("20060102_150405"))
 	err := os.MkdirAll(tmpFolderName, os.ModePerm)
 	tx.AssertNoErr(err)
 	defer os.RemoveAll(tmpFolderName)
 
 	storeFile := filepath.Join(tmpFolderName, "test.db")
-	store, err := NewSqliteXStore(storeFile)
+	store, err := NewSqliteXStore(storeFile, sqlitex.WithDriver(d))
 	tx.AssertNoErr(err)
 	defer store.Close()
 
@@ -171,15 +197,23 @@ func TestStoreIndex(t *testing.T) {
 }
 
 func TestStoreIterKeys(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testStoreIterKeys(t, d)
+		})
+	}
+}
+
+func testStoreIterKeys(t *testing.T, d sqlitex.Driver) {
 	tx := testx.NewTx(t)
 
-	tmpFolderName := fmt.Sprintf("test_iter_keys_%s", time.Now().Format("20060102_150405"))
+	tmpFolderName := fmt.Sprintf("test_iter_keys_%s_%s", d, time.Now().Format("20060102_150405"))
 	err := os.MkdirAll(tmpFolderName, os.ModePerm)
 	tx.AssertNoErr(err)
 	defer os.RemoveAll(tmpFolderName)
 
 	storeFile := filepath.Join(tmpFolderName, "test.db")
-	store, err := NewSqliteXStore(storeFile)
+	store, err := NewSqliteXStore(storeFile, sqlitex.WithDriver(d))
 	tx.AssertNoErr(err)
 	defer store.Close()
 
@@ -234,3 +268,1550 @@ func TestStoreIterKeys(t *testing.T) {
 	}
 	// to come until here is enough to pass the test - if the iterator doesn't react correctly to break a panic occurs
 }
+
+func TestStoreIndexFilter(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testStoreIndexFilter(t, d)
+		})
+	}
+}
+
+func testStoreIndexFilter(t *testing.T, d sqlitex.Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_index_filter_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	storeFile := filepath.Join(tmpFolderName, "test.db")
+	store, err := NewSqliteXStore(storeFile, sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+	defer store.Close()
+
+	bucket := NewBucket[TestStoreType](store, "test_type")
+	err = bucket.AddOrUpdateIndex("default",
+		IF("string_2", IndexFieldString, "v1", func(t TestStoreType) any { return t.String2 }),
+		IF("int_1", IndexFieldInt, "v1", func(t TestStoreType) any { return t.Int1 }),
+		IF("int_2", IndexFieldInt, "v1", func(t TestStoreType) any { return t.Int2 }),
+		IF("float_2", IndexFieldFloat, "v1", func(t TestStoreType) any { return t.Float2 }),
+	)
+	tx.AssertNoErr(err)
+
+	numRecords := 100
+	for n := range numRecords {
+		key := fmt.Sprintf("test_key_%06d", n)
+		err := bucket.Save(key, NewTestStoreType(key, n+1))
+		tx.AssertNoErr(err)
+	}
+
+	queryInt1s := func(q query.Query) []int {
+		q.LimitOffset = query.LO(1_000, 0)
+		q.Sorts = []query.Sort{query.S("int_1", query.SortASC)}
+		vs, err := bucket.Query("default", q)
+		tx.AssertNoErr(err)
+		var ns []int
+		for _, v := range vs {
+			ns = append(ns, v.Int1)
+		}
+		return ns
+	}
+
+	// (int_1 <= 3 OR int_1 BETWEEN 50 AND 52) AND NOT int_2 = 1
+	ns := queryInt1s(query.Query{
+		Filter: query.And(
+			query.Or(
+				query.C("int_1", query.ComparatorLessEqual, 3),
+				query.Between("int_1", 50, 52),
+			),
+			query.Not(query.C("int_2", query.ComparatorEqual, 1)),
+		),
+	})
+	tx.AssertEqual([]int{2, 3, 50, 52}, ns)
+
+	// conditions and filter are combined
+	ns = queryInt1s(query.Query{
+		Conditions: []query.Condition{query.C("int_2", query.ComparatorIn, []int{3, 4})},
+		Filter:     query.C("float_2", query.ComparatorIn, []float64{5.002}),
+	})
+	tx.AssertEqual([]int{3, 13, 23, 33, 43, 53, 63, 73, 83, 93}, ns)
+
+	ns = queryInt1s(query.Query{
+		Filter: query.And(query.EndsWith("string_2", "_7"), query.C("int_1", query.ComparatorLess, 30)),
+	})
+	tx.AssertEqual([]int{7, 17, 27}, ns)
+
+	ns = queryInt1s(query.Query{
+		Filter: query.IsNull("string_2"),
+	})
+	tx.AssertEqual([]int(nil), ns)
+
+	_, err = bucket.Query("default", query.Query{Filter: query.Or(query.IsNull("no_such_field"))})
+	tx.AssertErr(err)
+}
+
+func TestStoreQueryPage(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testStoreQueryPage(t, d)
+		})
+	}
+}
+
+func testStoreQueryPage(t *testing.T, d sqlitex.Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_query_page_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	storeFile := filepath.Join(tmpFolderName, "test.db")
+	store, err := NewSqliteXStore(storeFile, sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+	defer store.Close()
+
+	bucket := NewBucket[TestStoreType](store, "test_type")
+	err = bucket.AddOrUpdateIndex("default",
+		IF("int_1", IndexFieldInt, "v1", func(t TestStoreType) any { return t.Int1 }),
+		IF("int_2", IndexFieldInt, "v1", func(t TestStoreType) any {
+			if t.Int2 == 0 {
+				return nil
+			}
+			return t.Int2
+		}),
+	)
+	tx.AssertNoErr(err)
+
+	numRecords := 95
+	for n := range numRecords {
+		key := fmt.Sprintf("test_key_%06d", n)
+		err := bucket.Save(key, NewTestStoreType(key, n+1))
+		tx.AssertNoErr(err)
+	}
+
+	for _, ord := range []query.SortOrder{query.SortASC, query.SortDESC} {
+		q := query.Query{
+			LimitOffset: query.LO(10, 0),
+			Filter:      query.C("int_1", query.ComparatorGreater, 5),
+			Sorts:       []query.Sort{query.S("int_2", ord)},
+		}
+		all, err := bucket.Query("default", query.Query{
+			LimitOffset: query.LO(1_000, 0),
+			Filter:      q.Filter,
+			Sorts:       []query.Sort{query.S("int_2", ord), query.S("key", query.SortASC)},
+		})
+		tx.AssertNoErr(err)
+		tx.AssertEqual(90, len(all))
+
+		var paged []TestStoreType
+		page := PageRequest{WithTotal: true}
+		numPages := 0
+		for {
+			res, err := bucket.QueryPage("default", q, page)
+			tx.AssertNoErr(err)
+			tx.AssertEqual(90, res.Total)
+			paged = append(paged, res.Items...)
+			numPages++
+			if res.NextCursor == "" {
+				break
+			}
+			page.Cursor = res.NextCursor
+		}
+		tx.AssertEqual(9, numPages)
+		tx.AssertEqual(all, paged)
+	}
+
+	// a cursor is bound to the sort order it was created with
+	res, err := bucket.QueryPage("default", query.Query{LimitOffset: query.LO(10, 0)}, PageRequest{})
+	tx.AssertNoErr(err)
+	_, err = bucket.QueryPage("default", query.Query{
+		LimitOffset: query.LO(10, 0),
+		Sorts:       []query.Sort{query.S("int_1", query.SortASC)},
+	}, PageRequest{Cursor: res.NextCursor})
+	tx.AssertErr(err)
+
+	// tampered cursors are rejected
+	for _, tampered := range []string{
+		"not-base64!",
+		base64.RawURLEncoding.EncodeToString([]byte(`{"s":[],"v":[{"a":1}],"k":"key"}`)),
+		base64.RawURLEncoding.EncodeToString([]byte(`{"s":[],"v":[],"k":42}`)),
+	} {
+		_, err = bucket.QueryPage("default", query.Query{LimitOffset: query.LO(10, 0)}, PageRequest{Cursor: tampered})
+		tx.AssertErr(err)
+	}
+}
+
+func TestStoreWatch(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testStoreWatch(t, d)
+		})
+	}
+}
+
+func testStoreWatch(t *testing.T, d sqlitex.Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_watch_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	storeFile := filepath.Join(tmpFolderName, "test.db")
+	store, err := NewSqliteXStore(storeFile, sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+	defer store.Close()
+
+	bucket := NewBucket[TestStoreType](store, "test_type")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := bucket.Watch(ctx, "a_", &WatchOptions{WithValues: true})
+	wSmall := store.Watch(context.Background(), "test_type", "", &WatchOptions{BufferSize: 2})
+	defer wSmall.Close()
+
+	err = bucket.Save("a_1", NewTestStoreType("a_1", 1))
+	tx.AssertNoErr(err)
+	err = bucket.Save("b_1", NewTestStoreType("b_1", 1))
+	tx.AssertNoErr(err)
+	err = bucket.SaveMany([]Tuple[string, TestStoreType]{
+		MkTuple("a_2", NewTestStoreType("a_2", 2)),
+		MkTuple("a_3", NewTestStoreType("a_3", 3)),
+	})
+	tx.AssertNoErr(err)
+	err = bucket.Delete("a_1", "a_4")
+	tx.AssertNoErr(err)
+
+	// rolled back changes are not emitted
+	stx, err := store.BeginTx()
+	tx.AssertNoErr(err)
+	err = stx.SaveRaw("test_type", "a_5", []byte(`{}`))
+	tx.AssertNoErr(err)
+	err = stx.Rollback()
+	tx.AssertNoErr(err)
+
+	cancel()
+	var evts []ChangeEvent
+	for evt := range w.C {
+		evts = append(evts, evt)
+	}
+	tx.AssertEqual(4, len(evts))
+	expect := []struct {
+		typ ChangeType
+		key string
+	}{
+		{ChangePut, "a_1"},
+		{ChangePut, "a_2"},
+		{ChangePut, "a_3"},
+		{ChangeDelete, "a_1"},
+	}
+	for i, exp := range expect {
+		tx.AssertEqual(exp.typ, evts[i].Type)
+		tx.AssertEqual(exp.key, evts[i].Key)
+		tx.AssertEqual(false, evts[i].ModifiedOn.IsZero())
+	}
+	var v TestStoreType
+	err = json.Unmarshal(evts[1].Value, &v)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(NewTestStoreType("a_2", 2), v)
+	tx.AssertEqual([]byte(nil), evts[3].Value)
+
+	// the small buffer overflowed
+	tx.AssertEqual(uint64(3), wSmall.Dropped())
+	evt := <-wSmall.C
+	tx.AssertEqual([]byte(nil), evt.Value)
+
+	// watchers get their own values
+	w1 := bucket.Watch(context.Background(), "c_", &WatchOptions{WithValues: true})
+	defer w1.Close()
+	w2 := bucket.Watch(context.Background(), "c_", &WatchOptions{WithValues: true})
+	defer w2.Close()
+	err = bucket.Save("c_1", NewTestStoreType("c_1", 1))
+	tx.AssertNoErr(err)
+	evt1, evt2 := <-w1.C, <-w2.C
+	clear(evt1.Value)
+	tx.AssertEqual(true, json.Valid(evt2.Value))
+}
+
+func TestStoreTTL(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testStoreTTL(t, d)
+		})
+	}
+}
+
+func testStoreTTL(t *testing.T, d sqlitex.Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_ttl_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	storeFile := filepath.Join(tmpFolderName, "test.db")
+	store, err := NewSqliteXStore(storeFile, sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+	defer store.Close()
+
+	bucket := NewBucket[TestStoreType](store, "test_type")
+	err = bucket.AddOrUpdateIndex("default",
+		IF("int_1", IndexFieldInt, "v1", func(t TestStoreType) any { return t.Int1 }),
+	)
+	tx.AssertNoErr(err)
+
+	err = bucket.Save("keep", NewTestStoreType("keep", 1))
+	tx.AssertNoErr(err)
+	err = bucket.SaveWithTTL("expire", NewTestStoreType("expire", 2), 50*time.Millisecond)
+	tx.AssertNoErr(err)
+	err = bucket.SaveWithTTL("renew", NewTestStoreType("renew", 3), 50*time.Millisecond)
+	tx.AssertNoErr(err)
+	// saving again without ttl removes the expiry
+	err = bucket.Save("renew", NewTestStoreType("renew", 3))
+	tx.AssertNoErr(err)
+
+	_, found, err := bucket.Find("expire")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(true), found)
+
+	time.Sleep(100 * time.Millisecond)
+
+	_, found, err = bucket.Find("expire")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(false), found)
+	keys, err := store.Keys("test_type")
+	tx.AssertNoErr(err)
+	sort.Strings(keys)
+	tx.AssertEqual([]string{"keep", "renew"}, keys)
+	qkeys, err := store.QueryKeys("test_type", "default", query.Query{
+		LimitOffset: query.LO(100, 0),
+		Sorts:       []query.Sort{query.S("int_1", query.SortASC)},
+	})
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]string{"keep", "renew"}, qkeys)
+
+	// sweep
+	ctx, cancel := context.WithCancel(context.Background())
+	w := store.Watch(ctx, "test_type", "", nil)
+	num, err := store.SweepExpired()
+	tx.AssertNoErr(err)
+	tx.AssertEqual(1, num)
+	cancel()
+	evt := <-w.C
+	tx.AssertEqual(ChangeDelete, evt.Type)
+	tx.AssertEqual("expire", evt.Key)
+
+	var indexRows int
+	err = store.dbx.QueryRow(`SELECT COUNT(*) FROM _index_test_type_default;`).Scan(&indexRows)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(2, indexRows)
+
+	num, err = store.SweepExpired()
+	tx.AssertNoErr(err)
+	tx.AssertEqual(0, num)
+
+	// with history, swept keys are archived as expired
+	err = bucket.EnableHistory(3)
+	tx.AssertNoErr(err)
+	err = bucket.SaveWithTTL("expire", NewTestStoreType("expire", 4), 10*time.Millisecond)
+	tx.AssertNoErr(err)
+	time.Sleep(50 * time.Millisecond)
+	num, err = store.SweepExpired()
+	tx.AssertNoErr(err)
+	tx.AssertEqual(1, num)
+	vs, err := bucket.History("expire")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(1, len(vs))
+	tx.AssertEqual(true, vs[0].Deleted)
+	tx.AssertEqual(true, vs[0].Expired)
+}
+
+func TestStoreRevision(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testStoreRevision(t, d)
+		})
+	}
+}
+
+func testStoreRevision(t *testing.T, d sqlitex.Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_revision_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	storeFile := filepath.Join(tmpFolderName, "test.db")
+	store, err := NewSqliteXStore(storeFile, sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+	defer store.Close()
+
+	bucket := NewBucket[TestStoreType](store, "test_type")
+	err = bucket.AddOrUpdateIndex("default",
+		IF("int_1", IndexFieldInt, "v1", func(t TestStoreType) any { return t.Int1 }),
+	)
+	tx.AssertNoErr(err)
+
+	_, rev, found, err := bucket.FindWithRevision("k")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(false), found)
+	tx.AssertEqual(int64(0), rev)
+
+	err = bucket.SaveIfRevision("k", NewTestStoreType("k", 1), 0)
+	tx.AssertNoErr(err)
+	err = bucket.SaveIfRevision("k", NewTestStoreType("k", 2), 0)
+	tx.AssertErr(err)
+	tx.AssertEqual(true, errors.Is(err, ErrRevisionMismatch))
+
+	err = bucket.Save("k", NewTestStoreType("k", 3))
+	tx.AssertNoErr(err)
+	v, rev, found, err := bucket.FindWithRevision("k")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(true), found)
+	tx.AssertEqual(int64(2), rev)
+	tx.AssertEqual(3, v.Int1)
+
+	err = bucket.SaveIfRevision("k", NewTestStoreType("k", 4), 1)
+	tx.AssertEqual(true, errors.Is(err, ErrRevisionMismatch))
+	err = bucket.SaveIfRevision("k", NewTestStoreType("k", 4), 2)
+	tx.AssertNoErr(err)
+
+	// concurrent increments must not get lost
+	numWorkers := 8
+	var wg sync.WaitGroup
+	for range numWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := bucket.Update("k", func(t TestStoreType) (TestStoreType, error) {
+				t.Int1++
+				return t, nil
+			})
+			tx.AssertNoErr(err)
+		}()
+	}
+	wg.Wait()
+	v, rev, _, err = bucket.FindWithRevision("k")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(4+numWorkers, v.Int1)
+	tx.AssertEqual(int64(3+numWorkers), rev)
+
+	// index follows the updates
+	keys, err := store.QueryKeys("test_type", "default", query.Query{
+		LimitOffset: query.LO(10, 0),
+		Conditions:  []query.Condition{query.C("int_1", query.ComparatorEqual, 4+numWorkers)},
+	})
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]string{"k"}, keys)
+
+	// updates keep meta and expiry
+	stx, err := store.BeginTx()
+	tx.AssertNoErr(err)
+	raw, err := json.Marshal(NewTestStoreType("m", 1))
+	tx.AssertNoErr(err)
+	err = stx.SaveRawWithMeta("test_type", "m", raw, []byte(`{"owner":"me"}`))
+	tx.AssertNoErr(err)
+	err = stx.Commit()
+	tx.AssertNoErr(err)
+	err = bucket.SaveWithTTL("ttl", NewTestStoreType("ttl", 1), time.Hour)
+	tx.AssertNoErr(err)
+	for _, key := range []string{"m", "ttl"} {
+		err = bucket.Update(key, func(t TestStoreType) (TestStoreType, error) {
+			t.Int1++
+			return t, nil
+		})
+		tx.AssertNoErr(err)
+	}
+	e, _, err := store.FindRawEntry("test_type", "m")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(`{"owner":"me"}`, string(e.Meta))
+	tx.AssertEqual(int64(2), e.Revision)
+	var expiring int
+	err = store.dbx.QueryRow("SELECT COUNT(*) FROM data WHERE bucket = ? AND key = ? AND expires_at IS NOT NULL;", "test_type", "ttl").Scan(&expiring)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(1, expiring)
+}
+
+func TestStoreRevisionLegacy(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testStoreRevisionLegacy(t, d)
+		})
+	}
+}
+
+func testStoreRevisionLegacy(t *testing.T, d sqlitex.Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_revision_legacy_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	// a store created before revisions existed
+	storeFile := filepath.Join(tmpFolderName, "test.db")
+	dbx, err := sqlitex.NewDB(storeFile, sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+	_, err = dbx.Exec(sqlitex_v1_init)
+	tx.AssertNoErr(err)
+	_, err = dbx.Exec("INSERT INTO data (bucket, key, modified_on, value) VALUES('test_type', 'k', ?, ?);",
+		time.Now().UTC().Format(time.RFC3339Nano), `{"int_1":1}`)
+	tx.AssertNoErr(err)
+	dbx.Close()
+
+	store, err := NewSqliteXStore(storeFile, sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+	defer store.Close()
+
+	bucket := NewBucket[TestStoreType](store, "test_type")
+	_, rev, found, err := bucket.FindWithRevision("k")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(true), found)
+	tx.AssertEqual(int64(1), rev)
+
+	err = bucket.SaveIfRevision("k", NewTestStoreType("k", 2), 0)
+	tx.AssertEqual(true, errors.Is(err, ErrRevisionMismatch))
+	err = bucket.SaveIfRevision("k", NewTestStoreType("k", 2), 1)
+	tx.AssertNoErr(err)
+}
+
+func TestStoreHistory(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testStoreHistory(t, d)
+		})
+	}
+}
+
+func testStoreHistory(t *testing.T, d sqlitex.Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_history_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	storeFile := filepath.Join(tmpFolderName, "test.db")
+	store, err := NewSqliteXStore(storeFile, sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+	defer store.Close()
+
+	bucket := NewBucket[TestStoreType](store, "test_type")
+	err = bucket.AddOrUpdateIndex("default",
+		IF("int_1", IndexFieldInt, "v1", func(t TestStoreType) any { return t.Int1 }),
+	)
+	tx.AssertNoErr(err)
+	err = bucket.EnableHistory(3)
+	tx.AssertNoErr(err)
+
+	for n := 1; n <= 5; n++ {
+		err = bucket.Save("k", NewTestStoreType("k", n))
+		tx.AssertNoErr(err)
+	}
+	vs, err := bucket.History("k")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(3, len(vs))
+	tx.AssertEqual(int64(4), vs[0].Revision)
+	tx.AssertEqual(4, vs[0].Value.Int1)
+	tx.AssertEqual(int64(2), vs[2].Revision)
+
+	err = bucket.Restore("k", 3)
+	tx.AssertNoErr(err)
+	v, rev, _, err := bucket.FindWithRevision("k")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(3, v.Int1)
+	tx.AssertEqual(int64(6), rev)
+	err = bucket.Restore("k", 1)
+	tx.AssertErr(err)
+
+	// soft delete
+	err = bucket.Delete("k")
+	tx.AssertNoErr(err)
+	_, found, err := bucket.Find("k")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(false), found)
+	vs, err = bucket.History("k")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(true, vs[0].Deleted)
+	tx.AssertEqual(false, vs[0].Expired)
+	tx.AssertEqual(int64(6), vs[0].Revision)
+
+	err = bucket.Undelete("k")
+	tx.AssertNoErr(err)
+	err = bucket.Undelete("k")
+	tx.AssertErr(err)
+	v, rev, found, err = bucket.FindWithRevision("k")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(true), found)
+	tx.AssertEqual(3, v.Int1)
+	tx.AssertEqual(int64(7), rev)
+	keys, err := store.QueryKeys("test_type", "default", query.Query{
+		LimitOffset: query.LO(10, 0),
+		Conditions:  []query.Condition{query.C("int_1", query.ComparatorEqual, 3)},
+	})
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]string{"k"}, keys)
+
+	// buckets without history don't record versions
+	other := NewBucket[TestStoreType](store, "other")
+	err = other.Save("k", NewTestStoreType("k", 1))
+	tx.AssertNoErr(err)
+	err = other.Save("k", NewTestStoreType("k", 2))
+	tx.AssertNoErr(err)
+	vs2, err := other.History("k")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(0, len(vs2))
+
+	err = bucket.DisableHistory()
+	tx.AssertNoErr(err)
+	vs, err = bucket.History("k")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(0, len(vs))
+}
+
+func TestStoreMeta(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testStoreMeta(t, d)
+		})
+	}
+}
+
+func testStoreMeta(t *testing.T, d sqlitex.Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_meta_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	storeFile := filepath.Join(tmpFolderName, "test.db")
+	store, err := NewSqliteXStore(storeFile, sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+	defer store.Close()
+
+	type meta struct {
+		Author string `json:"author"`
+		Draft  bool   `json:"draft"`
+	}
+
+	bucket := NewMetaBucket[TestStoreType, meta](store, "test_type")
+	numRecords := 20
+	for n := range numRecords {
+		key := fmt.Sprintf("test_key_%06d", n)
+		m := meta{Author: fmt.Sprintf("author_%d", n%3), Draft: n%2 == 0}
+		err := bucket.SaveWithMeta(key, NewTestStoreType(key, n+1), m)
+		tx.AssertNoErr(err)
+	}
+	// plain saves store no meta
+	err = bucket.Save("no_meta", NewTestStoreType("no_meta", 100))
+	tx.AssertNoErr(err)
+
+	e, found, err := bucket.FindWithMeta("test_key_000004")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(true), found)
+	tx.AssertEqual(5, e.Value.Int1)
+	tx.AssertEqual(meta{Author: "author_1", Draft: true}, e.Meta)
+	tx.AssertEqual(false, e.ModifiedOn.IsZero())
+
+	e, _, err = bucket.FindWithMeta("no_meta")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(meta{}, e.Meta)
+
+	// index created after the data was saved
+	err = bucket.AddOrUpdateMetaIndex("meta",
+		IF("author", IndexFieldString, "v1", func(vm ValueMeta[TestStoreType, meta]) any { return vm.Meta.Author }),
+		IF("int_1", IndexFieldInt, "v1", func(vm ValueMeta[TestStoreType, meta]) any { return vm.Value.Int1 }),
+	)
+	tx.AssertNoErr(err)
+
+	q := query.Query{
+		LimitOffset: query.LO(100, 0),
+		Conditions: []query.Condition{
+			query.C("author", query.ComparatorEqual, "author_2"),
+			query.C("int_1", query.ComparatorLess, 10),
+		},
+		Sorts: []query.Sort{query.S("int_1", query.SortDESC)},
+	}
+	es, err := bucket.QueryWithMeta("meta", q)
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]int{9, 6, 3}, slicesx.Map(es, func(e MetaEntry[TestStoreType, meta]) int { return e.Value.Int1 }))
+
+	// index follows meta changes
+	err = bucket.SaveWithMeta("test_key_000002", NewTestStoreType("test_key_000002", 3), meta{Author: "author_0"})
+	tx.AssertNoErr(err)
+	keys, err := store.QueryKeys("test_type", "meta", q)
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]string{"test_key_000008", "test_key_000005"}, keys)
+
+	// restore and undelete bring back the meta of the version
+	err = bucket.EnableHistory(3)
+	tx.AssertNoErr(err)
+	_, rev, _, err := bucket.FindWithRevision("test_key_000002")
+	tx.AssertNoErr(err)
+	err = bucket.SaveWithMeta("test_key_000002", NewTestStoreType("test_key_000002", 4), meta{Author: "author_1"})
+	tx.AssertNoErr(err)
+	err = bucket.Restore("test_key_000002", rev)
+	tx.AssertNoErr(err)
+	e, _, err = bucket.FindWithMeta("test_key_000002")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(3, e.Value.Int1)
+	tx.AssertEqual(meta{Author: "author_0"}, e.Meta)
+
+	err = bucket.Delete("test_key_000002")
+	tx.AssertNoErr(err)
+	err = bucket.Undelete("test_key_000002")
+	tx.AssertNoErr(err)
+	e, _, err = bucket.FindWithMeta("test_key_000002")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(meta{Author: "author_0"}, e.Meta)
+	keys, err = store.QueryKeys("test_type", "meta", query.Query{
+		LimitOffset: query.LO(100, 0),
+		Conditions:  []query.Condition{query.C("author", query.ComparatorEqual, "author_0"), query.C("int_1", query.ComparatorEqual, 3)},
+	})
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]string{"test_key_000002"}, keys)
+}
+
+func TestStorePathIndex(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testStorePathIndex(t, d)
+		})
+	}
+}
+
+func testStorePathIndex(t *testing.T, d sqlitex.Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_path_index_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	storeFile := filepath.Join(tmpFolderName, "test.db")
+	store, err := NewSqliteXStore(storeFile, sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+
+	bucket := NewBucket[TestStoreType](store, "test_type")
+	numRecords := 30
+	for n := range numRecords {
+		key := fmt.Sprintf("test_key_%06d", n)
+		err := bucket.Save(key, NewTestStoreType(key, n+1))
+		tx.AssertNoErr(err)
+	}
+	// mixed index: value func and path
+	err = bucket.AddOrUpdateIndex("mixed",
+		IF("int_1", IndexFieldInt, "v1", func(t TestStoreType) any { return t.Int1 }),
+		PIF[TestStoreType]("string_2", IndexFieldString, "$.string_2"),
+	)
+	tx.AssertNoErr(err)
+	// path only index, defined without the type
+	err = store.CreateIndex("test_type", "paths", []IndexFieldDescriptor{
+		{Name: "int_2", Type: IndexFieldInt, Path: "$.int_2"},
+		{Name: "int_1", Type: IndexFieldInt, Path: "$.int_1"},
+	})
+	tx.AssertNoErr(err)
+	err = store.RebuildIndex("test_type", "paths")
+	tx.AssertNoErr(err)
+	err = store.CreateIndex("test_type", "bad", []IndexFieldDescriptor{{Name: "x", Path: "x"}})
+	tx.AssertErr(err)
+	err = store.RebuildIndex("test_type", "mixed")
+	tx.AssertErr(err)
+
+	q := query.Query{
+		LimitOffset: query.LO(100, 0),
+		Conditions:  []query.Condition{query.C("string_2", query.ComparatorEqual, "string_2_val_5")},
+		Sorts:       []query.Sort{query.S("int_1", query.SortASC)},
+	}
+	keys, err := store.QueryKeys("test_type", "mixed", q)
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]string{"test_key_000004", "test_key_000014", "test_key_000024"}, keys)
+
+	// raw saves keep path indexes up to date
+	stx, err := store.BeginTx()
+	tx.AssertNoErr(err)
+	raw, err := json.Marshal(NewTestStoreType("raw", 105))
+	tx.AssertNoErr(err)
+	err = stx.SaveRaw("test_type", "raw", raw)
+	tx.AssertNoErr(err)
+	err = stx.Commit()
+	tx.AssertNoErr(err)
+
+	pq := query.Query{
+		LimitOffset: query.LO(100, 0),
+		Conditions:  []query.Condition{query.C("int_2", query.ComparatorEqual, 5)},
+		Sorts:       []query.Sort{query.S("int_1", query.SortDESC)},
+	}
+	keys, err = store.QueryKeys("test_type", "paths", pq)
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]string{"raw", "test_key_000024", "test_key_000014", "test_key_000004"}, keys)
+
+	// index definitions survive a reopen and are rebuilt from persisted metadata only
+	store.Close()
+	store, err = NewSqliteXStore(storeFile, sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+	defer store.Close()
+	desc, ok := store.FindIndexDescriptor("test_type", "paths")
+	tx.AssertEqual(true, ok)
+	tx.AssertEqual(true, desc.PathOnly())
+	err = store.RebuildIndex("test_type", "paths")
+	tx.AssertNoErr(err)
+	keys, err = store.QueryKeys("test_type", "paths", pq)
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]string{"raw", "test_key_000024", "test_key_000014", "test_key_000004"}, keys)
+
+	// keywords as field names and wildcards in searches
+	bucket = NewBucket[TestStoreType](store, "test_type")
+	percent := NewTestStoreType("percent", 1)
+	percent.String3 = "100% done"
+	err = bucket.Save("percent", percent)
+	tx.AssertNoErr(err)
+	err = store.CreateIndex("test_type", "keywords", []IndexFieldDescriptor{
+		{Name: "order", Type: IndexFieldString, Path: "$.string_3"},
+		{Name: "group", Type: IndexFieldInt, Path: "$.int_1"},
+	})
+	tx.AssertNoErr(err)
+	err = store.RebuildIndexOnline(context.Background(), "test_type", "keywords", nil, nil)
+	tx.AssertNoErr(err)
+	keys, err = store.QueryKeys("test_type", "keywords", query.Query{
+		LimitOffset: query.LO(100, 0),
+		Sorts:       []query.Sort{query.S("group", query.SortASC)},
+		Search:      query.SearchFor("%", "order"),
+	})
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]string{"percent"}, keys)
+	err = store.DeleteIndex("test_type", "keywords")
+	tx.AssertNoErr(err)
+}
+
+func TestStoreRebuildIndexOnline(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testStoreRebuildIndexOnline(t, d)
+		})
+	}
+}
+
+func testStoreRebuildIndexOnline(t *testing.T, d sqlitex.Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_rebuild_online_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	storeFile := filepath.Join(tmpFolderName, "test.db")
+	store, err := NewSqliteXStore(storeFile, sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+	defer store.Close()
+
+	bucket := NewBucket[TestStoreType](store, "test_type")
+	err = bucket.AddOrUpdateIndex("default",
+		IF("int_2", IndexFieldInt, "v1", func(t TestStoreType) any { return t.Int2 }),
+	)
+	tx.AssertNoErr(err)
+	numRecords := 1000
+	kvs := make([]Tuple[string, TestStoreType], numRecords)
+	for n := range numRecords {
+		key := fmt.Sprintf("test_key_%06d", n)
+		kvs[n] = MkTuple(key, NewTestStoreType(key, n))
+	}
+	err = bucket.SaveMany(kvs)
+	tx.AssertNoErr(err)
+
+	// raw writes bypass the typed index, which is repaired by the rebuild
+	saveRaw := func(key string, v TestStoreType) {
+		stx, err := store.BeginTx()
+		tx.AssertNoErr(err)
+		raw, err := json.Marshal(v)
+		tx.AssertNoErr(err)
+		err = stx.SaveRaw("test_type", key, raw)
+		tx.AssertNoErr(err)
+		err = stx.Commit()
+		tx.AssertNoErr(err)
+	}
+	for n := range 10 {
+		key := fmt.Sprintf("test_key_%06d", n*10)
+		v := NewTestStoreType(key, n*10)
+		v.Int2 = 42
+		saveRaw(key, v)
+	}
+	countInt2 := func(v int) int {
+		keys, err := store.QueryKeys("test_type", "default", query.Query{
+			LimitOffset: query.LO(numRecords+10, 0),
+			Conditions:  []query.Condition{query.C("int_2", query.ComparatorEqual, v)},
+		})
+		tx.AssertNoErr(err)
+		return len(keys)
+	}
+	tx.AssertEqual(0, countInt2(42))
+
+	// cancelled rebuilds leave the index as it is
+	ctx, cancel := context.WithCancel(context.Background())
+	err = bucket.RebuildIndex(ctx, "default", &RebuildOptions{
+		BatchSize: 100,
+		Progress: func(p RebuildProgress) {
+			if p.Processed >= 300 {
+				cancel()
+			}
+		},
+	})
+	tx.AssertEqual(true, errors.Is(err, context.Canceled))
+	tx.AssertEqual(0, countInt2(42))
+
+	// writes during the rebuild are caught up on
+	var progs []RebuildProgress
+	err = bucket.RebuildIndex(context.Background(), "default", &RebuildOptions{
+		BatchSize: 100,
+		Progress: func(p RebuildProgress) {
+			progs = append(progs, p)
+			if len(progs) == 2 {
+				// already processed
+				v := NewTestStoreType("test_key_000001", 1)
+				v.Int2 = 42
+				saveRaw("test_key_000001", v)
+				err := bucket.Delete("test_key_000010")
+				tx.AssertNoErr(err)
+				// not yet processed
+				v = NewTestStoreType("test_key_000999", 999)
+				v.Int2 = 42
+				saveRaw("test_key_000999", v)
+			}
+		},
+	})
+	tx.AssertNoErr(err)
+	tx.AssertEqual(10+1+1-1, countInt2(42))
+	last := progs[len(progs)-1]
+	tx.AssertEqual(numRecords, last.Total)
+	tx.AssertEqual(0, last.Pending)
+	tx.AssertEqual(true, last.Processed >= numRecords)
+
+	// the swapped in table is still maintained
+	err = bucket.Save("test_key_000020", NewTestStoreType("test_key_000020", 20))
+	tx.AssertNoErr(err)
+	tx.AssertEqual(10, countInt2(42))
+	tx.AssertEqual(numRecords/10-10+1, countInt2(0))
+}
+
+func TestStoreExportImport(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testStoreExportImport(t, d)
+		})
+	}
+}
+
+func testStoreExportImport(t *testing.T, d sqlitex.Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_export_import_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	store, err := NewSqliteXStore(filepath.Join(tmpFolderName, "src.db"), sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+	defer store.Close()
+
+	bucket := NewBucket[TestStoreType](store, "test_type")
+	err = bucket.AddOrUpdateIndex("default",
+		IF("int_2", IndexFieldInt, "v1", func(t TestStoreType) any { return t.Int2 }),
+	)
+	tx.AssertNoErr(err)
+	err = store.CreateIndex("test_type", "paths", []IndexFieldDescriptor{
+		{Name: "int_3", Type: IndexFieldInt, Path: "$.int_3"},
+	})
+	tx.AssertNoErr(err)
+	numRecords := 1200
+	kvs := make([]Tuple[string, TestStoreType], numRecords)
+	for n := range numRecords {
+		key := fmt.Sprintf("test_key_%06d", n)
+		kvs[n] = MkTuple(key, NewTestStoreType(key, n))
+	}
+	err = bucket.SaveMany(kvs)
+	tx.AssertNoErr(err)
+	stx, err := store.BeginTx()
+	tx.AssertNoErr(err)
+	err = stx.SaveRawWithMeta("test_type", "not_json", []byte("plain text"), []byte(`{"m":1}`))
+	tx.AssertNoErr(err)
+	err = stx.Commit()
+	tx.AssertNoErr(err)
+	// ttl, revision and blob are exported as well
+	err = bucket.SaveWithTTL("ttl_key", NewTestStoreType("ttl_key", 1), time.Hour)
+	tx.AssertNoErr(err)
+	for range 2 {
+		err = bucket.Save("test_key_000003", NewTestStoreType("test_key_000003", 3))
+		tx.AssertNoErr(err)
+	}
+	blob := bytes.Repeat([]byte("0123456789"), BlobChunkSize/4)
+	_, err = bucket.WriteBlob("test_key_000005", bytes.NewReader(blob))
+	tx.AssertNoErr(err)
+
+	buckets, err := store.Buckets()
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]string{"test_type"}, buckets)
+
+	var buf bytes.Buffer
+	n, err := store.ExportBucket("test_type", &buf)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(numRecords+2, n)
+	export := buf.Bytes()
+
+	dst, err := NewSqliteXStore(filepath.Join(tmpFolderName, "dst.db"), sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+	defer dst.Close()
+
+	// an existing key is kept on merge and replaced on overwrite
+	dstBucket := NewBucket[TestStoreType](dst, "copy")
+	err = dstBucket.Save("test_key_000001", NewTestStoreType("test_key_000001", 4711))
+	tx.AssertNoErr(err)
+
+	res, err := dst.ImportBucket(bytes.NewReader(export), ImportOptions{Policy: ImportMerge, Bucket: "copy"})
+	tx.AssertNoErr(err)
+	tx.AssertEqual("copy", res.Bucket)
+	tx.AssertEqual(numRecords+1, res.Imported)
+	tx.AssertEqual(1, res.Skipped)
+	tx.AssertEqual(0, len(res.StaleIndexes))
+	v, found, err := dstBucket.Find("test_key_000001")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(true), found)
+	tx.AssertEqual(4711, v.Int1)
+
+	e, ok, err := dst.FindRawEntry("copy", "not_json")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(true), ok)
+	tx.AssertEqual("plain text", string(e.Value))
+	tx.AssertEqual(`{"m":1}`, string(e.Meta))
+	se, _, err := store.FindRawEntry("test_type", "not_json")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(true, se.ModifiedOn.Equal(e.ModifiedOn))
+
+	e, _, err = dst.FindRawEntry("copy", "test_key_000003")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(int64(3), e.Revision)
+	var srcExpiresAt, dstExpiresAt int64
+	err = store.dbx.QueryRow("SELECT expires_at FROM data WHERE bucket = 'test_type' AND key = 'ttl_key';").Scan(&srcExpiresAt)
+	tx.AssertNoErr(err)
+	err = dst.dbx.QueryRow("SELECT expires_at FROM data WHERE bucket = 'copy' AND key = 'ttl_key';").Scan(&dstExpiresAt)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(srcExpiresAt, dstExpiresAt)
+	var blobBuf bytes.Buffer
+	_, found, err = dst.ReadBlob("copy", "test_key_000005", &blobBuf)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(true), found)
+	tx.AssertEqual(true, bytes.Equal(blob, blobBuf.Bytes()))
+
+	// path only indexes are created and filled, value func indexes are left to the typed bucket
+	_, hasIdx := dst.FindIndexDescriptor("copy", "default")
+	tx.AssertEqual(false, hasIdx)
+	keys, err := dst.QueryKeys("copy", "paths", query.Query{
+		LimitOffset: query.LO(numRecords, 0),
+		Conditions:  []query.Condition{query.C("int_3", query.ComparatorEqual, 7)},
+	})
+	tx.AssertNoErr(err)
+	tx.AssertEqual(numRecords/50, len(keys))
+
+	// typed buckets need json values
+	err = dstBucket.Delete("not_json")
+	tx.AssertNoErr(err)
+	err = dstBucket.AddOrUpdateIndex("default",
+		IF("int_2", IndexFieldInt, "v1", func(t TestStoreType) any { return t.Int2 }),
+	)
+	tx.AssertNoErr(err)
+	res, err = dst.ImportBucket(bytes.NewReader(export), ImportOptions{Policy: ImportOverwrite, Bucket: "copy"})
+	tx.AssertNoErr(err)
+	tx.AssertEqual(numRecords+2, res.Imported)
+	tx.AssertEqual(0, res.Skipped)
+	tx.AssertEqual([]string{"default"}, res.StaleIndexes)
+	v, _, err = dstBucket.Find("test_key_000001")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(1, v.Int1)
+	// revisions don't go backwards on overwrite
+	e, _, err = dst.FindRawEntry("copy", "test_key_000003")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(int64(4), e.Revision)
+	blobBuf.Reset()
+	_, _, err = dst.ReadBlob("copy", "test_key_000005", &blobBuf)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(true, bytes.Equal(blob, blobBuf.Bytes()))
+
+	// untyped saves update path indexes, but refuse buckets with value func indexes
+	err = dst.SaveRawUntyped("copy", "raw", []byte(`{"int_3":4711}`))
+	tx.AssertErr(err)
+	err = store.DeleteIndex("test_type", "default")
+	tx.AssertNoErr(err)
+	err = store.SaveRawUntyped("test_type", "raw", []byte(`{"int_3":4711}`))
+	tx.AssertNoErr(err)
+	keys, err = store.QueryKeys("test_type", "paths", query.Query{
+		LimitOffset: query.LO(10, 0),
+		Conditions:  []query.Condition{query.C("int_3", query.ComparatorEqual, 4711)},
+	})
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]string{"raw"}, keys)
+
+	_, err = dst.ImportBucket(bytes.NewReader(export), ImportOptions{Policy: "replace"})
+	tx.AssertErr(err)
+}
+
+func TestStoreUpdateTx(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testStoreUpdateTx(t, d)
+		})
+	}
+}
+
+func testStoreUpdateTx(t *testing.T, d sqlitex.Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_update_tx_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	store, err := NewSqliteXStore(filepath.Join(tmpFolderName, "test.db"), sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+	defer store.Close()
+
+	orders := NewBucket[TestStoreType](store, "orders")
+	items := NewBucket[TestStoreType](store, "items")
+	err = items.AddOrUpdateIndex("by_order",
+		IF("order_id", IndexFieldString, "v1", func(t TestStoreType) any { return t.String1 }),
+	)
+	tx.AssertNoErr(err)
+	itemsOf := func(order string) []string {
+		keys, err := store.QueryKeys("items", "by_order", query.Query{
+			LimitOffset: query.LO(100, 0),
+			Conditions:  []query.Condition{query.C("order_id", query.ComparatorEqual, order)},
+		})
+		tx.AssertNoErr(err)
+		sort.Strings(keys)
+		return keys
+	}
+	lineItems := func(order string, n int) []Tuple[string, TestStoreType] {
+		var kvs []Tuple[string, TestStoreType]
+		for i := range n {
+			key := fmt.Sprintf("%s_item_%d", order, i)
+			v := NewTestStoreType(key, i)
+			v.String1 = order
+			kvs = append(kvs, MkTuple(key, v))
+		}
+		return kvs
+	}
+
+	err = store.Update(func(utx TypedTx) error {
+		err := orders.SaveTx(utx, "o1", NewTestStoreType("o1", 1))
+		if err != nil {
+			return err
+		}
+		// uncommitted writes are visible within the tx
+		_, found, err := orders.FindTx(utx, "o1")
+		tx.AssertNoErr(err)
+		tx.AssertEqual(query.Found(true), found)
+		return items.SaveManyTx(utx, lineItems("o1", 3))
+	})
+	tx.AssertNoErr(err)
+	_, found, err := orders.Find("o1")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(true), found)
+	tx.AssertEqual([]string{"o1_item_0", "o1_item_1", "o1_item_2"}, itemsOf("o1"))
+
+	// a failing fn rolls back all buckets along with their indexes
+	errAbort := errors.New("abort")
+	err = store.Update(func(utx TypedTx) error {
+		err := orders.SaveTx(utx, "o2", NewTestStoreType("o2", 2))
+		if err != nil {
+			return err
+		}
+		err = items.SaveManyTx(utx, lineItems("o2", 2))
+		if err != nil {
+			return err
+		}
+		err = items.DeleteTx(utx, "o1_item_0")
+		if err != nil {
+			return err
+		}
+		return errAbort
+	})
+	tx.AssertEqual(true, errors.Is(err, errAbort))
+	_, found, err = orders.Find("o2")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(false), found)
+	tx.AssertEqual(0, len(itemsOf("o2")))
+	tx.AssertEqual(3, len(itemsOf("o1")))
+
+	err = store.Update(func(utx TypedTx) error {
+		err := orders.DeleteTx(utx, "o1")
+		if err != nil {
+			return err
+		}
+		return items.DeleteTx(utx, itemsOf("o1")...)
+	})
+	tx.AssertNoErr(err)
+	keys, err := store.Keys("items")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(0, len(keys))
+	tx.AssertEqual(0, len(itemsOf("o1")))
+}
+
+func TestStoreScan(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testStoreScan(t, d)
+		})
+	}
+}
+
+func testStoreScan(t *testing.T, d sqlitex.Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_scan_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	store, err := NewSqliteXStore(filepath.Join(tmpFolderName, "test.db"), sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+	defer store.Close()
+
+	bucket := NewBucket[TestStoreType](store, "test_type")
+	other := NewBucket[TestStoreType](store, "other")
+	var kvs []Tuple[string, TestStoreType]
+	for n := range 1200 {
+		key := fmt.Sprintf("a_%06d", n)
+		kvs = append(kvs, MkTuple(key, NewTestStoreType(key, n)))
+	}
+	for n := range 30 {
+		key := fmt.Sprintf("b_%06d", n)
+		kvs = append(kvs, MkTuple(key, NewTestStoreType(key, n)))
+	}
+	err = bucket.SaveMany(kvs)
+	tx.AssertNoErr(err)
+	err = other.Save("a_000001", NewTestStoreType("other", 1))
+	tx.AssertNoErr(err)
+
+	collect := func(r ScanRange) []string {
+		var keys []string
+		for kv, err := range bucket.Scan(r) {
+			tx.AssertNoErr(err)
+			tx.AssertEqual(kv.Key, kv.Value.Key)
+			keys = append(keys, kv.Key)
+		}
+		return keys
+	}
+
+	all := collect(ScanRange{})
+	tx.AssertEqual(1230, len(all))
+	tx.AssertEqual(true, sort.StringsAreSorted(all))
+
+	reverse := collect(ScanRange{Reverse: true})
+	tx.AssertEqual(1230, len(reverse))
+	tx.AssertEqual("b_000029", reverse[0])
+	tx.AssertEqual("a_000000", reverse[1229])
+
+	tx.AssertEqual(30, len(collect(ScanRange{Prefix: "b_"})))
+	tx.AssertEqual([]string{"a_000998", "a_000999", "a_001000"}, collect(ScanRange{From: "a_000998", To: "a_001001"}))
+	tx.AssertEqual([]string{"b_000002", "b_000001"}, collect(ScanRange{From: "b_000001", To: "b_000003", Reverse: true}))
+	// prefix and range are combined
+	tx.AssertEqual([]string{"b_000000", "b_000001"}, collect(ScanRange{To: "b_000002", Prefix: "b_"}))
+	tx.AssertEqual(0, len(collect(ScanRange{Prefix: "c_"})))
+
+	// early break
+	var n int
+	for _, err := range bucket.Scan(ScanRange{Prefix: "a_"}) {
+		tx.AssertNoErr(err)
+		n++
+		if n == 700 {
+			break
+		}
+	}
+	tx.AssertEqual(700, n)
+
+	var keys []string
+	for key, err := range store.ScanKeys("test_type", ScanRange{Prefix: "b_00001", Reverse: true}) {
+		tx.AssertNoErr(err)
+		keys = append(keys, key)
+	}
+	tx.AssertEqual(10, len(keys))
+	tx.AssertEqual("b_000019", keys[0])
+
+	tx.AssertEqual("ab", prefixEnd("aa"))
+	tx.AssertEqual("b", prefixEnd("a\xff"))
+	tx.AssertEqual("", prefixEnd("\xff\xff"))
+	tx.AssertEqual("", prefixEnd(""))
+}
+
+func TestStoreCompression(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testStoreCompression(t, d)
+		})
+	}
+}
+
+func testStoreCompression(t *testing.T, d sqlitex.Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_compression_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	storeFile := filepath.Join(tmpFolderName, "test.db")
+	store, err := NewSqliteXStore(storeFile, sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+
+	bucket := NewBucket[TestStoreType](store, "test_type")
+	err = bucket.AddOrUpdateIndex("default",
+		IF("int_2", IndexFieldInt, "v1", func(t TestStoreType) any { return t.Int2 }),
+	)
+	tx.AssertNoErr(err)
+	err = bucket.EnableHistory(5)
+	tx.AssertNoErr(err)
+	err = bucket.Save("plain", NewTestStoreType("plain", 1))
+	tx.AssertNoErr(err)
+	err = bucket.EnableCompression("zstd")
+	tx.AssertErr(err)
+	err = bucket.EnableCompression(CompressionGzip)
+	tx.AssertNoErr(err)
+	for n := range 20 {
+		key := fmt.Sprintf("test_key_%06d", n)
+		v := NewTestStoreType(key, n)
+		v.String3 = strings.Repeat("compressible ", 100)
+		err := bucket.Save(key, v)
+		tx.AssertNoErr(err)
+	}
+	err = bucket.Save("plain", NewTestStoreType("plain", 2))
+	tx.AssertNoErr(err)
+
+	var encoding string
+	var size int
+	err = store.dbx.QueryRow("SELECT encoding, length(value) FROM data WHERE bucket = ? AND key = ?;", "test_type", "test_key_000003").Scan(&encoding, &size)
+	tx.AssertNoErr(err)
+	tx.AssertEqual("gzip", encoding)
+	tx.AssertEqual(true, size < 500)
+
+	v, _, err := bucket.Find("test_key_000003")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(3, v.Int1)
+	raws, err := store.FindRawMany("test_type", "test_key_000001", "test_key_000002")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(true, json.Valid(raws["test_key_000001"]) && json.Valid(raws["test_key_000002"]))
+	var scanned int
+	for _, err := range bucket.Scan(ScanRange{Prefix: "test_key_"}) {
+		tx.AssertNoErr(err)
+		scanned++
+	}
+	tx.AssertEqual(20, scanned)
+	keys, err := store.QueryKeys("test_type", "default", query.Query{
+		LimitOffset: query.LO(100, 0),
+		Conditions:  []query.Condition{query.C("int_2", query.ComparatorEqual, 3)},
+	})
+	tx.AssertNoErr(err)
+	tx.AssertEqual(2, len(keys))
+	// history keeps the plain prior version readable
+	versions, err := bucket.History("plain")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(1, len(versions))
+	tx.AssertEqual(1, versions[0].Value.Int1)
+
+	// path fields can't be evaluated on compressed values
+	err = store.CreateIndex("test_type", "paths", []IndexFieldDescriptor{{Name: "int_3", Type: IndexFieldInt, Path: "$.int_3"}})
+	tx.AssertErr(err)
+	err = store.CreateIndex("other", "paths", []IndexFieldDescriptor{{Name: "int_3", Type: IndexFieldInt, Path: "$.int_3"}})
+	tx.AssertNoErr(err)
+	err = store.EnableCompression("other", CompressionGzip)
+	tx.AssertErr(err)
+
+	// compression is persisted
+	store.Close()
+	store, err = NewSqliteXStore(storeFile, sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+	defer store.Close()
+	bucket = NewBucket[TestStoreType](store, "test_type")
+	err = bucket.Save("reopened", NewTestStoreType("reopened", 7))
+	tx.AssertNoErr(err)
+	err = store.dbx.QueryRow("SELECT encoding FROM data WHERE bucket = ? AND key = ?;", "test_type", "reopened").Scan(&encoding)
+	tx.AssertNoErr(err)
+	tx.AssertEqual("gzip", encoding)
+
+	err = bucket.DisableCompression()
+	tx.AssertNoErr(err)
+	err = bucket.Save("uncompressed", NewTestStoreType("uncompressed", 8))
+	tx.AssertNoErr(err)
+	err = store.dbx.QueryRow("SELECT encoding FROM data WHERE bucket = ? AND key = ?;", "test_type", "uncompressed").Scan(&encoding)
+	tx.AssertNoErr(err)
+	tx.AssertEqual("", encoding)
+	v, _, err = bucket.Find("reopened")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(7, v.Int1)
+
+	// disabling decompresses the stored values, so path indexes see all of them
+	var compressed int
+	err = store.dbx.QueryRow("SELECT COUNT(*) FROM data WHERE bucket = ? AND encoding != '';", "test_type").Scan(&compressed)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(0, compressed)
+	err = store.CreateIndex("test_type", "paths", []IndexFieldDescriptor{{Name: "int_1", Type: IndexFieldInt, Path: "$.int_1"}})
+	tx.AssertNoErr(err)
+	err = store.RebuildIndex("test_type", "paths")
+	tx.AssertNoErr(err)
+	keys, err = store.QueryKeys("test_type", "paths", query.Query{
+		LimitOffset: query.LO(100, 0),
+		Conditions:  []query.Condition{query.C("int_1", query.ComparatorEqual, 3)},
+	})
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]string{"test_key_000003"}, keys)
+}
+
+func TestStoreBlob(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testStoreBlob(t, d)
+		})
+	}
+}
+
+func testStoreBlob(t *testing.T, d sqlitex.Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_blob_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	store, err := NewSqliteXStore(filepath.Join(tmpFolderName, "test.db"), sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+	defer store.Close()
+
+	bucket := NewBucket[TestStoreType](store, "files")
+	payload := make([]byte, 2*BlobChunkSize+1234)
+	for i := range payload {
+		payload[i] = byte(i * 7)
+	}
+	err = bucket.Save("f1", NewTestStoreType("f1", 1))
+	tx.AssertNoErr(err)
+	n, err := bucket.WriteBlob("f1", bytes.NewReader(payload))
+	tx.AssertNoErr(err)
+	tx.AssertEqual(int64(len(payload)), n)
+	var chunks int
+	err = store.dbx.QueryRow("SELECT COUNT(*) FROM blobs WHERE bucket = ? AND key = ?;", "files", "f1").Scan(&chunks)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(3, chunks)
+
+	var buf bytes.Buffer
+	n, found, err := bucket.ReadBlob("f1", &buf)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(true), found)
+	tx.AssertEqual(int64(len(payload)), n)
+	tx.AssertEqual(true, bytes.Equal(payload, buf.Bytes()))
+
+	// small reads cross chunk boundaries
+	r, found, err := bucket.OpenBlob("f1")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(true), found)
+	var read []byte
+	p := make([]byte, 1000)
+	for {
+		n, err := r.Read(p)
+		read = append(read, p[:n]...)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		tx.AssertNoErr(err)
+	}
+	r.Close()
+	tx.AssertEqual(true, bytes.Equal(payload, read))
+
+	// a blob replaced while it is read is read as it was when opened
+	r, _, err = bucket.OpenBlob("f1")
+	tx.AssertNoErr(err)
+	_, err = io.ReadFull(r, p)
+	tx.AssertNoErr(err)
+	_, err = bucket.WriteBlob("f1", strings.NewReader("replaced"))
+	tx.AssertNoErr(err)
+	rest, err := io.ReadAll(r)
+	tx.AssertNoErr(err)
+	r.Close()
+	tx.AssertEqual(true, bytes.Equal(payload, append(p, rest...)))
+	_, err = bucket.WriteBlob("f1", bytes.NewReader(payload))
+	tx.AssertNoErr(err)
+
+	_, found, err = bucket.OpenBlob("missing")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(false), found)
+	// blobs need their key
+	_, err = bucket.WriteBlob("empty", bytes.NewReader(nil))
+	tx.AssertEqual(true, errors.Is(err, ErrKeyNotFound))
+	err = bucket.Save("empty", NewTestStoreType("empty", 2))
+	tx.AssertNoErr(err)
+	_, err = bucket.WriteBlob("empty", bytes.NewReader(nil))
+	tx.AssertNoErr(err)
+	buf.Reset()
+	n, found, err = bucket.ReadBlob("empty", &buf)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(true), found)
+	tx.AssertEqual(int64(0), n)
+
+	// replaced within a rolled back tx
+	errAbort := errors.New("abort")
+	err = store.Update(func(utx TypedTx) error {
+		_, err := bucket.WriteBlobTx(utx, "f1", strings.NewReader("replaced"))
+		tx.AssertNoErr(err)
+		return errAbort
+	})
+	tx.AssertEqual(true, errors.Is(err, errAbort))
+	buf.Reset()
+	_, _, err = bucket.ReadBlob("f1", &buf)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(len(payload), buf.Len())
+
+	// blobs are deleted along with their key
+	err = bucket.Delete("f1")
+	tx.AssertNoErr(err)
+	_, found, err = bucket.OpenBlob("f1")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(false), found)
+}
+
+func TestStoreInMemory(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testStoreInMemory(t, d)
+		})
+	}
+}
+
+func testStoreInMemory(t *testing.T, d sqlitex.Driver) {
+	tx := testx.NewTx(t)
+
+	store, err := NewSqliteXStore(fmt.Sprintf("test_in_memory_%s", d), sqlitex.WithDriver(d), sqlitex.WithInMemory())
+	tx.AssertNoErr(err)
+	defer store.Close()
+	settings, err := store.Settings(context.Background())
+	tx.AssertNoErr(err)
+	tx.AssertEqual(true, settings.InMemory)
+
+	bucket := NewBucket[TestStoreType](store, "test_type")
+	err = bucket.AddOrUpdateIndex("default",
+		IF("int_2", IndexFieldString, "v1", func(t TestStoreType) any { return t.Int2 }),
+	)
+	tx.AssertNoErr(err)
+	for n := range 50 {
+		key := fmt.Sprintf("test_key_%06d", n)
+		err := bucket.Save(key, NewTestStoreType(key, n+1))
+		tx.AssertNoErr(err)
+	}
+	v, found, err := bucket.Find("test_key_000007")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(true), found)
+	tx.AssertEqual(NewTestStoreType("test_key_000007", 8), v)
+	vs, err := bucket.Query("default", query.Query{
+		LimitOffset: query.LO(100, 0),
+		Conditions:  []query.Condition{query.C("int_2", query.ComparatorEqual, 5)},
+	})
+	tx.AssertNoErr(err)
+	tx.AssertEqual(5, len(vs))
+}
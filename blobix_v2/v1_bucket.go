@@ -0,0 +1,354 @@
+package blobix_v2
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mazzegi/mbox/blobix"
+	"github.com/mazzegi/mbox/query"
+	"github.com/mazzegi/mbox/slicesx"
+)
+
+// V1Store provides blobix v1 buckets on top of a v2 store, so v1 call sites keep working after MigrateV1
+type V1Store struct {
+	store *SqliteXStore
+}
+
+var _ blobix.Store = (*V1Store)(nil)
+
+func NewV1Store(store *SqliteXStore) *V1Store {
+	return &V1Store{store: store}
+}
+
+func (s *V1Store) Close() {
+	s.store.Close()
+}
+
+func (s *V1Store) Bucket(name string) blobix.Bucket {
+	return NewV1Bucket(s.store, name)
+}
+
+// V1Bucket implements blobix.Bucket on top of a v2 store. Indexes are maintained by evaluating the v1 json paths,
+// indexes of the bucket without v1 paths are left untouched.
+type V1Bucket struct {
+	store Store
+	name  string
+}
+
+var _ blobix.Bucket = (*V1Bucket)(nil)
+var _ blobix.IndexQuerier = (*V1Bucket)(nil)
+
+func NewV1Bucket(store Store, name string) *V1Bucket {
+	return &V1Bucket{
+		store: store,
+		name:  name,
+	}
+}
+
+type v1Index struct {
+	desc IndexDescriptor
+}
+
+func (ix v1Index) Fields() []string {
+	return slicesx.Map(ix.desc.Fields, func(f IndexFieldDescriptor) string {
+		return f.Name
+	})
+}
+
+func isV1Index(desc IndexDescriptor) bool {
+	for _, f := range desc.Fields {
+		if _, ok := v1Path(f); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func v1IndexValues(desc IndexDescriptor, value any) map[string]any {
+	values := map[string]any{}
+	for _, f := range desc.Fields {
+		path, _ := v1Path(f)
+		val, err := blobix.JSONQuery(value, path)
+		if err != nil {
+			values[f.Name] = nil
+			continue
+		}
+		values[f.Name] = val
+	}
+	return values
+}
+
+func (b *V1Bucket) updateIndexes(tx Tx, key string, value any) error {
+	for _, desc := range b.store.IndexDescriptors(b.name) {
+		if !isV1Index(desc) {
+			continue
+		}
+		err := tx.UpdateIndex(b.name, desc.IndexName, key, v1IndexValues(desc, value))
+		if err != nil {
+			return fmt.Errorf("update-index %q: %w", desc.IndexName, err)
+		}
+	}
+	return nil
+}
+
+// updateV1Indexes updates the v1 indexes of bucket from raw, which is indexed as string if it's no json
+func (stx *sqliteXStoreTx) updateV1Indexes(bucket string, key string, raw []byte) error {
+	var value any
+	for _, desc := range stx.store.IndexDescriptors(bucket) {
+		if !isV1Index(desc) {
+			continue
+		}
+		if value == nil {
+			err := json.Unmarshal(raw, &value)
+			if err != nil {
+				value = string(raw)
+			}
+		}
+		err := stx.UpdateIndex(bucket, desc.IndexName, key, v1IndexValues(desc, value))
+		if err != nil {
+			return fmt.Errorf("update-index %q: %w", desc.IndexName, err)
+		}
+	}
+	return nil
+}
+
+func (b *V1Bucket) PutJSONMany(ts ...blobix.Tuple[string, any]) error {
+	tx, err := b.store.BeginTx()
+	if err != nil {
+		return fmt.Errorf("begin-tx: %w", err)
+	}
+	for _, t := range ts {
+		raw, err := json.Marshal(t.Value)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("json.marshal value: %w", err)
+		}
+		err = tx.SaveRaw(b.name, t.Key, raw)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("save-raw: %w", err)
+		}
+		err = b.updateIndexes(tx, t.Key, t.Value)
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("update-indexes: %w", err)
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func (b *V1Bucket) PutJSON(key string, value any) error {
+	return b.PutJSONWithMeta(key, value, nil)
+}
+
+func (b *V1Bucket) PutJSONWithMeta(key string, value any, meta any) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("json.marshal value: %w", err)
+	}
+	return b.put(key, raw, meta, value)
+}
+
+func (b *V1Bucket) PutStringWithMeta(key string, value string, meta any) error {
+	return b.put(key, []byte(value), meta, value)
+}
+
+func (b *V1Bucket) put(key string, raw []byte, meta any, indexValue any) error {
+	var metabs []byte
+	var err error
+	if meta != nil {
+		metabs, err = json.Marshal(meta)
+		if err != nil {
+			return fmt.Errorf("json.marshal meta: %w", err)
+		}
+	}
+	tx, err := b.store.BeginTx()
+	if err != nil {
+		return fmt.Errorf("begin-tx: %w", err)
+	}
+	err = tx.SaveRawWithMeta(b.name, key, raw, metabs)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("save-raw-with-meta: %w", err)
+	}
+	err = b.updateIndexes(tx, key, indexValue)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("update-indexes: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// JSON returns sql.ErrNoRows if key doesn't exist, like blobix v1 does
+func (b *V1Bucket) JSON(key string, v any) (blobix.QueryResult, error) {
+	e, found, err := b.store.FindRawEntry(b.name, key)
+	if err != nil {
+		return blobix.QueryResult{}, fmt.Errorf("find-raw-entry: %w", err)
+	}
+	if !found {
+		return blobix.QueryResult{}, sql.ErrNoRows
+	}
+	err = json.Unmarshal(e.Value, v)
+	if err != nil {
+		return blobix.QueryResult{}, fmt.Errorf("json.unmarshal value: %w", err)
+	}
+	return blobix.QueryResult{
+		ModifiedOn: e.ModifiedOn,
+		Meta:       json.RawMessage(e.Meta),
+	}, nil
+}
+
+func (b *V1Bucket) RawValues(keys ...string) (map[string]string, error) {
+	rvs, err := b.store.FindRawMany(b.name, keys...)
+	if err != nil {
+		return nil, fmt.Errorf("find-raw-many: %w", err)
+	}
+	svs := make(map[string]string, len(rvs))
+	for k, rv := range rvs {
+		svs[k] = string(rv)
+	}
+	return svs, nil
+}
+
+func (b *V1Bucket) Delete(keys ...string) error {
+	tx, err := b.store.BeginTx()
+	if err != nil {
+		return fmt.Errorf("begin-tx: %w", err)
+	}
+	err = tx.Delete(b.name, keys...)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("delete: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func (b *V1Bucket) Clear() error {
+	keys, err := b.store.Keys(b.name)
+	if err != nil {
+		return fmt.Errorf("keys: %w", err)
+	}
+	return b.Delete(keys...)
+}
+
+func (b *V1Bucket) Keys() ([]string, error) {
+	return b.store.Keys(b.name)
+}
+
+func (b *V1Bucket) KeysPage(skip, limit int, sort query.SortOrder) ([]string, error) {
+	return b.store.KeysPage(b.name, skip, limit, sort)
+}
+
+func (b *V1Bucket) KeysWithPrefixPage(prefix string, skip, limit int, sort query.SortOrder) ([]string, error) {
+	return b.store.KeysWithPrefixPage(b.name, prefix, skip, limit, sort)
+}
+
+func (b *V1Bucket) ExistsKey(key string) bool {
+	_, found, err := b.store.FindRaw(b.name, key)
+	return err == nil && bool(found)
+}
+
+func (b *V1Bucket) KeysWithPrefix(prefix string) ([]string, error) {
+	return b.store.KeysWithPrefixPage(b.name, prefix, 0, -1, query.SortASC)
+}
+
+func (b *V1Bucket) AddIndex(name string, fields ...blobix.IndexField) (blobix.Index, error) {
+	desc := V1IndexDescriptor(b.name, name, fields...)
+	existing, ok := b.store.FindIndexDescriptor(b.name, name)
+	if ok {
+		if !IndexDescriptorsEqual(existing, desc) {
+			return nil, fmt.Errorf("index already exists - but has different meta data")
+		}
+		return v1Index{desc: existing}, nil
+	}
+	err := b.store.CreateIndex(b.name, name, desc.Fields)
+	if err != nil {
+		return nil, fmt.Errorf("store.create-index %q: %w", name, err)
+	}
+	return v1Index{desc: desc}, nil
+}
+
+func (b *V1Bucket) AddOrUpdateIndex(name string, fields ...blobix.IndexField) (blobix.Index, error) {
+	desc := V1IndexDescriptor(b.name, name, fields...)
+	existing, ok := b.store.FindIndexDescriptor(b.name, name)
+	if ok && IndexDescriptorsEqual(existing, desc) {
+		return v1Index{desc: existing}, nil
+	}
+	if ok {
+		err := b.store.DeleteIndex(b.name, name)
+		if err != nil {
+			return nil, fmt.Errorf("store.delete-index %q: %w", name, err)
+		}
+	}
+	err := b.store.CreateIndex(b.name, name, desc.Fields)
+	if err != nil {
+		return nil, fmt.Errorf("store.create-index %q: %w", name, err)
+	}
+	err = b.RebuildIndex(name)
+	if err != nil {
+		return nil, fmt.Errorf("rebuild-index: %w", err)
+	}
+	return v1Index{desc: desc}, nil
+}
+
+func (b *V1Bucket) DeleteIndex(name string) error {
+	return b.store.DeleteIndex(b.name, name)
+}
+
+// RebuildIndex evaluates the index paths on the values decoded into map[string]any, like blobix v1 does
+func (b *V1Bucket) RebuildIndex(name string) error {
+	desc, ok := b.store.FindIndexDescriptor(b.name, name)
+	if !ok {
+		return fmt.Errorf("index not found (%s:%s)", b.name, name)
+	}
+	if !isV1Index(desc) {
+		return fmt.Errorf("index %s:%s has no v1 paths", b.name, name)
+	}
+	return b.store.RebuildIndexOnline(context.Background(), b.name, name, func(key string, e RawEntry) (map[string]any, error) {
+		var val map[string]any
+		err := json.Unmarshal(e.Value, &val)
+		if err != nil {
+			return nil, fmt.Errorf("json.unmarshal: %w", err)
+		}
+		return v1IndexValues(desc, val), nil
+	}, nil)
+}
+
+func (b *V1Bucket) Index(name string) (blobix.Index, error) {
+	desc, ok := b.store.FindIndexDescriptor(b.name, name)
+	if !ok {
+		return nil, fmt.Errorf("no such index: bucket:%s,name:%s", b.name, name)
+	}
+	return v1Index{desc: desc}, nil
+}
+
+func (b *V1Bucket) QueryKeys(indexName string, lo query.LimitOffset, fields []query.Condition, sorts []query.Sort, search query.Search) ([]string, error) {
+	return b.QueryIndexKeys(indexName, query.Query{
+		LimitOffset: lo,
+		Conditions:  fields,
+		Sorts:       sorts,
+		Search:      search,
+	})
+}
+
+func (b *V1Bucket) QueryIndexKeys(indexName string, q query.Query) ([]string, error) {
+	return b.store.QueryKeys(b.name, indexName, q)
+}
+
+func (b *V1Bucket) QueryDistinct(indexName string, field string) ([]string, error) {
+	return b.store.QueryDistinct(b.name, indexName, field)
+}
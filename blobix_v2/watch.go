@@ -0,0 +1,156 @@
+package blobix_v2
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type ChangeType string
+
+const (
+	ChangePut    ChangeType = "put"
+	ChangeDelete ChangeType = "delete"
+)
+
+// ChangeEvent is emitted after a transaction which changed a key was committed.
+// Value is only set for puts and if the watcher was created with WithValues.
+type ChangeEvent struct {
+	Type       ChangeType
+	Bucket     string
+	Key        string
+	ModifiedOn time.Time
+	Value      []byte
+}
+
+type WatchOptions struct {
+	// BufferSize is the capacity of the event channel. Events which don't fit are dropped. Defaults to 64.
+	BufferSize int
+	WithValues bool
+}
+
+// Watcher receives change events of a bucket on C. C is closed when the context of the watch is done,
+// the watcher is closed or the store is closed.
+// Events are never blocked on: if C is full, they are dropped and counted in Dropped.
+// Consumers which need every change should check Dropped after receiving and resync, e.g. by reading the keys again, if it grew.
+type Watcher struct {
+	C          <-chan ChangeEvent
+	c          chan ChangeEvent
+	bucket     string
+	keyPrefix  string
+	withValues bool
+	dropped    atomic.Uint64
+	hub        *watchHub
+	done       chan struct{}
+}
+
+// Dropped returns the number of events which were dropped because the buffer was full
+func (w *Watcher) Dropped() uint64 {
+	return w.dropped.Load()
+}
+
+func (w *Watcher) Close() {
+	w.hub.remove(w)
+}
+
+func (w *Watcher) matches(evt ChangeEvent) bool {
+	return evt.Bucket == w.bucket && strings.HasPrefix(evt.Key, w.keyPrefix)
+}
+
+type watchHub struct {
+	sync.RWMutex
+	watchers map[*Watcher]bool
+	closed   bool
+}
+
+func newWatchHub() *watchHub {
+	return &watchHub{
+		watchers: map[*Watcher]bool{},
+	}
+}
+
+func (h *watchHub) watch(ctx context.Context, bucket string, keyPrefix string, opts *WatchOptions) *Watcher {
+	o := WatchOptions{BufferSize: 64}
+	if opts != nil {
+		o = *opts
+		if o.BufferSize <= 0 {
+			o.BufferSize = 64
+		}
+	}
+	c := make(chan ChangeEvent, o.BufferSize)
+	w := &Watcher{
+		C:          c,
+		c:          c,
+		bucket:     bucket,
+		keyPrefix:  keyPrefix,
+		withValues: o.WithValues,
+		hub:        h,
+		done:       make(chan struct{}),
+	}
+
+	h.Lock()
+	defer h.Unlock()
+	if h.closed {
+		close(c)
+		return w
+	}
+	h.watchers[w] = true
+	go func() {
+		select {
+		case <-ctx.Done():
+			h.remove(w)
+		case <-w.done:
+		}
+	}()
+	return w
+}
+
+func (h *watchHub) remove(w *Watcher) {
+	h.Lock()
+	defer h.Unlock()
+	if _, ok := h.watchers[w]; ok {
+		delete(h.watchers, w)
+		close(w.c)
+		close(w.done)
+	}
+}
+
+func (h *watchHub) close() {
+	h.Lock()
+	defer h.Unlock()
+	h.closed = true
+	for w := range h.watchers {
+		close(w.c)
+		close(w.done)
+	}
+	h.watchers = map[*Watcher]bool{}
+}
+
+func (h *watchHub) publish(evts []ChangeEvent) {
+	if len(evts) == 0 {
+		return
+	}
+	h.RLock()
+	defer h.RUnlock()
+	for w := range h.watchers {
+		for _, evt := range evts {
+			if !w.matches(evt) {
+				continue
+			}
+			if w.withValues {
+				// every watcher gets its own copy, so consumers may modify it
+				evt.Value = bytes.Clone(evt.Value)
+			} else {
+				evt.Value = nil
+			}
+			select {
+			case w.c <- evt:
+			default:
+				w.dropped.Add(1)
+			}
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package clock
 
 import (
+	"database/sql/driver"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -135,3 +136,27 @@ func (c *Clock) UnmarshalJSON(data []byte) error {
 	*c = dc
 	return nil
 }
+
+// Value stores clocks as text like 15:04:05
+func (c Clock) Value() (driver.Value, error) {
+	return c.Format(), nil
+}
+
+// Scan reads clocks from text in any of the parse layouts or from times. NULL is the zero clock.
+func (c *Clock) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*c = Zero
+	case time.Time:
+		*c = FromTime(v)
+	case string, []byte:
+		dc, err := Parse(fmt.Sprintf("%s", v))
+		if err != nil {
+			return err
+		}
+		*c = dc
+	default:
+		return fmt.Errorf("cannot scan %T into clock", src)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+// Command blobix inspects and maintains the buckets of a blobix_v2 store
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/mazzegi/mbox/blobix_v2"
+	"github.com/mazzegi/mbox/query"
+)
+
+const usage = `usage: blobix -db <file> <command> [args]
+
+commands:
+  buckets                          list all buckets
+  keys [-prefix p] [-limit n] <bucket>
+                                   list keys of bucket
+  get <bucket> <key>               print the value of key
+  put <bucket> <key> [value]       save a json value, read from stdin if omitted.
+                                   fails if the bucket has indexes with value func fields
+  indexes <bucket>                 list index definitions of bucket
+  query [-limit n] <bucket> <index> <expr>
+                                   print keys matching a query expression like "int_1 gt 5 order by int_1 desc"
+  export <bucket> [file]           export bucket as ndjson to file or stdout
+  import [-policy merge|overwrite] [-bucket b] [file]
+                                   import an export from file or stdin
+`
+
+func main() {
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	dbFile := flag.String("db", "", "store file")
+	flag.Parse()
+	if *dbFile == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	store, err := blobix_v2.NewSqliteXStore(*dbFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "open store %q: %v\n", *dbFile, err)
+		os.Exit(1)
+	}
+	err = run(store, flag.Arg(0), flag.Args()[1:])
+	store.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", flag.Arg(0), err)
+		os.Exit(1)
+	}
+}
+
+func run(store *blobix_v2.SqliteXStore, cmd string, args []string) error {
+	switch cmd {
+	case "buckets":
+		return runBuckets(store)
+	case "keys":
+		return runKeys(store, args)
+	case "get":
+		return runGet(store, args)
+	case "put":
+		return runPut(store, args)
+	case "indexes":
+		return runIndexes(store, args)
+	case "query":
+		return runQuery(store, args)
+	case "export":
+		return runExport(store, args)
+	case "import":
+		return runImport(store, args)
+	default:
+		return fmt.Errorf("unknown command")
+	}
+}
+
+func runBuckets(store *blobix_v2.SqliteXStore) error {
+	buckets, err := store.Buckets()
+	if err != nil {
+		return err
+	}
+	for _, b := range buckets {
+		fmt.Println(b)
+	}
+	return nil
+}
+
+func runKeys(store *blobix_v2.SqliteXStore, args []string) error {
+	fs := flag.NewFlagSet("keys", flag.ExitOnError)
+	prefix := fs.String("prefix", "", "key prefix")
+	limit := fs.Int("limit", -1, "max number of keys, all if negative")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expect <bucket>")
+	}
+	keys, err := store.KeysWithPrefixPage(fs.Arg(0), *prefix, 0, *limit, query.SortASC)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		fmt.Println(k)
+	}
+	return nil
+}
+
+func runGet(store *blobix_v2.SqliteXStore, args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("expect <bucket> <key>")
+	}
+	raw, found, err := store.FindRaw(args[0], args[1])
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no key %q in bucket %q", args[1], args[0])
+	}
+	fmt.Println(string(raw))
+	return nil
+}
+
+func runPut(store *blobix_v2.SqliteXStore, args []string) error {
+	var raw []byte
+	switch len(args) {
+	case 2:
+		var err error
+		raw, err = io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("read stdin: %w", err)
+		}
+	case 3:
+		raw = []byte(args[2])
+	default:
+		return fmt.Errorf("expect <bucket> <key> [value]")
+	}
+	if !json.Valid(raw) {
+		return fmt.Errorf("value is no valid json")
+	}
+	return store.SaveRawUntyped(args[0], args[1], raw)
+}
+
+func runIndexes(store *blobix_v2.SqliteXStore, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("expect <bucket>")
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(store.IndexDescriptors(args[0]))
+}
+
+func runQuery(store *blobix_v2.SqliteXStore, args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	limit := fs.Int("limit", 100, "default limit, if the expression has none")
+	fs.Parse(args)
+	if fs.NArg() != 3 {
+		return fmt.Errorf("expect <bucket> <index> <expr>")
+	}
+	bucket, idxName, expr := fs.Arg(0), fs.Arg(1), fs.Arg(2)
+	idx, ok := store.FindIndexDescriptor(bucket, idxName)
+	if !ok {
+		return fmt.Errorf("no index %q in bucket %q", idxName, bucket)
+	}
+	schema := query.NewSchema(indexSchemaFields(idx)...).WithLimits(*limit, 0)
+	q, err := query.ParseExpr(expr, schema)
+	if err != nil {
+		return fmt.Errorf("parse %q: %w", expr, err)
+	}
+	keys, err := store.QueryKeys(bucket, idxName, q)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		fmt.Println(k)
+	}
+	return nil
+}
+
+func indexSchemaFields(idx blobix_v2.IndexDescriptor) []query.SchemaField {
+	var sfs []query.SchemaField
+	for _, f := range idx.Fields {
+		switch f.Type {
+		case blobix_v2.IndexFieldInt:
+			sfs = append(sfs, query.SF(f.Name, query.FieldInt))
+		case blobix_v2.IndexFieldFloat:
+			sfs = append(sfs, query.SF(f.Name, query.FieldFloat))
+		default:
+			sfs = append(sfs, query.SF(f.Name, query.FieldString))
+		}
+	}
+	return sfs
+}
+
+func runExport(store *blobix_v2.SqliteXStore, args []string) error {
+	var w io.Writer = os.Stdout
+	switch len(args) {
+	case 1:
+	case 2:
+		f, err := os.Create(args[1])
+		if err != nil {
+			return fmt.Errorf("create %q: %w", args[1], err)
+		}
+		defer f.Close()
+		w = f
+	default:
+		return fmt.Errorf("expect <bucket> [file]")
+	}
+	n, err := store.ExportBucket(args[0], w)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d keys\n", n)
+	return nil
+}
+
+func runImport(store *blobix_v2.SqliteXStore, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	policy := fs.String("policy", string(blobix_v2.ImportMerge), "merge keeps existing keys, overwrite replaces them")
+	bucket := fs.String("bucket", "", "target bucket, if not the exported one")
+	fs.Parse(args)
+	var r io.Reader = os.Stdin
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		f, err := os.Open(fs.Arg(0))
+		if err != nil {
+			return fmt.Errorf("open %q: %w", fs.Arg(0), err)
+		}
+		defer f.Close()
+		r = f
+	default:
+		return fmt.Errorf("expect [file]")
+	}
+	res, err := store.ImportBucket(bufio.NewReader(r), blobix_v2.ImportOptions{
+		Policy: blobix_v2.ImportPolicy(*policy),
+		Bucket: *bucket,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "imported %d keys into %q, skipped %d\n", res.Imported, res.Bucket, res.Skipped)
+	for _, idx := range res.StaleIndexes {
+		fmt.Fprintf(os.Stderr, "index %q has to be rebuilt by its application\n", idx)
+	}
+	return nil
+}
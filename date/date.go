@@ -1,6 +1,7 @@
 package date
 
 import (
+	"database/sql/driver"
 	"encoding/json"
 	"fmt"
 	"time"
@@ -245,3 +246,27 @@ func NumDays(from Date, to Date) int {
 	}
 	return 1 + int(to.Sub(from).Round(24*time.Hour).Hours())/24
 }
+
+// Value stores dates as canonical text
+func (d Date) Value() (driver.Value, error) {
+	return d.CanonicalString(), nil
+}
+
+// Scan reads dates from text in any of the parse layouts or from times. NULL is the zero date.
+func (d *Date) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*d = Date{}
+	case time.Time:
+		*d = FromTime(v)
+	case string, []byte:
+		dt, err := Parse(fmt.Sprintf("%s", v))
+		if err != nil {
+			return err
+		}
+		*d = dt
+	default:
+		return fmt.Errorf("cannot scan %T into date", src)
+	}
+	return nil
+}
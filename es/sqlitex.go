@@ -9,13 +9,17 @@ import (
 	"time"
 
 	"github.com/mazzegi/log"
+	"github.com/mazzegi/mbox/query"
 	"github.com/mazzegi/mbox/slicesx"
+	"github.com/mazzegi/mbox/sqlb"
 	"github.com/mazzegi/mbox/sqlitex"
-	"github.com/mazzegi/mbox/sqlx"
 )
 
-func NewSqliteXStore(file string) (*SqliteXStore, error) {
-	db, err := sqlitex.NewDB(file)
+// NewSqliteXStore opens the store with synchronous OFF, as events are written at high rates.
+// Pass sqlitex.WithSynchronous to trade speed for durability.
+func NewSqliteXStore(file string, opts ...sqlitex.Option) (*SqliteXStore, error) {
+	opts = append([]sqlitex.Option{sqlitex.WithSynchronous(sqlitex.SynchronousOff)}, opts...)
+	db, err := sqlitex.NewDB(file, opts...)
 	if err != nil {
 		return nil, fmt.Errorf("new-db %q: %w", file, err)
 	}
@@ -42,9 +46,9 @@ func NewSqliteXStore(file string) (*SqliteXStore, error) {
 }
 
 func (s *SqliteXStore) init() error {
-	_, err := s.db.Exec(v1_init)
+	err := sqlitex.Migrate(s.db, sqlitexMigrations)
 	if err != nil {
-		return fmt.Errorf("exec v1_init: %w", err)
+		return fmt.Errorf("migrate: %w", err)
 	}
 	return nil
 }
@@ -55,6 +59,16 @@ func (s *SqliteXStore) Close() {
 	s.db.Close()
 }
 
+// Backup writes a consistent copy of the store to dstPath while it is in use
+func (s *SqliteXStore) Backup(ctx context.Context, dstPath string) error {
+	return s.db.Backup(ctx, dstPath)
+}
+
+// Settings returns the effective connection settings of the store
+func (s *SqliteXStore) Settings(ctx context.Context) (sqlitex.Settings, error) {
+	return s.db.Settings(ctx)
+}
+
 type SqliteXStore struct {
 	*log.Hook
 	db         *sqlitex.DB
@@ -90,8 +104,17 @@ func (s *SqliteXStore) Subscribe(streamID StreamID) *StreamUpdateSubscription {
 	return s.publisher.Subscribe(streamID)
 }
 
+// queryRower is implemented by sqlitex.DB and sql.Tx, so versions can be read within write transactions
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
 func (s *SqliteXStore) StreamVersion(streamID StreamID) uint64 {
-	row := s.db.QueryRow("SELECT MAX(stream_index)+1 FROM events WHERE stream_id = ?;", streamID)
+	return streamVersion(s.db, streamID)
+}
+
+func streamVersion(q queryRower, streamID StreamID) uint64 {
+	row := q.QueryRow("SELECT MAX(stream_index)+1 FROM events WHERE stream_id = ?;", streamID)
 	var ver uint64
 	err := row.Scan(&ver)
 	if err != nil {
@@ -101,7 +124,11 @@ func (s *SqliteXStore) StreamVersion(streamID StreamID) uint64 {
 }
 
 func (s *SqliteXStore) StoreVersion() uint64 {
-	row := s.db.QueryRow("SELECT MAX(store_index)+1 FROM events;")
+	return storeVersion(s.db)
+}
+
+func storeVersion(q queryRower) uint64 {
+	row := q.QueryRow("SELECT MAX(store_index)+1 FROM events;")
 	var ver uint64
 	err := row.Scan(&ver)
 	if err != nil {
@@ -111,13 +138,13 @@ func (s *SqliteXStore) StoreVersion() uint64 {
 }
 
 func (s *SqliteXStore) Append(streamID StreamID, expectedVersion uint64, events ...RawEvent) error {
-	err := sqlx.Transact(s.db, func(tx *sql.Tx) error {
-		streamVer := s.StreamVersion(streamID)
+	err := s.db.WriteTx(context.Background(), func(tx *sql.Tx) error {
+		streamVer := streamVersion(tx, streamID)
 		if streamVer != expectedVersion {
 			return NewExpectedVersionError(expectedVersion, streamVer)
 		}
 
-		storeVer := s.StoreVersion()
+		storeVer := storeVersion(tx)
 		for _, e := range events {
 			_, err := tx.Stmt(s.statements.insertEvents).Exec(
 				e.ID,
@@ -145,10 +172,10 @@ func (s *SqliteXStore) Append(streamID StreamID, expectedVersion uint64, events
 }
 
 func (s *SqliteXStore) Create(events ...RawEvent) error {
-	err := sqlx.Transact(s.db, func(tx *sql.Tx) error {
-		storeVer := s.StoreVersion()
+	err := s.db.WriteTx(context.Background(), func(tx *sql.Tx) error {
+		storeVer := storeVersion(tx)
 		for _, e := range events {
-			streamVer := s.StreamVersion(StreamID(e.StreamID))
+			streamVer := streamVersion(tx, StreamID(e.StreamID))
 			_, err := tx.Stmt(s.statements.insertEvents).Exec(
 				e.ID,
 				storeVer,
@@ -204,84 +231,73 @@ func (s *SqliteXStore) Find(id ID) (RawEvent, bool) {
 	}, true
 }
 
-func (s *SqliteXStore) Query(params QueryParams, lo LimitOffset) (RawEvents, error) {
-	var sort string
-	if params.SortASC {
-		sort = "ASC"
-	} else {
-		sort = "DESC"
-	}
+var eventColumns = map[string]string{
+	"id":           "id",
+	"store_index":  "store_index",
+	"stream_id":    "stream_id",
+	"stream_index": "stream_index",
+	"occurred_on":  "occurred_on",
+	"recorded_on":  "recorded_on",
+	"type":         "type",
+}
+
+var eventWhereOptions = query.SQLWhereOptions{
+	Column: func(name string) (string, error) {
+		col, ok := eventColumns[name]
+		if !ok {
+			return "", fmt.Errorf("no such event column %q", name)
+		}
+		return col, nil
+	},
+	Value: func(val any) (any, error) {
+		if tim, ok := val.(time.Time); ok {
+			return formatTime(tim), nil
+		}
+		return val, nil
+	},
+	ParamPrefix: "f",
+}
 
-	var wheres []string
-	args := []any{}
+func (s *SqliteXStore) queryWheres(params QueryParams) []sqlb.Cond {
+	var wheres []sqlb.Cond
 	if params.StreamID != string(StreamIDAll) && params.StreamID != "" {
-		wheres = append(wheres, "stream_id = ?")
-		args = append(args, params.StreamID)
+		wheres = append(wheres, sqlb.Eq("stream_id", params.StreamID))
 	}
 	if !params.ToDate.IsZero() {
-		wheres = append(wheres, "occurred_on <= ?")
-		args = append(args, params.ToDate)
+		wheres = append(wheres, sqlb.Le("occurred_on", formatTime(params.ToDate)))
 	}
 	if params.Type != "" {
-		wheres = append(wheres, "type = ?")
-		args = append(args, params.Type)
-	}
-	args = append(args, lo.Offset, lo.Limit)
-	var where string
-	if len(wheres) > 0 {
-		where = "WHERE " + strings.Join(wheres, " AND ")
+		wheres = append(wheres, sqlb.Eq("type", params.Type))
 	}
-	stmt := fmt.Sprintf(`SELECT id, store_index, stream_id, stream_index, occurred_on, recorded_on, type, data 
-		FROM events %s ORDER BY store_index %s LIMIT ?,?;`, where, sort)
-
-	rows, err := s.db.Query(stmt, args...)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
+	return append(wheres, sqlb.Filter(params.Filter, eventWhereOptions))
+}
 
-	res := RawEvents{}
-	for rows.Next() {
-		evt, err := s.scanEvent(rows)
-		if err != nil {
-			return nil, err
-		}
-		res = append(res, evt)
-	}
-	return res, nil
+func (s *SqliteXStore) Query(params QueryParams, lo LimitOffset) (RawEvents, error) {
+	return s.query(s.queryWheres(params), params.SortASC, lo)
 }
 
 func (s *SqliteXStore) QueryWithTypePrefix(prefix string, params QueryParams, lo LimitOffset) (RawEvents, error) {
-	var sort string
-	if params.SortASC {
-		sort = "ASC"
-	} else {
-		sort = "DESC"
+	wheres := s.queryWheres(params)
+	if params.Type == "" {
+		wheres = append(wheres, sqlb.HasPrefix("type", prefix+":"))
 	}
+	return s.query(wheres, params.SortASC, lo)
+}
 
-	var wheres []string
-	args := []any{}
-	if params.StreamID != string(StreamIDAll) && params.StreamID != "" {
-		wheres = append(wheres, "stream_id = ?")
-		args = append(args, params.StreamID)
-	}
-	if !params.ToDate.IsZero() {
-		wheres = append(wheres, "occurred_on <= ?")
-		args = append(args, params.ToDate)
-	}
-	if params.Type != "" {
-		wheres = append(wheres, "type = ?")
-		args = append(args, params.Type)
-	} else {
-		wheres = append(wheres, fmt.Sprintf("type like '%s:%%'", prefix))
-	}
-	args = append(args, lo.Offset, lo.Limit)
-	var where string
-	if len(wheres) > 0 {
-		where = "WHERE " + strings.Join(wheres, " AND ")
+func (s *SqliteXStore) query(wheres []sqlb.Cond, sortASC bool, lo LimitOffset) (RawEvents, error) {
+	sort := query.SortDESC
+	if sortASC {
+		sort = query.SortASC
+	}
+	stmt, args, err := sqlb.Select("id", "store_index", "stream_id", "stream_index", "occurred_on", "recorded_on", "type", "data").
+		From("events").
+		Where(wheres...).
+		OrderBy("store_index", sort).
+		Limit(int(lo.Limit), int(lo.Offset)).
+		Build()
+	if err != nil {
+		return nil, fmt.Errorf("build: %w", err)
 	}
-	stmt := fmt.Sprintf(`SELECT id, store_index, stream_id, stream_index, occurred_on, recorded_on, type, data 
-		FROM events %s ORDER BY store_index %s LIMIT ?,?;`, where, sort)
 
 	rows, err := s.db.Query(stmt, args...)
 	if err != nil {
@@ -507,10 +523,13 @@ func (s *SqliteXStore) AllStreamIDs() ([]StreamID, error) {
 	return res, nil
 }
 
-const v1_init = `
-PRAGMA journal_mode=WAL;
-PRAGMA synchronous = OFF;
+// sqlitexMigrations evolve the event store schema. Released migrations must not be changed, add new ones instead.
+var sqlitexMigrations = []sqlitex.Migration{
+	{Version: 1, Name: "init", SQL: v1_init},
+}
 
+// pragmas can't change within the transactions of migrations
+const v1_init = `
 CREATE TABLE IF NOT EXISTS events (
 	id				TEXT,
 	store_index		INTEGER,
@@ -0,0 +1,128 @@
+package es
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mazzegi/mbox/query"
+	"github.com/mazzegi/mbox/sqlitex"
+	"github.com/mazzegi/mbox/testx"
+)
+
+func TestSqliteXStoreQueryFilter(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testSqliteXStoreQueryFilter(t, d)
+		})
+	}
+}
+
+func testSqliteXStoreQueryFilter(t *testing.T, d sqlitex.Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_query_filter_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	store, err := NewSqliteXStore(filepath.Join(tmpFolderName, "events.db"), sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+	defer store.Close()
+
+	for n := range 10 {
+		err := store.Append(StreamID(fmt.Sprintf("stream-%d", n%3)), uint64(n/3), RawEvent{
+			ID:         MakeID(),
+			OccurredOn: time.Now(),
+			Type:       fmt.Sprintf("test:type-%d", n%2),
+			Data:       []byte(`{}`),
+		})
+		tx.AssertNoErr(err)
+	}
+
+	evts, err := store.Query(QueryParams{
+		SortASC: true,
+		Filter: query.And(
+			query.Or(
+				query.C("stream_id", query.ComparatorEqual, "stream-0"),
+				query.C("stream_id", query.ComparatorEqual, "stream-1"),
+			),
+			query.In("type", "test:type-1"),
+		),
+	}, LimitOffset{Limit: 100})
+	tx.AssertNoErr(err)
+	var storeIdxs []uint64
+	for _, evt := range evts {
+		storeIdxs = append(storeIdxs, evt.StoreIndex)
+	}
+	tx.AssertEqual([]uint64{1, 3, 7, 9}, storeIdxs)
+
+	_, err = store.Query(QueryParams{Filter: query.IsNull("data")}, LimitOffset{Limit: 100})
+	tx.AssertErr(err)
+
+	// ToDate compares like filters on occurred_on
+	now := time.Now()
+	evts, err = store.Query(QueryParams{ToDate: now}, LimitOffset{Limit: 100})
+	tx.AssertNoErr(err)
+	tx.AssertEqual(10, len(evts))
+	evts, err = store.Query(QueryParams{Filter: query.C("occurred_on", query.ComparatorLessEqual, now)}, LimitOffset{Limit: 100})
+	tx.AssertNoErr(err)
+	tx.AssertEqual(10, len(evts))
+	evts, err = store.Query(QueryParams{ToDate: now.Add(-time.Hour)}, LimitOffset{Limit: 100})
+	tx.AssertNoErr(err)
+	tx.AssertEqual(0, len(evts))
+
+	// prefixes are matched literally
+	evts, err = store.QueryWithTypePrefix("test", QueryParams{SortASC: true}, LimitOffset{Limit: 100})
+	tx.AssertNoErr(err)
+	tx.AssertEqual(10, len(evts))
+	for _, prefix := range []string{"t%", "test' OR '1'='1"} {
+		evts, err = store.QueryWithTypePrefix(prefix, QueryParams{SortASC: true}, LimitOffset{Limit: 100})
+		tx.AssertNoErr(err)
+		tx.AssertEqual(0, len(evts))
+	}
+}
+
+func TestSqliteXStoreVersions(t *testing.T) {
+	for _, d := range sqlitex.Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testSqliteXStoreVersions(t, d)
+		})
+	}
+}
+
+func testSqliteXStoreVersions(t *testing.T, d sqlitex.Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_versions_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	store, err := NewSqliteXStore(filepath.Join(tmpFolderName, "events.db"), sqlitex.WithDriver(d))
+	tx.AssertNoErr(err)
+	defer store.Close()
+	settings, err := store.Settings(context.Background())
+	tx.AssertNoErr(err)
+	tx.AssertEqual(sqlitex.SynchronousOff, settings.Synchronous)
+
+	mkEvent := func(streamID string) RawEvent {
+		return RawEvent{ID: MakeID(), StreamID: streamID, OccurredOn: time.Now(), Type: "test:type", Data: []byte(`{}`)}
+	}
+	// versions of events of one stream created together are read within the write tx
+	err = store.Create(mkEvent("s1"), mkEvent("s1"), mkEvent("s2"))
+	tx.AssertNoErr(err)
+	tx.AssertEqual(uint64(2), store.StreamVersion("s1"))
+	tx.AssertEqual(uint64(1), store.StreamVersion("s2"))
+	tx.AssertEqual(uint64(3), store.StoreVersion())
+
+	err = store.Append("s1", 2, mkEvent("s1"), mkEvent("s1"))
+	tx.AssertNoErr(err)
+	tx.AssertEqual(uint64(4), store.StreamVersion("s1"))
+	err = store.Append("s1", 2, mkEvent("s1"))
+	tx.AssertErr(err)
+	tx.AssertEqual(uint64(4), store.StreamVersion("s1"))
+}
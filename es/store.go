@@ -3,6 +3,8 @@ package es
 import (
 	"fmt"
 	"time"
+
+	"github.com/mazzegi/mbox/query"
 )
 
 var DefaultPageSize = 50
@@ -43,6 +45,9 @@ type QueryParams struct {
 	ToDate   time.Time
 	Type     string
 	SortASC  bool
+	// Filter is an optional condition tree over the event columns
+	// id, store_index, stream_id, stream_index, occurred_on, recorded_on and type
+	Filter query.Filter
 }
 
 type Store interface {
@@ -1,6 +1,7 @@
 package money
 
 import (
+	"database/sql/driver"
 	"encoding/json"
 	"fmt"
 	"math"
@@ -144,3 +145,30 @@ func (m *Money) UnmarshalJSON(data []byte) error {
 
 	return fmt.Errorf("UnmarshalJSON: cannot unmarshal %q into money.Money", string(data))
 }
+
+// Value stores money as JSON text
+func (m Money) Value() (driver.Value, error) {
+	bs, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(bs), nil
+}
+
+// Scan reads money from JSON text as accepted by UnmarshalJSON. NULL is zero money.
+// Numeric columns are rejected, as they carry no currency.
+func (m *Money) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*m = Money{}
+	case int64, float64:
+		return fmt.Errorf("cannot scan %T into money, which is stored as json text with its currency", src)
+	case string:
+		return m.UnmarshalJSON([]byte(v))
+	case []byte:
+		return m.UnmarshalJSON(v)
+	default:
+		return fmt.Errorf("cannot scan %T into money", src)
+	}
+	return nil
+}
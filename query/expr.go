@@ -0,0 +1,520 @@
+package query
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mazzegi/mbox/date"
+)
+
+// ParseExpr parses a compact filter expression like
+//
+//	status eq 'open' and (amount gteq 100 or prio in (1, 2)) order by created desc limit 20 offset 40
+//
+// Comparators are the names of the Comparator constants. isnull and notnull take no value,
+// in takes a parenthesized list and between takes two values separated by "and".
+// Every field and comparator is checked against schema.
+func ParseExpr(expr string, schema Schema) (Query, error) {
+	p, err := newExprParser(expr, schema)
+	if err != nil {
+		return Query{}, err
+	}
+	var q Query
+	if !p.atEnd() && !p.isKeyword("order") && !p.isKeyword("limit") && !p.isKeyword("offset") {
+		q.Filter, err = p.parseOr()
+		if err != nil {
+			return Query{}, err
+		}
+	}
+	if p.isKeyword("order") {
+		p.next()
+		if err := p.expectKeyword("by"); err != nil {
+			return Query{}, err
+		}
+		for {
+			name, err := p.expectIdent()
+			if err != nil {
+				return Query{}, err
+			}
+			var ord SortOrder
+			if p.isKeyword("asc") || p.isKeyword("desc") {
+				ord = SortOrder(p.next().text)
+			}
+			srt, err := schema.sort(name, ord)
+			if err != nil {
+				return Query{}, err
+			}
+			q.Sorts = append(q.Sorts, srt)
+			if !p.isPunct(",") {
+				break
+			}
+			p.next()
+		}
+	}
+	var limit, offset int
+	if p.isKeyword("limit") {
+		p.next()
+		limit, err = p.expectInt()
+		if err != nil {
+			return Query{}, err
+		}
+	}
+	if p.isKeyword("offset") {
+		p.next()
+		offset, err = p.expectInt()
+		if err != nil {
+			return Query{}, err
+		}
+	}
+	if !p.atEnd() {
+		return Query{}, p.errorf("unexpected %q", p.peek().text)
+	}
+	q.LimitOffset, err = schema.limitOffset(limit, offset)
+	if err != nil {
+		return Query{}, err
+	}
+	return q, nil
+}
+
+// parseFilterExpr parses an expression which consists of a filter only
+func parseFilterExpr(expr string, schema Schema) (Filter, error) {
+	p, err := newExprParser(expr, schema)
+	if err != nil {
+		return nil, err
+	}
+	if p.atEnd() {
+		return nil, nil
+	}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.atEnd() {
+		return nil, p.errorf("unexpected %q", p.peek().text)
+	}
+	return f, nil
+}
+
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenString
+	tokenNumber
+	tokenPunct
+	tokenEOF
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func tokenize(s string) ([]token, error) {
+	var toks []token
+	rs := []rune(s)
+	i := 0
+	for i < len(rs) {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')' || r == ',':
+			toks = append(toks, token{kind: tokenPunct, text: string(r), pos: i})
+			i++
+		case r == '\'':
+			start := i
+			i++
+			var sb strings.Builder
+			closed := false
+			for i < len(rs) {
+				if rs[i] == '\'' {
+					if i+1 < len(rs) && rs[i+1] == '\'' {
+						sb.WriteRune('\'')
+						i += 2
+						continue
+					}
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(rs[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			toks = append(toks, token{kind: tokenString, text: sb.String(), pos: start})
+		case unicode.IsDigit(r) || r == '-' || r == '+' || r == '.':
+			start := i
+			for i < len(rs) && (unicode.IsDigit(rs[i]) || strings.ContainsRune("+-.eE", rs[i])) {
+				i++
+			}
+			toks = append(toks, token{kind: tokenNumber, text: string(rs[start:i]), pos: start})
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(rs) && (unicode.IsLetter(rs[i]) || unicode.IsDigit(rs[i]) || rs[i] == '_') {
+				i++
+			}
+			toks = append(toks, token{kind: tokenIdent, text: string(rs[start:i]), pos: start})
+		default:
+			return nil, fmt.Errorf("unexpected character %q at %d", r, i)
+		}
+	}
+	toks = append(toks, token{kind: tokenEOF, pos: len(rs)})
+	return toks, nil
+}
+
+// reservedNames are keywords of the expression language, which can't be used as field names
+var reservedNames = []string{"and", "or", "not", "order", "limit", "offset"}
+
+func isReservedName(name string) bool {
+	return slices.ContainsFunc(reservedNames, func(kw string) bool { return strings.EqualFold(kw, name) })
+}
+
+type exprParser struct {
+	schema Schema
+	toks   []token
+	pos    int
+}
+
+func newExprParser(expr string, schema Schema) (*exprParser, error) {
+	for _, f := range schema.Fields {
+		if isReservedName(f.Name) {
+			return nil, fmt.Errorf("schema field %q is a keyword and can't be used in expressions", f.Name)
+		}
+	}
+	toks, err := tokenize(expr)
+	if err != nil {
+		return nil, fmt.Errorf("tokenize: %w", err)
+	}
+	return &exprParser{
+		schema: schema,
+		toks:   toks,
+	}, nil
+}
+
+func (p *exprParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("at %d: %s", p.peek().pos, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) peek() token {
+	return p.toks[p.pos]
+}
+
+func (p *exprParser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) atEnd() bool {
+	return p.peek().kind == tokenEOF
+}
+
+func (p *exprParser) isKeyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tokenIdent && strings.EqualFold(t.text, kw)
+}
+
+func (p *exprParser) isPunct(s string) bool {
+	t := p.peek()
+	return t.kind == tokenPunct && t.text == s
+}
+
+func (p *exprParser) expectKeyword(kw string) error {
+	if !p.isKeyword(kw) {
+		return p.errorf("expect %q", kw)
+	}
+	p.next()
+	return nil
+}
+
+func (p *exprParser) expectPunct(s string) error {
+	if !p.isPunct(s) {
+		return p.errorf("expect %q", s)
+	}
+	p.next()
+	return nil
+}
+
+func (p *exprParser) expectIdent() (string, error) {
+	if p.peek().kind != tokenIdent {
+		return "", p.errorf("expect identifier")
+	}
+	return p.next().text, nil
+}
+
+func (p *exprParser) expectInt() (int, error) {
+	if p.peek().kind != tokenNumber {
+		return 0, p.errorf("expect number")
+	}
+	n, err := strconv.Atoi(p.peek().text)
+	if err != nil {
+		return 0, p.errorf("parse %q as int: %v", p.peek().text, err)
+	}
+	p.next()
+	return n, nil
+}
+
+func (p *exprParser) expectValue() (string, error) {
+	switch p.peek().kind {
+	case tokenString, tokenNumber, tokenIdent:
+		return p.next().text, nil
+	default:
+		return "", p.errorf("expect value")
+	}
+}
+
+func (p *exprParser) parseOr() (Filter, error) {
+	f, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	fs := []Filter{f}
+	for p.isKeyword("or") {
+		p.next()
+		f, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+	if len(fs) == 1 {
+		return fs[0], nil
+	}
+	return Or(fs...), nil
+}
+
+func (p *exprParser) parseAnd() (Filter, error) {
+	f, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	fs := []Filter{f}
+	for p.isKeyword("and") {
+		p.next()
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+	if len(fs) == 1 {
+		return fs[0], nil
+	}
+	return And(fs...), nil
+}
+
+func (p *exprParser) parseUnary() (Filter, error) {
+	switch {
+	case p.isKeyword("not"):
+		p.next()
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(f), nil
+	case p.isPunct("("):
+		p.next()
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+		return f, nil
+	default:
+		return p.parseCondition()
+	}
+}
+
+func (p *exprParser) parseCondition() (Filter, error) {
+	name, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	compText, err := p.expectIdent()
+	if err != nil {
+		return nil, err
+	}
+	comp := Comparator(strings.ToLower(compText))
+	var raws []string
+	switch comp {
+	case ComparatorIsNull, ComparatorNotNull:
+	case ComparatorIn:
+		if err := p.expectPunct("("); err != nil {
+			return nil, err
+		}
+		for !p.isPunct(")") {
+			raw, err := p.expectValue()
+			if err != nil {
+				return nil, err
+			}
+			raws = append(raws, raw)
+			if !p.isPunct(",") {
+				break
+			}
+			p.next()
+		}
+		if err := p.expectPunct(")"); err != nil {
+			return nil, err
+		}
+	case ComparatorBetween:
+		from, err := p.expectValue()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectKeyword("and"); err != nil {
+			return nil, err
+		}
+		to, err := p.expectValue()
+		if err != nil {
+			return nil, err
+		}
+		raws = []string{from, to}
+	default:
+		raw, err := p.expectValue()
+		if err != nil {
+			return nil, err
+		}
+		raws = []string{raw}
+	}
+	c, err := p.schema.condition(name, comp, raws)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// FormatExpr is the inverse of ParseExpr. It fails for conditions which can't be expressed, like between with a single value.
+func FormatExpr(q Query) (string, error) {
+	var parts []string
+	expr, err := FormatFilter(q.Where())
+	if err != nil {
+		return "", err
+	}
+	if expr != "" {
+		parts = append(parts, expr)
+	}
+	if len(q.Sorts) > 0 {
+		sorts := make([]string, len(q.Sorts))
+		for i, s := range q.Sorts {
+			sorts[i] = s.Name + " " + sortOrderString(s.Order)
+		}
+		parts = append(parts, "order by "+strings.Join(sorts, ", "))
+	}
+	if q.LimitOffset.Limit > 0 {
+		parts = append(parts, fmt.Sprintf("limit %d", q.LimitOffset.Limit))
+	}
+	if q.LimitOffset.Offset > 0 {
+		parts = append(parts, fmt.Sprintf("offset %d", q.LimitOffset.Offset))
+	}
+	return strings.Join(parts, " "), nil
+}
+
+// FormatFilter formats f in the expression language of ParseExpr
+func FormatFilter(f Filter) (string, error) {
+	return formatFilter(f, true)
+}
+
+func formatFilter(f Filter, top bool) (string, error) {
+	switch f := f.(type) {
+	case Condition:
+		return formatCondition(f)
+	case Group:
+		var exprs []string
+		for _, sf := range f.Filters {
+			expr, err := formatFilter(sf, false)
+			if err != nil {
+				return "", err
+			}
+			if expr != "" {
+				exprs = append(exprs, expr)
+			}
+		}
+		if len(exprs) == 0 {
+			return "", nil
+		}
+		switch f.Logic {
+		case LogicOr:
+			if len(exprs) == 1 {
+				return exprs[0], nil
+			}
+			if top {
+				return strings.Join(exprs, " or "), nil
+			}
+			return "(" + strings.Join(exprs, " or ") + ")", nil
+		case LogicNot:
+			return "not (" + strings.Join(exprs, " and ") + ")", nil
+		default:
+			if len(exprs) == 1 {
+				return exprs[0], nil
+			}
+			if top {
+				return strings.Join(exprs, " and "), nil
+			}
+			return "(" + strings.Join(exprs, " and ") + ")", nil
+		}
+	default:
+		return "", nil
+	}
+}
+
+func formatCondition(c Condition) (string, error) {
+	if isReservedName(c.Name) {
+		return "", fmt.Errorf("field %q is a keyword", c.Name)
+	}
+	comp := c.Comp
+	if comp == "" {
+		comp = ComparatorEqual
+	}
+	switch comp {
+	case ComparatorIsNull, ComparatorNotNull:
+		return fmt.Sprintf("%s %s", c.Name, comp), nil
+	case ComparatorIn:
+		vals, ok := sliceValues(c.Value)
+		if !ok {
+			return "", fmt.Errorf("in condition on %q needs a list of values", c.Name)
+		}
+		lits := make([]string, len(vals))
+		for i, val := range vals {
+			lits[i] = formatLiteral(val)
+		}
+		return fmt.Sprintf("%s in (%s)", c.Name, strings.Join(lits, ", ")), nil
+	case ComparatorBetween:
+		vals, ok := sliceValues(c.Value)
+		if !ok || len(vals) != 2 {
+			return "", fmt.Errorf("between condition on %q needs two values", c.Name)
+		}
+		return fmt.Sprintf("%s between %s and %s", c.Name, formatLiteral(vals[0]), formatLiteral(vals[1])), nil
+	default:
+		return fmt.Sprintf("%s %s %s", c.Name, comp, formatLiteral(c.Value)), nil
+	}
+}
+
+func formatLiteral(val any) string {
+	switch val.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
+		return formatValue(val)
+	case time.Time, date.Date:
+		return "'" + formatValue(val) + "'"
+	default:
+		return "'" + strings.ReplaceAll(formatValue(val), "'", "''") + "'"
+	}
+}
+
+func sortOrderString(ord SortOrder) string {
+	if ord == SortDESC {
+		return "desc"
+	}
+	return "asc"
+}
@@ -0,0 +1,80 @@
+package query
+
+// Filter is a node of a condition tree. It is either a Condition or a Group.
+type Filter interface {
+	isFilter()
+}
+
+type Logic string
+
+const (
+	LogicAnd Logic = "and"
+	LogicOr  Logic = "or"
+	LogicNot Logic = "not"
+)
+
+// Group combines filters with a logical operator. A LogicNot group negates the AND of its filters.
+type Group struct {
+	Logic   Logic
+	Filters []Filter
+}
+
+func (Condition) isFilter() {}
+func (Group) isFilter()     {}
+
+func And(fs ...Filter) Group {
+	return Group{
+		Logic:   LogicAnd,
+		Filters: fs,
+	}
+}
+
+func Or(fs ...Filter) Group {
+	return Group{
+		Logic:   LogicOr,
+		Filters: fs,
+	}
+}
+
+func Not(fs ...Filter) Group {
+	return Group{
+		Logic:   LogicNot,
+		Filters: fs,
+	}
+}
+
+func IsNull(name string) Condition {
+	return C(name, ComparatorIsNull, nil)
+}
+
+func NotNull(name string) Condition {
+	return C(name, ComparatorNotNull, nil)
+}
+
+func Between(name string, from, to any) Condition {
+	return C(name, ComparatorBetween, []any{from, to})
+}
+
+func In(name string, vals ...any) Condition {
+	return C(name, ComparatorIn, vals)
+}
+
+func StartsWith(name string, prefix string) Condition {
+	return C(name, ComparatorStartsWith, prefix)
+}
+
+func EndsWith(name string, suffix string) Condition {
+	return C(name, ComparatorEndsWith, suffix)
+}
+
+// WalkConditions calls fn for every condition in the tree of f
+func WalkConditions(f Filter, fn func(c Condition)) {
+	switch f := f.(type) {
+	case Condition:
+		fn(f)
+	case Group:
+		for _, sf := range f.Filters {
+			WalkConditions(sf, fn)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package query
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/mazzegi/mbox/date"
+	"github.com/mazzegi/mbox/testx"
+)
+
+var testSchema = NewSchema(
+	SF("status", FieldString, ComparatorEqual, ComparatorNotEqual, ComparatorIn),
+	SF("amount", FieldFloat),
+	SF("prio", FieldInt),
+	SF("created", FieldDate),
+	SF("archived", FieldBool, ComparatorEqual),
+).WithSearch("status").WithLimits(50, 100)
+
+func TestParseExpr(t *testing.T) {
+	tx := testx.NewTx(t)
+	type test struct {
+		in       string
+		want     Query
+		expError bool
+	}
+	tests := []test{
+		{
+			in: "status eq 'open' and amount gteq 100 order by created desc limit 20",
+			want: Query{
+				LimitOffset: LO(20, 0),
+				Filter: And(
+					C("status", ComparatorEqual, "open"),
+					C("amount", ComparatorGreaterEqual, 100.0),
+				),
+				Sorts: []Sort{S("created", SortDESC)},
+			},
+		},
+		{
+			in: "not (status in ('a', 'it''s') or prio between 1 and 3) and created isnull offset 10",
+			want: Query{
+				LimitOffset: LO(50, 10),
+				Filter: And(
+					Not(Or(
+						C("status", ComparatorIn, []any{"a", "it's"}),
+						C("prio", ComparatorBetween, []any{1, 3}),
+					)),
+					IsNull("created"),
+				),
+			},
+		},
+		{
+			in: "created lseq '2024-03-01' or archived eq true limit 500",
+			want: Query{
+				LimitOffset: LO(100, 0),
+				Filter: Or(
+					C("created", ComparatorLessEqual, date.Make(2024, 3, 1)),
+					C("archived", ComparatorEqual, true),
+				),
+			},
+		},
+		{
+			in:   "order by prio",
+			want: Query{LimitOffset: LO(50, 0), Sorts: []Sort{S("prio", SortASC)}},
+		},
+		{in: "unknown eq 1", expError: true},
+		{in: "status like 'x'", expError: true},
+		{in: "prio eq 'x'", expError: true},
+		{in: "prio eq 1 and", expError: true},
+		{in: "(prio eq 1", expError: true},
+		{in: "status eq 'open", expError: true},
+		{in: "prio eq 1 order by unknown", expError: true},
+		{in: "prio eq 1; drop table x", expError: true},
+	}
+	testx.RunTestsParallel(tx, tests, func(tx *testx.Tx, test test) {
+		q, err := ParseExpr(test.in, testSchema)
+		if test.expError {
+			tx.AssertErr(err)
+			return
+		}
+		tx.AssertNoErr(err)
+		tx.AssertEqual(test.want, q)
+
+		// roundtrip
+		expr, err := FormatExpr(q)
+		tx.AssertNoErr(err)
+		rq, err := ParseExpr(expr, testSchema)
+		tx.AssertNoErr(err)
+		rexpr, err := FormatExpr(rq)
+		tx.AssertNoErr(err)
+		tx.AssertEqual(expr, rexpr)
+	})
+}
+
+func TestFormatExprErrors(t *testing.T) {
+	tx := testx.NewTx(t)
+
+	for _, f := range []Filter{
+		C("prio", ComparatorBetween, []any{1}),
+		C("prio", ComparatorBetween, 1),
+		C("prio", ComparatorIn, 1),
+		And(C("prio", ComparatorEqual, 1), C("prio", ComparatorBetween, []any{1, 2, 3})),
+		C("order", ComparatorEqual, 1),
+	} {
+		_, err := FormatExpr(Query{Filter: f})
+		tx.AssertErr(err)
+		_, err = EncodeURL(Query{Filter: f})
+		tx.AssertErr(err)
+	}
+}
+
+func TestParseExprKeywordFields(t *testing.T) {
+	tx := testx.NewTx(t)
+
+	for _, name := range []string{"order", "limit", "offset", "and", "or", "NOT"} {
+		schema := NewSchema(SchemaField{Name: name, Type: FieldInt})
+		_, err := ParseExpr("", schema)
+		tx.AssertErr(err)
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	tx := testx.NewTx(t)
+
+	vals, err := url.ParseQuery("status=open&amount.gt=1.5&prio.in=1&prio.in=2&created.notnull=&sort=amount:desc&sort=prio&limit=10&offset=20&search=foo&filter=prio+eq+3+or+prio+eq+4")
+	tx.AssertNoErr(err)
+	q, err := ParseURL(vals, testSchema)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(Query{
+		LimitOffset: LO(10, 20),
+		Conditions: []Condition{
+			C("amount", ComparatorGreater, 1.5),
+			NotNull("created"),
+			C("prio", ComparatorIn, []any{1, 2}),
+			C("status", ComparatorEqual, "open"),
+		},
+		Filter: Or(C("prio", ComparatorEqual, 3), C("prio", ComparatorEqual, 4)),
+		Sorts:  []Sort{S("amount", SortDESC), S("prio", SortASC)},
+		Search: SearchFor("foo", "status"),
+	}, q)
+
+	// roundtrip
+	enc, err := EncodeURL(q)
+	tx.AssertNoErr(err)
+	rq, err := ParseURL(enc, testSchema)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(q, rq)
+
+	for _, bad := range []string{
+		"unknown=1",
+		"status.like=x",
+		"prio=x",
+		"prio.between=1",
+		"sort=unknown",
+		"limit=x",
+		"offset=-1",
+		"filter=prio+eq",
+	} {
+		vals, err := url.ParseQuery(bad)
+		tx.AssertNoErr(err)
+		_, err = ParseURL(vals, testSchema)
+		tx.AssertErr(err)
+	}
+}
@@ -29,6 +29,11 @@ const (
 	ComparatorGreaterEqual Comparator = "gteq"
 	ComparatorLike         Comparator = "like"
 	ComparatorIn           Comparator = "in"
+	ComparatorIsNull       Comparator = "isnull"
+	ComparatorNotNull      Comparator = "notnull"
+	ComparatorBetween      Comparator = "between"
+	ComparatorStartsWith   Comparator = "startswith"
+	ComparatorEndsWith     Comparator = "endswith"
 )
 
 type SortOrder string
@@ -84,10 +89,23 @@ func S(name string, ord SortOrder) Sort {
 type Query struct {
 	LimitOffset LimitOffset
 	Conditions  []Condition
+	Filter      Filter
 	Sorts       []Sort
 	Search      Search
 }
 
+// Where returns the conditions and the filter of the query ANDed together
+func (q Query) Where() Filter {
+	fs := make([]Filter, 0, len(q.Conditions)+1)
+	for _, c := range q.Conditions {
+		fs = append(fs, c)
+	}
+	if q.Filter != nil {
+		fs = append(fs, q.Filter)
+	}
+	return And(fs...)
+}
+
 func (q Query) FindCondition(name string) (Condition, bool) {
 	for _, c := range q.Conditions {
 		if c.Name == name {
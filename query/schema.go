@@ -0,0 +1,219 @@
+package query
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mazzegi/mbox/date"
+)
+
+type FieldType string
+
+const (
+	FieldString FieldType = "string"
+	FieldInt    FieldType = "int"
+	FieldFloat  FieldType = "float"
+	FieldBool   FieldType = "bool"
+	FieldDate   FieldType = "date"
+	FieldTime   FieldType = "time"
+)
+
+// SchemaField whitelists a field for parsed queries. If Comparators is empty, all comparators are allowed.
+type SchemaField struct {
+	Name        string
+	Type        FieldType
+	Comparators []Comparator
+}
+
+func SF(name string, typ FieldType, comps ...Comparator) SchemaField {
+	return SchemaField{
+		Name:        name,
+		Type:        typ,
+		Comparators: comps,
+	}
+}
+
+// Schema describes which fields, comparators and limits are accepted when parsing queries from untrusted input
+type Schema struct {
+	Fields       []SchemaField
+	SearchFields []string
+	DefaultLimit int
+	MaxLimit     int
+}
+
+func NewSchema(fields ...SchemaField) Schema {
+	return Schema{
+		Fields: fields,
+	}
+}
+
+func (s Schema) WithSearch(fields ...string) Schema {
+	s.SearchFields = fields
+	return s
+}
+
+func (s Schema) WithLimits(defaultLimit, maxLimit int) Schema {
+	s.DefaultLimit = defaultLimit
+	s.MaxLimit = maxLimit
+	return s
+}
+
+func (s Schema) Field(name string) (SchemaField, bool) {
+	for _, f := range s.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return SchemaField{}, false
+}
+
+func (f SchemaField) allows(comp Comparator) bool {
+	if len(f.Comparators) == 0 {
+		return true
+	}
+	return slices.Contains(f.Comparators, comp)
+}
+
+func (s Schema) limitOffset(limit, offset int) (LimitOffset, error) {
+	if limit < 0 || offset < 0 {
+		return LimitOffset{}, fmt.Errorf("limit and offset must not be negative")
+	}
+	if limit == 0 {
+		limit = s.DefaultLimit
+	}
+	if s.MaxLimit > 0 && (limit == 0 || limit > s.MaxLimit) {
+		limit = s.MaxLimit
+	}
+	return LO(limit, offset), nil
+}
+
+func (s Schema) sort(name string, ord SortOrder) (Sort, error) {
+	if _, ok := s.Field(name); !ok {
+		return Sort{}, fmt.Errorf("unknown sort field %q", name)
+	}
+	switch SortOrder(strings.ToUpper(string(ord))) {
+	case SortASC, "":
+		return S(name, SortASC), nil
+	case SortDESC:
+		return S(name, SortDESC), nil
+	default:
+		return Sort{}, fmt.Errorf("invalid sort order %q", ord)
+	}
+}
+
+// condition validates name and comparator against the schema and converts the raw values to the field type
+func (s Schema) condition(name string, comp Comparator, raws []string) (Condition, error) {
+	field, ok := s.Field(name)
+	if !ok {
+		return Condition{}, fmt.Errorf("unknown field %q", name)
+	}
+	if comp == "" {
+		comp = ComparatorEqual
+	}
+	if _, ok := sqlComparator(comp); !ok && !slices.Contains(extendedComparators, comp) {
+		return Condition{}, fmt.Errorf("unknown comparator %q", comp)
+	}
+	if !field.allows(comp) {
+		return Condition{}, fmt.Errorf("comparator %q is not allowed for field %q", comp, name)
+	}
+	switch comp {
+	case ComparatorIsNull, ComparatorNotNull:
+		return C(name, comp, nil), nil
+	case ComparatorIn, ComparatorBetween:
+		if comp == ComparatorBetween && len(raws) != 2 {
+			return Condition{}, fmt.Errorf("between on field %q needs exactly 2 values", name)
+		}
+		vals := make([]any, len(raws))
+		for i, raw := range raws {
+			val, err := field.parseValue(raw)
+			if err != nil {
+				return Condition{}, err
+			}
+			vals[i] = val
+		}
+		return C(name, comp, vals), nil
+	case ComparatorLike, ComparatorStartsWith, ComparatorEndsWith:
+		if len(raws) != 1 {
+			return Condition{}, fmt.Errorf("%s on field %q needs exactly 1 value", comp, name)
+		}
+		return C(name, comp, raws[0]), nil
+	default:
+		if len(raws) != 1 {
+			return Condition{}, fmt.Errorf("%s on field %q needs exactly 1 value", comp, name)
+		}
+		val, err := field.parseValue(raws[0])
+		if err != nil {
+			return Condition{}, err
+		}
+		return C(name, comp, val), nil
+	}
+}
+
+var extendedComparators = []Comparator{
+	ComparatorIn,
+	ComparatorIsNull,
+	ComparatorNotNull,
+	ComparatorBetween,
+	ComparatorStartsWith,
+	ComparatorEndsWith,
+}
+
+func (f SchemaField) parseValue(raw string) (any, error) {
+	switch f.Type {
+	case FieldString, "":
+		return raw, nil
+	case FieldInt:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parse %q as int for field %q: %w", raw, f.Name, err)
+		}
+		return n, nil
+	case FieldFloat:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse %q as float for field %q: %w", raw, f.Name, err)
+		}
+		return n, nil
+	case FieldBool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parse %q as bool for field %q: %w", raw, f.Name, err)
+		}
+		return b, nil
+	case FieldDate:
+		d, err := date.Parse(raw)
+		if err != nil {
+			return nil, fmt.Errorf("parse %q as date for field %q: %w", raw, f.Name, err)
+		}
+		return d, nil
+	case FieldTime:
+		t, err := time.Parse(time.RFC3339Nano, raw)
+		if err != nil {
+			return nil, fmt.Errorf("parse %q as time for field %q: %w", raw, f.Name, err)
+		}
+		return t, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %q of field %q", f.Type, f.Name)
+	}
+}
+
+// formatValue is the inverse of SchemaField.parseValue
+func formatValue(val any) string {
+	switch val := val.(type) {
+	case string:
+		return val
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	case date.Date:
+		return val.CanonicalString()
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(val), 'f', -1, 32)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
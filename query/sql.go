@@ -0,0 +1,203 @@
+package query
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SQLWhereOptions controls the translation of a filter into a parameterized sql expression
+type SQLWhereOptions struct {
+	// Column maps a condition name to a column. It must fail for unknown names and is required, as names are untrusted input.
+	Column func(name string) (string, error)
+	// Value optionally converts a condition value into a value the driver understands
+	Value func(val any) (any, error)
+	// ParamPrefix is prepended to the generated parameter names. Defaults to "p".
+	ParamPrefix string
+}
+
+// SQLWhere translates f into a sql expression with named parameters. An empty filter yields an empty expression.
+func SQLWhere(f Filter, opts SQLWhereOptions) (string, []any, error) {
+	if opts.ParamPrefix == "" {
+		opts.ParamPrefix = "p"
+	}
+	if opts.Column == nil {
+		return "", nil, fmt.Errorf("no column mapper")
+	}
+	if opts.Value == nil {
+		opts.Value = func(val any) (any, error) { return val, nil }
+	}
+	w := &sqlWhere{opts: opts}
+	expr, err := w.filter(f)
+	if err != nil {
+		return "", nil, err
+	}
+	return expr, w.args, nil
+}
+
+type sqlWhere struct {
+	opts     SQLWhereOptions
+	args     []any
+	paramIdx int
+}
+
+func (w *sqlWhere) param(val any) (string, error) {
+	val, err := w.opts.Value(val)
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("%s%03d", w.opts.ParamPrefix, w.paramIdx)
+	w.paramIdx++
+	w.args = append(w.args, sql.Named(name, val))
+	return ":" + name, nil
+}
+
+func (w *sqlWhere) filter(f Filter) (string, error) {
+	switch f := f.(type) {
+	case nil:
+		return "", nil
+	case Condition:
+		return w.condition(f)
+	case Group:
+		return w.group(f)
+	default:
+		return "", fmt.Errorf("unsupported filter type %T", f)
+	}
+}
+
+func (w *sqlWhere) group(g Group) (string, error) {
+	var exprs []string
+	for _, f := range g.Filters {
+		expr, err := w.filter(f)
+		if err != nil {
+			return "", err
+		}
+		if expr == "" {
+			continue
+		}
+		exprs = append(exprs, expr)
+	}
+	if len(exprs) == 0 {
+		return "", nil
+	}
+	switch g.Logic {
+	case LogicAnd, "":
+		return "(" + strings.Join(exprs, " AND ") + ")", nil
+	case LogicOr:
+		return "(" + strings.Join(exprs, " OR ") + ")", nil
+	case LogicNot:
+		return "NOT (" + strings.Join(exprs, " AND ") + ")", nil
+	default:
+		return "", fmt.Errorf("unsupported logic %q", g.Logic)
+	}
+}
+
+func sqlComparator(qc Comparator) (string, bool) {
+	switch qc {
+	case ComparatorEqual, "":
+		return "=", true
+	case ComparatorNotEqual:
+		return "!=", true
+	case ComparatorGreater:
+		return ">", true
+	case ComparatorGreaterEqual:
+		return ">=", true
+	case ComparatorLess:
+		return "<", true
+	case ComparatorLessEqual:
+		return "<=", true
+	case ComparatorLike:
+		return "like", true
+	default:
+		return "", false
+	}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (w *sqlWhere) condition(c Condition) (string, error) {
+	col, err := w.opts.Column(c.Name)
+	if err != nil {
+		return "", err
+	}
+	switch c.Comp {
+	case ComparatorIsNull:
+		return fmt.Sprintf("%s IS NULL", col), nil
+	case ComparatorNotNull:
+		return fmt.Sprintf("%s IS NOT NULL", col), nil
+	case ComparatorIn:
+		vals, ok := sliceValues(c.Value)
+		if !ok {
+			return "", fmt.Errorf("value of IN condition on %q must be a slice but is %T", c.Name, c.Value)
+		}
+		phs := make([]string, len(vals))
+		for i, val := range vals {
+			phs[i], err = w.param(val)
+			if err != nil {
+				return "", fmt.Errorf("param %q: %w", c.Name, err)
+			}
+		}
+		return fmt.Sprintf("%s IN (%s)", col, strings.Join(phs, ",")), nil
+	case ComparatorBetween:
+		vals, ok := sliceValues(c.Value)
+		if !ok || len(vals) != 2 {
+			return "", fmt.Errorf("value of BETWEEN condition on %q must be a slice of 2 values", c.Name)
+		}
+		from, err := w.param(vals[0])
+		if err != nil {
+			return "", fmt.Errorf("param %q: %w", c.Name, err)
+		}
+		to, err := w.param(vals[1])
+		if err != nil {
+			return "", fmt.Errorf("param %q: %w", c.Name, err)
+		}
+		return fmt.Sprintf("%s BETWEEN %s AND %s", col, from, to), nil
+	case ComparatorStartsWith, ComparatorEndsWith:
+		pattern := likeEscaper.Replace(c.ValueString())
+		if c.Comp == ComparatorStartsWith {
+			pattern = pattern + "%"
+		} else {
+			pattern = "%" + pattern
+		}
+		ph, err := w.param(pattern)
+		if err != nil {
+			return "", fmt.Errorf("param %q: %w", c.Name, err)
+		}
+		return fmt.Sprintf(`%s LIKE %s ESCAPE '\'`, col, ph), nil
+	}
+
+	op, ok := sqlComparator(c.Comp)
+	if !ok {
+		return "", fmt.Errorf("unsupported comparator %q", c.Comp)
+	}
+	val := c.Value
+	if c.Comp == ComparatorLike {
+		val = fmt.Sprintf("%%%v%%", c.Value)
+	}
+	ph, err := w.param(val)
+	if err != nil {
+		return "", fmt.Errorf("param %q: %w", c.Name, err)
+	}
+	return fmt.Sprintf("%s %s %s", col, op, ph), nil
+}
+
+func sliceValues(v any) ([]any, bool) {
+	if v == nil {
+		return nil, false
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+	vals := make([]any, rv.Len())
+	for i := range vals {
+		vals[i] = rv.Index(i).Interface()
+	}
+	return vals, true
+}
@@ -0,0 +1,99 @@
+package query
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/mazzegi/mbox/testx"
+)
+
+func TestSQLWhere(t *testing.T) {
+	tx := testx.NewTx(t)
+
+	type test struct {
+		filter   Filter
+		expr     string
+		args     []any
+		expError bool
+	}
+	tests := []test{
+		{
+			filter: nil,
+			expr:   "",
+		},
+		{
+			filter: And(),
+			expr:   "",
+		},
+		{
+			filter: C("a", ComparatorEqual, 1),
+			expr:   "a = :p000",
+			args:   []any{sql.Named("p000", 1)},
+		},
+		{
+			filter: Or(C("a", ComparatorGreater, 1), And(IsNull("b"), NotNull("c"))),
+			expr:   "(a > :p000 OR (b IS NULL AND c IS NOT NULL))",
+			args:   []any{sql.Named("p000", 1)},
+		},
+		{
+			filter: Not(In("a", 1, 2), Between("b", 1.5, 2.5)),
+			expr:   "NOT (a IN (:p000,:p001) AND b BETWEEN :p002 AND :p003)",
+			args:   []any{sql.Named("p000", 1), sql.Named("p001", 2), sql.Named("p002", 1.5), sql.Named("p003", 2.5)},
+		},
+		{
+			filter: C("a", ComparatorIn, []int{3}),
+			expr:   "a IN (:p000)",
+			args:   []any{sql.Named("p000", 3)},
+		},
+		{
+			filter: And(StartsWith("a", "x_1"), EndsWith("b", "50%")),
+			expr:   `(a LIKE :p000 ESCAPE '\' AND b LIKE :p001 ESCAPE '\')`,
+			args:   []any{sql.Named("p000", `x\_1%`), sql.Named("p001", `%50\%`)},
+		},
+		{
+			filter:   C("a", ComparatorIn, "not-a-slice"),
+			expError: true,
+		},
+		{
+			filter:   C("a", ComparatorBetween, []int{1}),
+			expError: true,
+		},
+		{
+			filter:   C("a", Comparator("foo"), 1),
+			expError: true,
+		},
+		{
+			filter:   C("unknown", ComparatorEqual, 1),
+			expError: true,
+		},
+	}
+
+	opts := SQLWhereOptions{
+		Column: func(name string) (string, error) {
+			if name == "unknown" {
+				return "", fmt.Errorf("unknown column %q", name)
+			}
+			return name, nil
+		},
+	}
+	testx.RunTestsParallel(tx, tests, func(tx *testx.Tx, test test) {
+		expr, args, err := SQLWhere(test.filter, opts)
+		if test.expError {
+			tx.AssertErr(err)
+			return
+		}
+		tx.AssertNoErr(err)
+		tx.AssertEqual(test.expr, expr)
+		tx.AssertEqual(len(test.args), len(args))
+		for i, arg := range test.args {
+			tx.AssertEqual(arg, args[i])
+		}
+	})
+}
+
+func TestSQLWhereRequiresColumn(t *testing.T) {
+	tx := testx.NewTx(t)
+	_, _, err := SQLWhere(C("a; DROP TABLE t", ComparatorEqual, 1), SQLWhereOptions{})
+	tx.AssertErr(err)
+}
@@ -0,0 +1,159 @@
+package query
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	URLKeyLimit  = "limit"
+	URLKeyOffset = "offset"
+	URLKeySort   = "sort"
+	URLKeySearch = "search"
+	URLKeyFilter = "filter"
+)
+
+// ParseURL parses a query from url values. Supported keys are
+//
+//	field=value            condition "field eq value"
+//	field.comp=value       condition with comparator comp; repeat the key to pass the values of in and between
+//	sort=field[:asc|desc]  sort order, may be repeated
+//	limit=n, offset=n      limit and offset
+//	search=text            search in the search fields of the schema
+//	filter=expr            a filter expression as accepted by ParseExpr
+//
+// Every field and comparator is checked against schema.
+func ParseURL(vals url.Values, schema Schema) (Query, error) {
+	var q Query
+	var limit, offset int
+	var err error
+	keys := make([]string, 0, len(vals))
+	for key := range vals {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		raws := vals[key]
+		if len(raws) == 0 {
+			continue
+		}
+		switch key {
+		case URLKeyLimit:
+			limit, err = strconv.Atoi(raws[0])
+			if err != nil {
+				return Query{}, fmt.Errorf("parse limit %q: %w", raws[0], err)
+			}
+		case URLKeyOffset:
+			offset, err = strconv.Atoi(raws[0])
+			if err != nil {
+				return Query{}, fmt.Errorf("parse offset %q: %w", raws[0], err)
+			}
+		case URLKeySort:
+			for _, raw := range raws {
+				name, ord, _ := strings.Cut(raw, ":")
+				srt, err := schema.sort(name, SortOrder(ord))
+				if err != nil {
+					return Query{}, err
+				}
+				q.Sorts = append(q.Sorts, srt)
+			}
+		case URLKeySearch:
+			if len(schema.SearchFields) == 0 {
+				return Query{}, fmt.Errorf("search is not supported")
+			}
+			q.Search = SearchFor(raws[0], schema.SearchFields...)
+		case URLKeyFilter:
+			var fs []Filter
+			for _, raw := range raws {
+				f, err := parseFilterExpr(raw, schema)
+				if err != nil {
+					return Query{}, fmt.Errorf("parse filter %q: %w", raw, err)
+				}
+				fs = append(fs, f)
+			}
+			if len(fs) == 1 {
+				q.Filter = fs[0]
+			} else {
+				q.Filter = And(fs...)
+			}
+		default:
+			name, comp, _ := strings.Cut(key, ".")
+			switch Comparator(comp) {
+			case ComparatorIn, ComparatorBetween, ComparatorIsNull, ComparatorNotNull:
+				c, err := schema.condition(name, Comparator(comp), raws)
+				if err != nil {
+					return Query{}, err
+				}
+				q.Conditions = append(q.Conditions, c)
+			default:
+				for _, raw := range raws {
+					c, err := schema.condition(name, Comparator(comp), []string{raw})
+					if err != nil {
+						return Query{}, err
+					}
+					q.Conditions = append(q.Conditions, c)
+				}
+			}
+		}
+	}
+	q.LimitOffset, err = schema.limitOffset(limit, offset)
+	if err != nil {
+		return Query{}, err
+	}
+	return q, nil
+}
+
+// EncodeURL is the inverse of ParseURL. It fails for filters which FormatFilter can't express.
+func EncodeURL(q Query) (url.Values, error) {
+	vals := url.Values{}
+	var extra []Filter
+	for _, c := range q.Conditions {
+		switch c.Comp {
+		case ComparatorEqual, "":
+			vals.Add(c.Name, formatValue(c.Value))
+		case ComparatorIsNull, ComparatorNotNull:
+			vals.Set(c.Name+"."+string(c.Comp), "")
+		case ComparatorIn, ComparatorBetween:
+			key := c.Name + "." + string(c.Comp)
+			cvals, ok := sliceValues(c.Value)
+			if _, exists := vals[key]; exists || !ok || len(cvals) == 0 {
+				// cannot be expressed as a single url key
+				extra = append(extra, c)
+				continue
+			}
+			for _, cval := range cvals {
+				vals.Add(key, formatValue(cval))
+			}
+		default:
+			vals.Add(c.Name+"."+string(c.Comp), formatValue(c.Value))
+		}
+	}
+	if q.Filter != nil {
+		extra = append(extra, q.Filter)
+	}
+	for _, f := range extra {
+		expr, err := FormatFilter(f)
+		if err != nil {
+			return nil, err
+		}
+		if expr != "" {
+			vals.Add(URLKeyFilter, expr)
+		}
+	}
+	for _, s := range q.Sorts {
+		vals.Add(URLKeySort, s.Name+":"+sortOrderString(s.Order))
+	}
+	if q.Search.Value != "" {
+		vals.Set(URLKeySearch, q.Search.Value)
+	}
+	if q.LimitOffset.Limit > 0 {
+		vals.Set(URLKeyLimit, strconv.Itoa(q.LimitOffset.Limit))
+	}
+	if q.LimitOffset.Offset > 0 {
+		vals.Set(URLKeyOffset, strconv.Itoa(q.LimitOffset.Offset))
+	}
+	return vals, nil
+}
@@ -0,0 +1,336 @@
+// Package sqlb builds parameterized select statements. Identifiers are validated and quoted,
+// values are always passed as named args, so neither can inject sql.
+package sqlb
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/mazzegi/mbox/query"
+)
+
+var identRx = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Ident validates and quotes name. Qualified names like table.column are quoted per part.
+func Ident(name string) (string, error) {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		if !identRx.MatchString(part) {
+			return "", fmt.Errorf("invalid identifier %q", name)
+		}
+		parts[i] = `"` + part + `"`
+	}
+	return strings.Join(parts, "."), nil
+}
+
+// Params collects the named args of a statement
+type Params struct {
+	args []any
+	idx  int
+}
+
+// Add adds val as named arg and returns its placeholder
+func (p *Params) Add(val any) string {
+	name := fmt.Sprintf("p%03d", p.idx)
+	p.idx++
+	p.args = append(p.args, sql.Named(name, val))
+	return ":" + name
+}
+
+// Args returns the named args added so far
+func (p *Params) Args() []any {
+	return p.args
+}
+
+// Cond renders a boolean sql expression and adds its values to p
+type Cond func(p *Params) (string, error)
+
+func compare(col string, op string, val any) Cond {
+	return func(p *Params) (string, error) {
+		qcol, err := Ident(col)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %s %s", qcol, op, p.Add(val)), nil
+	}
+}
+
+func Eq(col string, val any) Cond { return compare(col, "=", val) }
+func Ne(col string, val any) Cond { return compare(col, "!=", val) }
+func Lt(col string, val any) Cond { return compare(col, "<", val) }
+func Le(col string, val any) Cond { return compare(col, "<=", val) }
+func Gt(col string, val any) Cond { return compare(col, ">", val) }
+func Ge(col string, val any) Cond { return compare(col, ">=", val) }
+
+// Like matches col against pattern, where % and _ are wildcards
+func Like(col string, pattern string) Cond { return compare(col, "LIKE", pattern) }
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// HasPrefix matches col starting with prefix, which contains no wildcards
+func HasPrefix(col string, prefix string) Cond {
+	return func(p *Params) (string, error) {
+		qcol, err := Ident(col)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(`%s LIKE %s ESCAPE '\'`, qcol, p.Add(likeEscaper.Replace(prefix)+"%")), nil
+	}
+}
+
+// Contains matches col containing s, which contains no wildcards
+func Contains(col string, s string) Cond {
+	return func(p *Params) (string, error) {
+		qcol, err := Ident(col)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf(`%s LIKE %s ESCAPE '\'`, qcol, p.Add("%"+likeEscaper.Replace(s)+"%")), nil
+	}
+}
+
+func IsNull(col string) Cond {
+	return func(p *Params) (string, error) {
+		qcol, err := Ident(col)
+		if err != nil {
+			return "", err
+		}
+		return qcol + " IS NULL", nil
+	}
+}
+
+func NotNull(col string) Cond {
+	return func(p *Params) (string, error) {
+		qcol, err := Ident(col)
+		if err != nil {
+			return "", err
+		}
+		return qcol + " IS NOT NULL", nil
+	}
+}
+
+// EqCol compares two columns, e.g. of a subquery and its outer query
+func EqCol(col1 string, col2 string) Cond {
+	return func(p *Params) (string, error) {
+		qcol1, err := Ident(col1)
+		if err != nil {
+			return "", err
+		}
+		qcol2, err := Ident(col2)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s = %s", qcol1, qcol2), nil
+	}
+}
+
+func join(cs []Cond, sep string, p *Params) (string, error) {
+	var exprs []string
+	for _, c := range cs {
+		expr, err := c(p)
+		if err != nil {
+			return "", err
+		}
+		if expr == "" {
+			continue
+		}
+		exprs = append(exprs, expr)
+	}
+	if len(exprs) == 0 {
+		return "", nil
+	}
+	return "(" + strings.Join(exprs, sep) + ")", nil
+}
+
+// And yields an empty expression, if all cs are empty
+func And(cs ...Cond) Cond {
+	return func(p *Params) (string, error) {
+		return join(cs, " AND ", p)
+	}
+}
+
+// Or yields an empty expression, if all cs are empty
+func Or(cs ...Cond) Cond {
+	return func(p *Params) (string, error) {
+		return join(cs, " OR ", p)
+	}
+}
+
+// False never matches, e.g. to replace an empty Or
+func False() Cond {
+	return func(p *Params) (string, error) {
+		return "0", nil
+	}
+}
+
+func Not(c Cond) Cond {
+	return func(p *Params) (string, error) {
+		expr, err := c(p)
+		if err != nil || expr == "" {
+			return expr, err
+		}
+		return "NOT (" + expr + ")", nil
+	}
+}
+
+// NotExists matches if the subquery yields no rows
+func NotExists(sub *SelectBuilder) Cond {
+	return func(p *Params) (string, error) {
+		stmt, err := sub.build(p)
+		if err != nil {
+			return "", fmt.Errorf("subquery: %w", err)
+		}
+		return "NOT EXISTS (" + stmt + ")", nil
+	}
+}
+
+// Filter translates f with query.SQLWhere. The columns returned by opts.Column are validated and quoted.
+func Filter(f query.Filter, opts query.SQLWhereOptions) Cond {
+	return func(p *Params) (string, error) {
+		wopts := opts
+		wopts.Column = func(name string) (string, error) {
+			col := name
+			if opts.Column != nil {
+				var err error
+				col, err = opts.Column(name)
+				if err != nil {
+					return "", err
+				}
+			}
+			return Ident(col)
+		}
+		wopts.ParamPrefix = fmt.Sprintf("f%03d_", p.idx)
+		p.idx++
+		expr, args, err := query.SQLWhere(f, wopts)
+		if err != nil {
+			return "", err
+		}
+		p.args = append(p.args, args...)
+		return expr, nil
+	}
+}
+
+type orderBy struct {
+	column string
+	order  query.SortOrder
+}
+
+type SelectBuilder struct {
+	distinct bool
+	columns  []string
+	exprs    []string
+	from     string
+	wheres   []Cond
+	orderBys []orderBy
+	limit    *int
+	offset   int
+}
+
+// Select starts a statement selecting columns
+func Select(columns ...string) *SelectBuilder {
+	return &SelectBuilder{columns: columns}
+}
+
+// SelectExpr starts a statement selecting exprs, which are trusted sql like COUNT(*)
+func SelectExpr(exprs ...string) *SelectBuilder {
+	return &SelectBuilder{exprs: exprs}
+}
+
+func (b *SelectBuilder) Distinct() *SelectBuilder {
+	b.distinct = true
+	return b
+}
+
+func (b *SelectBuilder) From(table string) *SelectBuilder {
+	b.from = table
+	return b
+}
+
+// Where adds conditions, which are combined with AND
+func (b *SelectBuilder) Where(cs ...Cond) *SelectBuilder {
+	b.wheres = append(b.wheres, cs...)
+	return b
+}
+
+// OrderBy sorts by column. query.SortNone sorts ascending.
+func (b *SelectBuilder) OrderBy(column string, order query.SortOrder) *SelectBuilder {
+	b.orderBys = append(b.orderBys, orderBy{column: column, order: order})
+	return b
+}
+
+// Limit limits the result to limit rows after offset. A negative limit returns all rows after offset.
+func (b *SelectBuilder) Limit(limit, offset int) *SelectBuilder {
+	b.limit = &limit
+	b.offset = offset
+	return b
+}
+
+// Build returns the statement and its named args
+func (b *SelectBuilder) Build() (string, []any, error) {
+	p := &Params{}
+	stmt, err := b.build(p)
+	if err != nil {
+		return "", nil, err
+	}
+	return stmt + ";", p.args, nil
+}
+
+func (b *SelectBuilder) build(p *Params) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("SELECT ")
+	if b.distinct {
+		sb.WriteString("DISTINCT ")
+	}
+	cols := append([]string{}, b.exprs...)
+	for _, col := range b.columns {
+		qcol, err := Ident(col)
+		if err != nil {
+			return "", err
+		}
+		cols = append(cols, qcol)
+	}
+	if len(cols) == 0 {
+		return "", fmt.Errorf("no columns selected")
+	}
+	sb.WriteString(strings.Join(cols, ", "))
+
+	from, err := Ident(b.from)
+	if err != nil {
+		return "", fmt.Errorf("from: %w", err)
+	}
+	sb.WriteString(" FROM " + from)
+
+	where, err := And(b.wheres...)(p)
+	if err != nil {
+		return "", fmt.Errorf("where: %w", err)
+	}
+	if where != "" {
+		sb.WriteString(" WHERE " + where)
+	}
+
+	var orders []string
+	for _, ob := range b.orderBys {
+		qcol, err := Ident(ob.column)
+		if err != nil {
+			return "", fmt.Errorf("order-by: %w", err)
+		}
+		switch ob.order {
+		case query.SortASC, query.SortNone, "":
+			orders = append(orders, qcol+" ASC")
+		case query.SortDESC:
+			orders = append(orders, qcol+" DESC")
+		default:
+			return "", fmt.Errorf("invalid sort order %q", ob.order)
+		}
+	}
+	if len(orders) > 0 {
+		sb.WriteString(" ORDER BY " + strings.Join(orders, ", "))
+	}
+
+	if b.limit != nil {
+		sb.WriteString(fmt.Sprintf(" LIMIT %s OFFSET %s", p.Add(*b.limit), p.Add(b.offset)))
+	}
+	return sb.String(), nil
+}
@@ -0,0 +1,78 @@
+package sqlb
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/mazzegi/mbox/query"
+	"github.com/mazzegi/mbox/testx"
+)
+
+func TestIdent(t *testing.T) {
+	tx := testx.NewTx(t)
+
+	for _, name := range []string{"a", "_index_b_c", "t.col"} {
+		_, err := Ident(name)
+		tx.AssertNoErr(err)
+	}
+	q, _ := Ident("t.col")
+	tx.AssertEqual(`"t"."col"`, q)
+	for _, name := range []string{"", "1a", "a b", `a"`, "a;DROP TABLE x", "a.", "a-b"} {
+		_, err := Ident(name)
+		tx.AssertErr(err)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	tx := testx.NewTx(t)
+
+	stmt, args, err := Select("key", "name").
+		From("items").
+		Where(
+			Eq("kind", "a"),
+			Or(Le("qty", 5), IsNull("qty")),
+			HasPrefix("name", "50%_"),
+			Filter(query.C("price", query.ComparatorGreater, 10), query.SQLWhereOptions{}),
+		).
+		OrderBy("name", query.SortDESC).
+		OrderBy("key", query.SortNone).
+		Limit(10, 20).
+		Build()
+	tx.AssertNoErr(err)
+	tx.AssertEqual(`SELECT "key", "name" FROM "items" WHERE ("kind" = :p000 AND ("qty" <= :p001 OR "qty" IS NULL) AND "name" LIKE :p002 ESCAPE '\' AND "price" > :f003_000) ORDER BY "name" DESC, "key" ASC LIMIT :p004 OFFSET :p005;`, stmt)
+	tx.AssertEqual([]any{
+		sql.Named("p000", "a"),
+		sql.Named("p001", 5),
+		sql.Named("p002", `50\%\_%`),
+		sql.Named("f003_000", 10),
+		sql.Named("p004", 10),
+		sql.Named("p005", 20),
+	}, args)
+
+	// subqueries share the params of the outer query
+	stmt, args, err = SelectExpr("COUNT(*)").From("idx").Where(
+		Eq("a", 1),
+		NotExists(SelectExpr("1").From("data").Where(Eq("data.bucket", "b"), EqCol("data.key", "idx.key"))),
+	).Build()
+	tx.AssertNoErr(err)
+	tx.AssertEqual(`SELECT COUNT(*) FROM "idx" WHERE ("a" = :p000 AND NOT EXISTS (SELECT 1 FROM "data" WHERE ("data"."bucket" = :p001 AND "data"."key" = "idx"."key")));`, stmt)
+	tx.AssertEqual(2, len(args))
+
+	stmt, _, err = Select("a").Distinct().From("t").Where(And(), Filter(nil, query.SQLWhereOptions{})).Build()
+	tx.AssertNoErr(err)
+	tx.AssertEqual(`SELECT DISTINCT "a" FROM "t";`, stmt)
+
+	// identifiers are validated everywhere
+	for _, b := range []*SelectBuilder{
+		Select("a; DROP TABLE t").From("t"),
+		Select("a").From("t --"),
+		Select("a").From("t").Where(Eq("a = 1 OR 1", 1)),
+		Select("a").From("t").OrderBy("a DESC, (SELECT 1)", query.SortASC),
+		Select("a").From("t").OrderBy("a", "DESC; DROP TABLE t"),
+		Select("a").From("t").Where(Filter(query.C("x y", query.ComparatorEqual, 1), query.SQLWhereOptions{})),
+		Select().From("t"),
+	} {
+		_, _, err := b.Build()
+		tx.AssertErr(err)
+	}
+}
@@ -0,0 +1,265 @@
+package sqlitex
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mazzegi/log"
+)
+
+// Backup writes a consistent copy of the database to dstPath while readers and writers continue.
+// The copy is written next to dstPath first and renamed when complete. Writes to in-memory databases wait for the backup.
+func (db *DB) Backup(ctx context.Context, dstPath string) error {
+	tmpPath := dstPath + ".tmp"
+	os.Remove(tmpPath)
+	// readers of in-memory databases are query_only, which refuses VACUUM, so those are backed up by the writer
+	pool := db.reader
+	if db.cfg.inMemory {
+		pool = db.writer
+	}
+	_, err := pool.ExecContext(ctx, "VACUUM INTO ?;", tmpPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("exec vacuum-into: %w", err)
+	}
+	err = os.Rename(tmpPath, dstPath)
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("rename: %w", err)
+	}
+	return nil
+}
+
+const (
+	backupPrefix     = "backup_"
+	backupSuffix     = ".db"
+	backupTimeLayout = "20060102_150405.000000"
+)
+
+// BackupRotating writes a new backup into dir and removes all but the latest retain backups
+func (db *DB) BackupRotating(ctx context.Context, dir string, retain int) (string, error) {
+	if retain <= 0 {
+		return "", fmt.Errorf("retain must be positive")
+	}
+	err := os.MkdirAll(dir, os.ModePerm)
+	if err != nil {
+		return "", fmt.Errorf("mkdir %q: %w", dir, err)
+	}
+	dstPath := filepath.Join(dir, backupPrefix+time.Now().UTC().Format(backupTimeLayout)+backupSuffix)
+	err = db.Backup(ctx, dstPath)
+	if err != nil {
+		return "", fmt.Errorf("backup: %w", err)
+	}
+	backups, err := Backups(dir)
+	if err != nil {
+		return dstPath, fmt.Errorf("backups: %w", err)
+	}
+	for len(backups) > retain {
+		err = os.Remove(backups[0])
+		if err != nil {
+			return dstPath, fmt.Errorf("remove %q: %w", backups[0], err)
+		}
+		backups = backups[1:]
+	}
+	return dstPath, nil
+}
+
+// Backups returns the backups written to dir by BackupRotating, oldest first
+func Backups(dir string) ([]string, error) {
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read-dir %q: %w", dir, err)
+	}
+	var backups []string
+	for _, de := range des {
+		name := de.Name()
+		if de.IsDir() || !strings.HasPrefix(name, backupPrefix) || !strings.HasSuffix(name, backupSuffix) {
+			continue
+		}
+		backups = append(backups, filepath.Join(dir, name))
+	}
+	// the timestamp layout sorts lexically
+	slices.Sort(backups)
+	return backups, nil
+}
+
+// RunBackups writes a backup into dir every interval and keeps the latest retain ones until ctx is done
+func (db *DB) RunBackups(ctx context.Context, dir string, interval time.Duration, retain int) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			path, err := db.BackupRotating(ctx, dir, retain)
+			if err != nil {
+				log.Errorf("backup-rotating: %v", err)
+				continue
+			}
+			log.Debugf("backup-rotating: wrote %q", path)
+		}
+	}
+}
+
+// Restore replaces the schema and content of the database with those of the backup at srcPath in one transaction.
+// Readers see either the old or the restored content. Caches built on top of the database,
+// like the index definitions of blobix_v2 stores, are not reloaded, so such stores should be reopened.
+// Foreign keys are not enforced during the restore, as tables are dropped and copied in no particular order.
+func (db *DB) Restore(ctx context.Context, srcPath string) error {
+	if _, err := os.Stat(srcPath); err != nil {
+		return fmt.Errorf("stat %q: %w", srcPath, err)
+	}
+	conn, err := db.writer.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("conn: %w", err)
+	}
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx, "ATTACH DATABASE ? AS restore_src;", srcPath)
+	if err != nil {
+		return fmt.Errorf("exec attach: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "DETACH DATABASE restore_src;")
+	// foreign_keys can't be changed within a transaction
+	var foreignKeys bool
+	err = conn.QueryRowContext(ctx, "PRAGMA foreign_keys;").Scan(&foreignKeys)
+	if err != nil {
+		return fmt.Errorf("scan foreign-keys: %w", err)
+	}
+	if foreignKeys {
+		_, err = conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF;")
+		if err != nil {
+			return fmt.Errorf("exec disable foreign-keys: %w", err)
+		}
+		defer conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON;")
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin-tx: %w", err)
+	}
+	defer tx.Rollback()
+	err = dropSchema(ctx, tx)
+	if err != nil {
+		return fmt.Errorf("drop-schema: %w", err)
+	}
+	err = copySchema(ctx, tx)
+	if err != nil {
+		return fmt.Errorf("copy-schema: %w", err)
+	}
+	err = copySequences(ctx, tx)
+	if err != nil {
+		return fmt.Errorf("copy-sequences: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+type schemaObject struct {
+	typ  string
+	name string
+	sql  string
+}
+
+func querySchema(ctx context.Context, tx *sql.Tx, schema string) ([]schemaObject, error) {
+	rows, err := tx.QueryContext(ctx, fmt.Sprintf(
+		"SELECT type, name, sql FROM %s.sqlite_master WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite\\_%%' ESCAPE '\\';", schema))
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	var objs []schemaObject
+	for rows.Next() {
+		var obj schemaObject
+		err = rows.Scan(&obj.typ, &obj.name, &obj.sql)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		objs = append(objs, obj)
+	}
+	return objs, rows.Err()
+}
+
+// dropSchema drops all tables and views of main. Indexes and triggers go with their tables.
+func dropSchema(ctx context.Context, tx *sql.Tx) error {
+	objs, err := querySchema(ctx, tx, "main")
+	if err != nil {
+		return fmt.Errorf("query-schema: %w", err)
+	}
+	for _, obj := range objs {
+		if obj.typ != "table" && obj.typ != "view" {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("DROP %s IF EXISTS main.%s;", strings.ToUpper(obj.typ), quoteIdent(obj.name)))
+		if err != nil {
+			return fmt.Errorf("exec drop %s %q: %w", obj.typ, obj.name, err)
+		}
+	}
+	return nil
+}
+
+// copySchema creates the tables of restore_src in main and copies their rows. Indexes, triggers and views are created after the rows.
+func copySchema(ctx context.Context, tx *sql.Tx) error {
+	objs, err := querySchema(ctx, tx, "restore_src")
+	if err != nil {
+		return fmt.Errorf("query-schema: %w", err)
+	}
+	for _, obj := range objs {
+		if obj.typ != "table" {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, obj.sql)
+		if err != nil {
+			return fmt.Errorf("exec create table %q: %w", obj.name, err)
+		}
+		_, err = tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO main.%[1]s SELECT * FROM restore_src.%[1]s;", quoteIdent(obj.name)))
+		if err != nil {
+			return fmt.Errorf("exec copy table %q: %w", obj.name, err)
+		}
+	}
+	for _, obj := range objs {
+		if obj.typ == "table" {
+			continue
+		}
+		_, err = tx.ExecContext(ctx, obj.sql)
+		if err != nil {
+			return fmt.Errorf("exec create %s %q: %w", obj.typ, obj.name, err)
+		}
+	}
+	return nil
+}
+
+// copySequences copies the AUTOINCREMENT counters, which may be ahead of the copied rows.
+// sqlite_sequence is skipped by querySchema, as it's created by sqlite along with the first AUTOINCREMENT table.
+func copySequences(ctx context.Context, tx *sql.Tx) error {
+	var n int
+	err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM restore_src.sqlite_master WHERE name = 'sqlite_sequence';").Scan(&n)
+	if err != nil {
+		return fmt.Errorf("scan: %w", err)
+	}
+	if n == 0 {
+		return nil
+	}
+	_, err = tx.ExecContext(ctx, "DELETE FROM main.sqlite_sequence;")
+	if err != nil {
+		return fmt.Errorf("exec delete: %w", err)
+	}
+	_, err = tx.ExecContext(ctx, "INSERT INTO main.sqlite_sequence (name, seq) SELECT name, seq FROM restore_src.sqlite_sequence;")
+	if err != nil {
+		return fmt.Errorf("exec copy: %w", err)
+	}
+	return nil
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
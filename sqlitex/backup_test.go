@@ -0,0 +1,196 @@
+package sqlitex
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mazzegi/mbox/testx"
+)
+
+func TestBackupRestore(t *testing.T) {
+	for _, d := range Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testBackupRestore(t, d)
+		})
+	}
+}
+
+func testBackupRestore(t *testing.T, d Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_backup_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	db, err := NewDB(filepath.Join(tmpFolderName, "test.db"), WithDriver(d))
+	tx.AssertNoErr(err)
+	defer db.Close()
+	err = Migrate(db, []Migration{
+		{Version: 1, Name: "init", SQL: `
+			CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT);
+			CREATE INDEX ix_items_name ON items (name);
+			CREATE VIEW named_items AS SELECT id FROM items WHERE name IS NOT NULL;
+			CREATE TABLE sqlitex_items (id INTEGER);
+			INSERT INTO sqlitex_items VALUES (1);`},
+	})
+	tx.AssertNoErr(err)
+	insert := func(from, to int) {
+		for n := from; n < to; n++ {
+			_, err := db.Exec("INSERT INTO items (id, name) VALUES(?,?);", n, fmt.Sprintf("item_%d", n))
+			tx.AssertNoErr(err)
+		}
+	}
+	count := func(table string) int {
+		var n int
+		err := db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s;", table)).Scan(&n)
+		tx.AssertNoErr(err)
+		return n
+	}
+	insert(0, 100)
+
+	ctx := context.Background()
+	backupFile := filepath.Join(tmpFolderName, "backup.db")
+	err = db.Backup(ctx, backupFile)
+	tx.AssertNoErr(err)
+	// the destination must not exist yet
+	err = db.Backup(ctx, backupFile)
+	tx.AssertNoErr(err)
+
+	insert(100, 150)
+	_, err = db.Exec("INSERT INTO sqlitex_items VALUES (2);")
+	tx.AssertNoErr(err)
+	_, err = db.Exec("CREATE TABLE later (id INTEGER);")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(150, count("items"))
+
+	err = db.Restore(ctx, backupFile)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(100, count("items"))
+	tx.AssertEqual(100, count("named_items"))
+	// only sqlite's own tables are skipped
+	tx.AssertEqual(1, count("sqlitex_items"))
+	var n int
+	err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name IN ('ix_items_name', 'later');").Scan(&n)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(1, n)
+	applied, err := AppliedMigrations(db)
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]int{1}, applied)
+	// the restored database is writable
+	insert(100, 110)
+	tx.AssertEqual(110, count("items"))
+
+	err = db.Restore(ctx, filepath.Join(tmpFolderName, "missing.db"))
+	tx.AssertErr(err)
+	tx.AssertEqual(110, count("items"))
+
+	backupDir := filepath.Join(tmpFolderName, "backups")
+	var paths []string
+	for range 4 {
+		path, err := db.BackupRotating(ctx, backupDir, 2)
+		tx.AssertNoErr(err)
+		paths = append(paths, path)
+	}
+	backups, err := Backups(backupDir)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(paths[2:], backups)
+}
+
+func TestRestoreForeignKeysAndSequences(t *testing.T) {
+	for _, d := range Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testRestoreForeignKeysAndSequences(t, d)
+		})
+	}
+}
+
+func testRestoreForeignKeysAndSequences(t *testing.T, d Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_restore_fk_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	db, err := NewDB(filepath.Join(tmpFolderName, "test.db"), WithDriver(d), WithForeignKeys(true))
+	tx.AssertNoErr(err)
+	defer db.Close()
+	// children sorts before parents, so it is copied first
+	_, err = db.Exec(`
+		CREATE TABLE parents (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT);
+		CREATE TABLE children (id INTEGER PRIMARY KEY, parent_id INTEGER NOT NULL REFERENCES parents(id));`)
+	tx.AssertNoErr(err)
+	for n := range 5 {
+		_, err = db.Exec("INSERT INTO parents (name) VALUES(?);", fmt.Sprintf("parent_%d", n))
+		tx.AssertNoErr(err)
+	}
+	_, err = db.Exec("INSERT INTO children (id, parent_id) VALUES(1, 1), (2, 2);")
+	tx.AssertNoErr(err)
+	// the sequence stays ahead of the rows
+	_, err = db.Exec("DELETE FROM parents WHERE id IN (4, 5);")
+	tx.AssertNoErr(err)
+
+	ctx := context.Background()
+	backupFile := filepath.Join(tmpFolderName, "backup.db")
+	err = db.Backup(ctx, backupFile)
+	tx.AssertNoErr(err)
+	_, err = db.Exec("INSERT INTO children (id, parent_id) VALUES(3, 3);")
+	tx.AssertNoErr(err)
+
+	err = db.Restore(ctx, backupFile)
+	tx.AssertNoErr(err)
+	var n int
+	err = db.QueryRow("SELECT COUNT(*) FROM children;").Scan(&n)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(2, n)
+	res, err := db.Exec("INSERT INTO parents (name) VALUES('parent_5');")
+	tx.AssertNoErr(err)
+	id, err := res.LastInsertId()
+	tx.AssertNoErr(err)
+	tx.AssertEqual(int64(6), id)
+	// foreign keys are enforced again
+	_, err = db.Exec("INSERT INTO children (id, parent_id) VALUES(4, 42);")
+	tx.AssertErr(err)
+	settings, err := db.Settings(ctx)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(true, settings.ForeignKeys)
+}
+
+func TestBackupInMemory(t *testing.T) {
+	for _, d := range Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testBackupInMemory(t, d)
+		})
+	}
+}
+
+func testBackupInMemory(t *testing.T, d Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_backup_in_memory_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	db, err := NewDB("test", WithDriver(d), WithInMemory())
+	tx.AssertNoErr(err)
+	defer db.Close()
+	_, err = db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY); INSERT INTO items (id) VALUES (1), (2);")
+	tx.AssertNoErr(err)
+	backupFile := filepath.Join(tmpFolderName, "backup.db")
+	err = db.Backup(context.Background(), backupFile)
+	tx.AssertNoErr(err)
+
+	restored, err := NewDB(backupFile, WithDriver(d))
+	tx.AssertNoErr(err)
+	defer restored.Close()
+	var n int
+	err = restored.QueryRow("SELECT COUNT(*) FROM items;").Scan(&n)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(2, n)
+}
@@ -3,60 +3,93 @@ package sqlitex
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
 	"fmt"
-	"strings"
-
-	_ "github.com/mattn/go-sqlite3"
+	"sync/atomic"
 )
 
-func NewDB(file string) (*DB, error) {
-	writer, err := setupWriter(file)
+func NewDB(file string, opts ...Option) (*DB, error) {
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	err := cfg.validate()
 	if err != nil {
-		return nil, fmt.Errorf("setup-writer: %w", err)
+		return nil, fmt.Errorf("validate-options: %w", err)
 	}
-	reader, err := setupReader(file)
+	_, drv, err := lookupDriver(cfg.driver)
 	if err != nil {
-		return nil, fmt.Errorf("setup-writer: %w", err)
+		return nil, fmt.Errorf("lookup-driver: %w", err)
 	}
-	return &DB{
+	inst := newInstrumentation()
+	writer := setupWriter(drv, file, cfg, inst)
+	reader := setupReader(drv, file, cfg, inst)
+	if cfg.inMemory {
+		// the in-memory database is gone when its last connection is closed, so the idle writer connection keeps it
+		err = writer.Ping()
+		if err != nil {
+			writer.Close()
+			reader.Close()
+			return nil, fmt.Errorf("ping: %w", err)
+		}
+	}
+	db := &DB{
 		writer: writer,
 		reader: reader,
-	}, nil
+		driver: cfg.driver,
+		cfg:    cfg,
+		inst:   inst,
+	}
+	db.SetRetryPolicy(cfg.retry)
+	return db, nil
 }
 
 type DB struct {
 	writer *sql.DB
 	reader *sql.DB
+	driver Driver
+	cfg    config
+	// retry may be replaced while transactions run
+	retry atomic.Pointer[RetryPolicy]
+	inst  *instrumentation
+}
+
+// The dsn params and pragmas are understood by all drivers alike. Pragmas are run on every new connection.
+func setupWriter(drv driver.Driver, file string, cfg config, inst *instrumentation) *sql.DB {
+	sdb := sql.OpenDB(&tracingConnector{
+		driver:  drv,
+		dsn:     cfg.writerDSN(file),
+		pragmas: pragmaStrings(cfg.writerPragmas()),
+		pool:    "writer",
+		inst:    inst,
+	})
+	sdb.SetMaxOpenConns(1)
+	return sdb
 }
 
-func setupWriter(file string) (*sql.DB, error) {
-	params := strings.Join([]string{
-		"_journal_mode=WAL",
-		"_synchronous=NORMAL",
-		"_busy_timeout=5000",
-		"_txlock=immediate",
-	}, "&")
-	dsn := fmt.Sprintf("file:%s?%s", file, params)
-	sdb, err := sql.Open("sqlite3", dsn)
-	if err != nil {
-		return nil, fmt.Errorf("open %q: %w", file, err)
-	}
-	sdb.SetMaxOpenConns(1)
-	return sdb, nil
+func setupReader(drv driver.Driver, file string, cfg config, inst *instrumentation) *sql.DB {
+	sdb := sql.OpenDB(&tracingConnector{
+		driver:  drv,
+		dsn:     cfg.readerDSN(file),
+		pragmas: pragmaStrings(cfg.readerPragmas()),
+		pool:    "reader",
+		inst:    inst,
+	})
+	sdb.SetMaxOpenConns(cfg.readerPoolSize)
+	return sdb
 }
 
-func setupReader(file string) (*sql.DB, error) {
-	params := strings.Join([]string{
-		"_busy_timeout=5000",
-		"mode=ro",
-	}, "&")
-	dsn := fmt.Sprintf("file:%s?%s", file, params)
-	sdb, err := sql.Open("sqlite3", dsn)
-	if err != nil {
-		return nil, fmt.Errorf("open %q: %w", file, err)
+func pragmaStrings(ps []pragma) []string {
+	var ss []string
+	for _, p := range ps {
+		ss = append(ss, p.String())
 	}
-	sdb.SetMaxOpenConns(5000)
-	return sdb, nil
+	return ss
+}
+
+// Driver returns the driver the database was opened with
+func (db *DB) Driver() Driver {
+	return db.driver
 }
 
 func (db *DB) Close() {
@@ -72,6 +105,12 @@ func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 	return db.writer.BeginTx(ctx, opts)
 }
 
+// BeginRead begins a read transaction on the reader pool. All reads of the transaction see the same snapshot,
+// which is held until the transaction ends, so it should not be kept open for long.
+func (db *DB) BeginRead(ctx context.Context) (*sql.Tx, error) {
+	return db.reader.BeginTx(ctx, nil)
+}
+
 func (db *DB) Exec(query string, args ...any) (sql.Result, error) {
 	return db.writer.ExecContext(context.Background(), query, args...)
 }
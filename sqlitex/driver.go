@@ -0,0 +1,87 @@
+package sqlitex
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"slices"
+)
+
+// Driver selects the SQLite driver
+type Driver string
+
+const (
+	// DriverMattn is github.com/mattn/go-sqlite3, which requires cgo
+	DriverMattn Driver = "mattn"
+	// DriverModernc is the pure Go modernc.org/sqlite, which allows builds with CGO_ENABLED=0
+	DriverModernc Driver = "modernc"
+)
+
+// driverAdapter hides the differences of the drivers
+type driverAdapter struct {
+	// sqlName is the name the driver is registered with at database/sql
+	sqlName string
+	// resultCode returns the extended SQLite result code of err
+	resultCode func(err error) (int, bool)
+}
+
+var driverAdapters = map[Driver]driverAdapter{}
+
+func registerDriver(d Driver, da driverAdapter) {
+	driverAdapters[d] = da
+}
+
+// Drivers returns the drivers available in this build
+func Drivers() []Driver {
+	var ds []Driver
+	for d := range driverAdapters {
+		ds = append(ds, d)
+	}
+	slices.Sort(ds)
+	return ds
+}
+
+// DefaultDriver is mattn if it's available and modernc otherwise
+func DefaultDriver() Driver {
+	if _, ok := driverAdapters[DriverMattn]; ok {
+		return DriverMattn
+	}
+	return DriverModernc
+}
+
+func lookupDriver(d Driver) (driverAdapter, driver.Driver, error) {
+	da, ok := driverAdapters[d]
+	if !ok {
+		return driverAdapter{}, nil, fmt.Errorf("driver %q is not available in this build", d)
+	}
+	// sql.Open doesn't connect, it just looks up the registered driver
+	sdb, err := sql.Open(da.sqlName, "")
+	if err != nil {
+		return driverAdapter{}, nil, fmt.Errorf("open %q: %w", da.sqlName, err)
+	}
+	defer sdb.Close()
+	return da, sdb.Driver(), nil
+}
+
+// SQLite result codes, see https://www.sqlite.org/rescode.html
+const (
+	codeBusy                 = 5
+	codeLocked               = 6
+	codeConstraint           = 19
+	codeConstraintCheck      = codeConstraint | 1<<8
+	codeConstraintForeignKey = codeConstraint | 3<<8
+	codeConstraintNotNull    = codeConstraint | 5<<8
+	codeConstraintPrimaryKey = codeConstraint | 6<<8
+	codeConstraintUnique     = codeConstraint | 8<<8
+	codeConstraintRowID      = codeConstraint | 10<<8
+)
+
+// resultCode returns the extended SQLite result code of err for any of the available drivers
+func resultCode(err error) (int, bool) {
+	for _, da := range driverAdapters {
+		if code, ok := da.resultCode(err); ok {
+			return code, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,25 @@
+//go:build cgo
+
+package sqlitex
+
+import (
+	"errors"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+func init() {
+	registerDriver(DriverMattn, driverAdapter{
+		sqlName: "sqlite3",
+		resultCode: func(err error) (int, bool) {
+			var serr sqlite3.Error
+			if !errors.As(err, &serr) {
+				return 0, false
+			}
+			if serr.ExtendedCode != 0 {
+				return int(serr.ExtendedCode), true
+			}
+			return int(serr.Code), true
+		},
+	})
+}
@@ -0,0 +1,20 @@
+package sqlitex
+
+import (
+	"errors"
+
+	"modernc.org/sqlite"
+)
+
+func init() {
+	registerDriver(DriverModernc, driverAdapter{
+		sqlName: "sqlite",
+		resultCode: func(err error) (int, bool) {
+			var serr *sqlite.Error
+			if !errors.As(err, &serr) {
+				return 0, false
+			}
+			return serr.Code(), true
+		},
+	})
+}
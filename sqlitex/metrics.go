@@ -0,0 +1,220 @@
+package sqlitex
+
+import (
+	"cmp"
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mazzegi/log"
+)
+
+const (
+	OpExec   = "exec"
+	OpQuery  = "query"
+	OpCommit = "commit"
+)
+
+// QueryEvent describes one executed statement
+type QueryEvent struct {
+	// Pool is either "writer" or "reader"
+	Pool  string
+	Op    string
+	Query string
+	Args  []driver.NamedValue
+	// Duration of queries ends when the rows are returned, so the time spent iterating them is not included
+	Duration time.Duration
+	Err      error
+}
+
+// Hook is called after every statement, also those within transactions and of prepared statements
+type Hook interface {
+	OnQuery(ctx context.Context, ev QueryEvent)
+	OnExec(ctx context.Context, ev QueryEvent)
+}
+
+type StatementStats struct {
+	Pool      string
+	Op        string
+	Statement string
+	Count     int64
+	Errors    int64
+	// Total and Max exclude the iteration of query rows, like QueryEvent.Duration
+	Total time.Duration
+	Max   time.Duration
+}
+
+// maxStatements limits the number of distinct statements tracked, the rest is accounted to otherStatement
+const (
+	maxStatements  = 1000
+	otherStatement = "other"
+)
+
+type statementKey struct {
+	pool      string
+	op        string
+	statement string
+}
+
+type hookHolder struct {
+	hook Hook
+}
+
+type instrumentation struct {
+	mx    sync.Mutex
+	stats map[statementKey]*StatementStats
+
+	hook          atomic.Pointer[hookHolder]
+	slowThreshold atomic.Int64
+}
+
+func newInstrumentation() *instrumentation {
+	return &instrumentation{
+		stats: make(map[statementKey]*StatementStats),
+	}
+}
+
+var (
+	placeholderListRx = regexp.MustCompile(`\?(\s*,\s*\?)+`)
+	// numbered named params like :key1, :key2 or :p000, :p001
+	namedListRx  = regexp.MustCompile(`:([A-Za-z_]+)\d+(\s*,\s*:[A-Za-z_]+\d+)+`)
+	whitespaceRx = regexp.MustCompile(`\s+`)
+)
+
+// normalizeStatement collapses whitespace and placeholder lists, so statements with varying IN lists are tracked as one
+func normalizeStatement(query string) string {
+	s := whitespaceRx.ReplaceAllString(strings.TrimSpace(query), " ")
+	s = placeholderListRx.ReplaceAllString(s, "?,...")
+	return namedListRx.ReplaceAllString(s, ":$1,...")
+}
+
+func (inst *instrumentation) observe(ctx context.Context, ev QueryEvent) {
+	stmt := normalizeStatement(ev.Query)
+	inst.mx.Lock()
+	key := statementKey{pool: ev.Pool, op: ev.Op, statement: stmt}
+	st, ok := inst.stats[key]
+	if !ok {
+		if len(inst.stats) >= maxStatements {
+			key.statement = otherStatement
+			st, ok = inst.stats[key]
+		}
+		if !ok {
+			st = &StatementStats{Pool: key.pool, Op: key.op, Statement: key.statement}
+			inst.stats[key] = st
+		}
+	}
+	st.Count++
+	if ev.Err != nil {
+		st.Errors++
+	}
+	st.Total += ev.Duration
+	st.Max = max(st.Max, ev.Duration)
+	inst.mx.Unlock()
+
+	if slow := time.Duration(inst.slowThreshold.Load()); slow > 0 && ev.Duration >= slow {
+		log.Warnf("sqlitex: slow %s on %s (%s, %d args): %s", ev.Op, ev.Pool, ev.Duration, len(ev.Args), stmt)
+	}
+	if hh := inst.hook.Load(); hh != nil {
+		if ev.Op == OpQuery {
+			hh.hook.OnQuery(ctx, ev)
+		} else {
+			hh.hook.OnExec(ctx, ev)
+		}
+	}
+}
+
+// SetHook sets the hook called after every statement. A nil hook removes it.
+func (db *DB) SetHook(h Hook) {
+	if h == nil {
+		db.inst.hook.Store(nil)
+		return
+	}
+	db.inst.hook.Store(&hookHolder{hook: h})
+}
+
+// SetSlowQueryThreshold logs statements taking at least d. A d <= 0 disables the log.
+func (db *DB) SetSlowQueryThreshold(d time.Duration) {
+	db.inst.slowThreshold.Store(int64(d))
+}
+
+// StatementStats returns the stats of all statements, the most time consuming first
+func (db *DB) StatementStats() []StatementStats {
+	db.inst.mx.Lock()
+	sts := make([]StatementStats, 0, len(db.inst.stats))
+	for _, st := range db.inst.stats {
+		sts = append(sts, *st)
+	}
+	db.inst.mx.Unlock()
+	slices.SortFunc(sts, func(a, b StatementStats) int {
+		if c := cmp.Compare(b.Total, a.Total); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Statement, b.Statement)
+	})
+	return sts
+}
+
+// ResetStatementStats drops all statement stats
+func (db *DB) ResetStatementStats() {
+	db.inst.mx.Lock()
+	defer db.inst.mx.Unlock()
+	db.inst.stats = make(map[statementKey]*StatementStats)
+}
+
+func promEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+// WritePrometheus writes statement and pool stats in the Prometheus text format
+func (db *DB) WritePrometheus(w io.Writer) error {
+	sts := db.StatementStats()
+	slices.SortFunc(sts, func(a, b StatementStats) int {
+		return strings.Compare(a.Pool+a.Op+a.Statement, b.Pool+b.Op+b.Statement)
+	})
+	var sb strings.Builder
+	metric := func(name, typ, help string, value func(st StatementStats) string) {
+		fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+		for _, st := range sts {
+			fmt.Fprintf(&sb, "%s{pool=\"%s\",op=\"%s\",statement=\"%s\"} %s\n",
+				name, st.Pool, st.Op, promEscape(st.Statement), value(st))
+		}
+	}
+	metric("sqlitex_statements_total", "counter", "Number of executed statements.",
+		func(st StatementStats) string { return fmt.Sprint(st.Count) })
+	metric("sqlitex_statement_errors_total", "counter", "Number of failed statements.",
+		func(st StatementStats) string { return fmt.Sprint(st.Errors) })
+	metric("sqlitex_statement_seconds_total", "counter", "Total time spent executing statements.",
+		func(st StatementStats) string { return fmt.Sprint(st.Total.Seconds()) })
+	metric("sqlitex_statement_max_seconds", "gauge", "Longest execution time of statements.",
+		func(st StatementStats) string { return fmt.Sprint(st.Max.Seconds()) })
+
+	writer, reader := db.Stats()
+	fmt.Fprintf(&sb, "# HELP sqlitex_open_connections Number of open connections.\n# TYPE sqlitex_open_connections gauge\n")
+	fmt.Fprintf(&sb, "sqlitex_open_connections{pool=\"writer\"} %d\nsqlitex_open_connections{pool=\"reader\"} %d\n", writer.OpenConnections, reader.OpenConnections)
+	fmt.Fprintf(&sb, "# HELP sqlitex_wait_total Number of connections waited for.\n# TYPE sqlitex_wait_total counter\n")
+	fmt.Fprintf(&sb, "sqlitex_wait_total{pool=\"writer\"} %d\nsqlitex_wait_total{pool=\"reader\"} %d\n", writer.WaitCount, reader.WaitCount)
+	fmt.Fprintf(&sb, "# HELP sqlitex_wait_seconds_total Time waited for connections.\n# TYPE sqlitex_wait_seconds_total counter\n")
+	fmt.Fprintf(&sb, "sqlitex_wait_seconds_total{pool=\"writer\"} %v\nsqlitex_wait_seconds_total{pool=\"reader\"} %v\n", writer.WaitDuration.Seconds(), reader.WaitDuration.Seconds())
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// MetricsHandler serves WritePrometheus
+func (db *DB) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		err := db.WritePrometheus(w)
+		if err != nil {
+			log.Errorf("write-prometheus: %v", err)
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package sqlitex
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mazzegi/mbox/testx"
+)
+
+type recordingHook struct {
+	mx      sync.Mutex
+	queries []QueryEvent
+	execs   []QueryEvent
+}
+
+func (h *recordingHook) OnQuery(ctx context.Context, ev QueryEvent) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	h.queries = append(h.queries, ev)
+}
+
+func (h *recordingHook) OnExec(ctx context.Context, ev QueryEvent) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	h.execs = append(h.execs, ev)
+}
+
+func TestMetrics(t *testing.T) {
+	for _, d := range Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testMetrics(t, d)
+		})
+	}
+}
+
+func testMetrics(t *testing.T, d Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_metrics_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	db, err := NewDB(filepath.Join(tmpFolderName, "test.db"), WithDriver(d))
+	tx.AssertNoErr(err)
+	defer db.Close()
+	hook := &recordingHook{}
+	db.SetHook(hook)
+	db.SetSlowQueryThreshold(time.Hour)
+
+	_, err = db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT);")
+	tx.AssertNoErr(err)
+	// statements within transactions and prepared statements are observed as well
+	stmt, err := db.PrepareExec("INSERT INTO items (id, name) VALUES(?, ?);")
+	tx.AssertNoErr(err)
+	err = db.WriteTx(context.Background(), func(stx *sql.Tx) error {
+		for n := range 10 {
+			_, err := stx.Stmt(stmt).Exec(n, fmt.Sprintf("item_%d", n))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	tx.AssertNoErr(err)
+	for _, ids := range [][]any{{1, 2}, {1, 2, 3, 4}} {
+		rows, err := db.Query(fmt.Sprintf("SELECT name FROM items WHERE id IN (%s);", strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")), ids...)
+		tx.AssertNoErr(err)
+		rows.Close()
+	}
+	_, err = db.Exec("INSERT INTO missing (id) VALUES(1);")
+	tx.AssertErr(err)
+
+	find := func(pool, op, statement string) StatementStats {
+		for _, st := range db.StatementStats() {
+			if st.Pool == pool && st.Op == op && st.Statement == statement {
+				return st
+			}
+		}
+		t.Fatalf("no stats for %s %s %q", pool, op, statement)
+		return StatementStats{}
+	}
+	tx.AssertEqual(int64(10), find("writer", OpExec, "INSERT INTO items (id, name) VALUES(?,...);").Count)
+	tx.AssertEqual(int64(1), find("writer", OpCommit, "COMMIT").Count)
+	tx.AssertEqual(int64(2), find("reader", OpQuery, "SELECT name FROM items WHERE id IN (?,...);").Count)
+	failed := find("writer", OpExec, "INSERT INTO missing (id) VALUES(1);")
+	tx.AssertEqual(int64(1), failed.Errors)
+
+	hook.mx.Lock()
+	tx.AssertEqual(2, len(hook.queries))
+	tx.AssertEqual(true, len(hook.execs) >= 13)
+	tx.AssertEqual("reader", hook.queries[0].Pool)
+	tx.AssertEqual(2, len(hook.queries[0].Args))
+	hook.mx.Unlock()
+
+	var buf bytes.Buffer
+	err = db.WritePrometheus(&buf)
+	tx.AssertNoErr(err)
+	out := buf.String()
+	tx.AssertEqual(true, strings.Contains(out, "# TYPE sqlitex_statements_total counter"))
+	tx.AssertEqual(true, strings.Contains(out, `sqlitex_statements_total{pool="writer",op="exec",statement="INSERT INTO items (id, name) VALUES(?,...);"} 10`))
+	tx.AssertEqual(true, strings.Contains(out, `sqlitex_statement_errors_total{pool="writer",op="exec",statement="INSERT INTO missing (id) VALUES(1);"} 1`))
+	tx.AssertEqual(true, strings.Contains(out, `sqlitex_open_connections{pool="writer"} 1`))
+
+	db.SetHook(nil)
+	db.ResetStatementStats()
+	_, err = db.Exec("DELETE FROM items;")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(1, len(db.StatementStats()))
+	hook.mx.Lock()
+	tx.AssertEqual(2, len(hook.queries))
+	hook.mx.Unlock()
+
+	tx.AssertEqual("SELECT * FROM t WHERE a = ? AND b IN (?,...)", normalizeStatement("SELECT *\n\tFROM t WHERE a = ? AND b IN (?, ?,?)"))
+	tx.AssertEqual("DELETE FROM t WHERE key IN (:key,...)", normalizeStatement("DELETE FROM t WHERE key IN (:key1, :key2, :key3)"))
+	tx.AssertEqual(`SELECT * FROM t WHERE "a" IN (:p,...) AND b = :p003`, normalizeStatement(`SELECT * FROM t WHERE "a" IN (:p000, :p001,:p002) AND b = :p003`))
+}
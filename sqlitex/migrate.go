@@ -0,0 +1,186 @@
+package sqlitex
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrMigrationChecksum = fmt.Errorf("migration-checksum-mismatch")
+
+// Migration is a numbered up-migration, which runs either SQL or Func in its own transaction.
+// The checksum of a Func migration covers only its name, so changes to the func body are not detected.
+type Migration struct {
+	Version int
+	Name    string
+	SQL     string
+	Func    func(tx *sql.Tx) error
+}
+
+// checksum identifies the content of a migration. Func migrations can only be identified by their name.
+func (m Migration) checksum() string {
+	var h [32]byte
+	if m.Func != nil {
+		h = sha256.Sum256([]byte("func:" + m.Name))
+	} else {
+		h = sha256.Sum256([]byte("sql:" + m.SQL))
+	}
+	return hex.EncodeToString(h[:])
+}
+
+const schemaVersionInit = `
+CREATE TABLE IF NOT EXISTS schema_version (
+	version		INTEGER PRIMARY KEY,
+	name		TEXT,
+	checksum	TEXT,
+	applied_on	TEXT
+);
+`
+
+func validateMigrations(migrations []Migration) error {
+	prev := 0
+	for _, m := range migrations {
+		if m.Version <= prev {
+			return fmt.Errorf("migration %d (%s): versions must be positive and ascending", m.Version, m.Name)
+		}
+		if (m.SQL == "") == (m.Func == nil) {
+			return fmt.Errorf("migration %d (%s): exactly one of sql and func must be set", m.Version, m.Name)
+		}
+		prev = m.Version
+	}
+	return nil
+}
+
+// Migrate applies all migrations which are not yet recorded in the schema_version table in order.
+// The checksums of applied migrations are verified, so they must not be changed once released.
+// A database which has migrations applied that are not in migrations, e.g. by a newer version, is refused with an error.
+func Migrate(db *DB, migrations []Migration) error {
+	err := validateMigrations(migrations)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(schemaVersionInit)
+	if err != nil {
+		return fmt.Errorf("exec schema-version-init: %w", err)
+	}
+	// a database migrated by a newer version is refused, as its schema may not fit this version
+	known := map[int]bool{}
+	for _, m := range migrations {
+		known[m.Version] = true
+	}
+	applied, err := AppliedMigrations(db)
+	if err != nil {
+		return fmt.Errorf("applied-migrations: %w", err)
+	}
+	for _, v := range applied {
+		if !known[v] {
+			return fmt.Errorf("unknown migration %d was applied to the database", v)
+		}
+	}
+	for _, m := range migrations {
+		err := migrate(db, m)
+		if err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// migrate applies m unless it was applied already. The check runs in the migration transaction,
+// so concurrent migrations of the same database apply m only once.
+func migrate(db *DB, m Migration) error {
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return fmt.Errorf("begin-tx: %w", err)
+	}
+	defer tx.Rollback()
+	var checksum string
+	err = tx.QueryRow("SELECT checksum FROM schema_version WHERE version = ?;", m.Version).Scan(&checksum)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return fmt.Errorf("scan checksum: %w", err)
+	case checksum != m.checksum():
+		return fmt.Errorf("applied checksum %s differs: %w", checksum, ErrMigrationChecksum)
+	default:
+		return nil
+	}
+
+	if m.Func != nil {
+		err = m.Func(tx)
+	} else {
+		_, err = tx.Exec(m.SQL)
+	}
+	if err != nil {
+		return fmt.Errorf("apply: %w", err)
+	}
+	_, err = tx.Exec("INSERT INTO schema_version (version, name, checksum, applied_on) VALUES(?,?,?,?);",
+		m.Version, m.Name, m.checksum(), time.Now().UTC().Format(time.RFC3339Nano))
+	if err != nil {
+		return fmt.Errorf("exec insert schema-version: %w", err)
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+// AppliedMigrations returns the versions recorded in the schema_version table in ascending order
+func AppliedMigrations(db *DB) ([]int, error) {
+	rows, err := db.Query("SELECT version FROM schema_version ORDER BY version;")
+	if err != nil {
+		return nil, fmt.Errorf("query: %w", err)
+	}
+	defer rows.Close()
+	var vs []int
+	var v int
+	for rows.Next() {
+		err = rows.Scan(&v)
+		if err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		vs = append(vs, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows: %w", err)
+	}
+	return vs, nil
+}
+
+// AddColumnIfNotExists adds a column to table unless it exists. It's meant for migrations of schemas,
+// which were created before they were managed by migrations.
+func AddColumnIfNotExists(tx *sql.Tx, table string, column string, decl string) error {
+	rows, err := tx.Query(fmt.Sprintf("SELECT name FROM pragma_table_info('%s');", table))
+	if err != nil {
+		return fmt.Errorf("query table-info: %w", err)
+	}
+	var name string
+	var exists bool
+	for rows.Next() {
+		err = rows.Scan(&name)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("scan: %w", err)
+		}
+		if name == column {
+			exists = true
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows: %w", err)
+	}
+	if exists {
+		return nil
+	}
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", table, column, decl))
+	if err != nil {
+		return fmt.Errorf("exec alter-table: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package sqlitex
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mazzegi/mbox/testx"
+)
+
+func TestMigrate(t *testing.T) {
+	for _, d := range Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testMigrate(t, d)
+		})
+	}
+}
+
+func testMigrate(t *testing.T, d Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_migrate_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	db, err := NewDB(filepath.Join(tmpFolderName, "test.db"), WithDriver(d))
+	tx.AssertNoErr(err)
+	defer db.Close()
+
+	migrations := []Migration{
+		{Version: 1, Name: "init", SQL: "CREATE TABLE items (id TEXT PRIMARY KEY);"},
+		{Version: 2, Name: "items add name", Func: func(tx *sql.Tx) error {
+			return AddColumnIfNotExists(tx, "items", "name", "TEXT")
+		}},
+	}
+	err = Migrate(db, migrations)
+	tx.AssertNoErr(err)
+	_, err = db.Exec("INSERT INTO items (id, name) VALUES('a', 'A');")
+	tx.AssertNoErr(err)
+	applied, err := AppliedMigrations(db)
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]int{1, 2}, applied)
+
+	// applied migrations are skipped
+	err = Migrate(db, migrations)
+	tx.AssertNoErr(err)
+
+	// a failing migration is rolled back and not recorded
+	failing := append(migrations,
+		Migration{Version: 3, Name: "tags", SQL: "CREATE TABLE tags (id TEXT); CREATE TABLE broken (;"},
+	)
+	err = Migrate(db, failing)
+	tx.AssertErr(err)
+	var n int
+	err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'tags';").Scan(&n)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(0, n)
+
+	migrations = append(migrations, Migration{Version: 3, Name: "tags", SQL: "CREATE TABLE tags (id TEXT);"})
+	err = Migrate(db, migrations)
+	tx.AssertNoErr(err)
+	applied, err = AppliedMigrations(db)
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]int{1, 2, 3}, applied)
+
+	// released migrations must not change
+	changed := append([]Migration{}, migrations...)
+	changed[0].SQL = "CREATE TABLE items (id TEXT PRIMARY KEY, name TEXT);"
+	err = Migrate(db, changed)
+	tx.AssertEqual(true, errors.Is(err, ErrMigrationChecksum))
+
+	// a database migrated by a newer version is rejected
+	err = Migrate(db, migrations[:2])
+	tx.AssertErr(err)
+
+	err = Migrate(db, []Migration{{Version: 2, SQL: "SELECT 1;"}, {Version: 1, SQL: "SELECT 1;"}})
+	tx.AssertErr(err)
+	err = Migrate(db, []Migration{{Version: 1, SQL: "SELECT 1;", Func: func(*sql.Tx) error { return nil }}})
+	tx.AssertErr(err)
+}
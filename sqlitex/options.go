@@ -0,0 +1,324 @@
+package sqlitex
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+type JournalMode string
+
+const (
+	JournalDelete   JournalMode = "DELETE"
+	JournalTruncate JournalMode = "TRUNCATE"
+	JournalPersist  JournalMode = "PERSIST"
+	JournalMemory   JournalMode = "MEMORY"
+	JournalWAL      JournalMode = "WAL"
+	JournalOff      JournalMode = "OFF"
+)
+
+var journalModes = []JournalMode{JournalDelete, JournalTruncate, JournalPersist, JournalMemory, JournalWAL, JournalOff}
+
+// Synchronous trades durability for write speed, see https://www.sqlite.org/pragma.html#pragma_synchronous
+type Synchronous string
+
+const (
+	SynchronousOff    Synchronous = "OFF"
+	SynchronousNormal Synchronous = "NORMAL"
+	SynchronousFull   Synchronous = "FULL"
+	SynchronousExtra  Synchronous = "EXTRA"
+)
+
+// the order matches the values sqlite reports
+var synchronousModes = []Synchronous{SynchronousOff, SynchronousNormal, SynchronousFull, SynchronousExtra}
+
+type pragma struct {
+	name  string
+	value string
+}
+
+func (p pragma) String() string {
+	return fmt.Sprintf("%s = %s", p.name, p.value)
+}
+
+type config struct {
+	driver         Driver
+	inMemory       bool
+	readOnly       bool
+	journalMode    JournalMode
+	synchronous    Synchronous
+	busyTimeout    time.Duration
+	cacheSizeKiB   int
+	mmapSize       int64
+	foreignKeys    bool
+	readerPoolSize int
+	pragmas        []pragma
+	retry          RetryPolicy
+}
+
+func defaultConfig() config {
+	return config{
+		driver:         DefaultDriver(),
+		journalMode:    JournalWAL,
+		synchronous:    SynchronousNormal,
+		busyTimeout:    5 * time.Second,
+		readerPoolSize: 5000,
+		retry:          DefaultRetryPolicy,
+	}
+}
+
+var pragmaNameRx = regexp.MustCompile(`^[a-z_]+$`)
+var pragmaValueRx = regexp.MustCompile(`^-?[A-Za-z0-9_]+$`)
+
+func (c config) validate() error {
+	if c.readOnly && c.inMemory {
+		return fmt.Errorf("an in-memory database can't be read-only")
+	}
+	if !slices.Contains(journalModes, c.journalMode) {
+		return fmt.Errorf("invalid journal mode %q", c.journalMode)
+	}
+	if !slices.Contains(synchronousModes, c.synchronous) {
+		return fmt.Errorf("invalid synchronous mode %q", c.synchronous)
+	}
+	if c.busyTimeout < 0 {
+		return fmt.Errorf("busy timeout must not be negative")
+	}
+	if c.cacheSizeKiB < 0 {
+		return fmt.Errorf("cache size must not be negative")
+	}
+	if c.mmapSize < 0 {
+		return fmt.Errorf("mmap size must not be negative")
+	}
+	if c.readerPoolSize <= 0 {
+		return fmt.Errorf("reader pool size must be positive")
+	}
+	for _, p := range c.pragmas {
+		if !pragmaNameRx.MatchString(p.name) {
+			return fmt.Errorf("invalid pragma name %q", p.name)
+		}
+		if !pragmaValueRx.MatchString(p.value) {
+			return fmt.Errorf("invalid value %q of pragma %q", p.value, p.name)
+		}
+	}
+	return nil
+}
+
+// connPragmas are run on every new connection of both pools
+func (c config) connPragmas() []pragma {
+	ps := []pragma{
+		{"busy_timeout", fmt.Sprintf("%d", c.busyTimeout.Milliseconds())},
+	}
+	if c.cacheSizeKiB > 0 {
+		// negative values are KiB, positive values are pages
+		ps = append(ps, pragma{"cache_size", fmt.Sprintf("-%d", c.cacheSizeKiB)})
+	}
+	if c.mmapSize > 0 {
+		ps = append(ps, pragma{"mmap_size", fmt.Sprintf("%d", c.mmapSize)})
+	}
+	if c.foreignKeys {
+		ps = append(ps, pragma{"foreign_keys", "ON"})
+	}
+	return ps
+}
+
+func (c config) writerPragmas() []pragma {
+	if c.readOnly {
+		// journal mode and synchronous are left as they are in the file
+		return append(c.connPragmas(), c.pragmas...)
+	}
+	ps := append([]pragma{
+		{"journal_mode", string(c.journalMode)},
+		{"synchronous", string(c.synchronous)},
+	}, c.connPragmas()...)
+	return append(ps, c.pragmas...)
+}
+
+func (c config) readerPragmas() []pragma {
+	ps := c.connPragmas()
+	if c.inMemory {
+		// the reader shares the database with the writer, so it can't be opened read-only
+		ps = append(ps, pragma{"query_only", "ON"})
+	}
+	return append(ps, c.pragmas...)
+}
+
+func (c config) writerDSN(file string) string {
+	if c.inMemory {
+		return fmt.Sprintf("file:%s?mode=memory&cache=shared&_txlock=immediate", file)
+	}
+	if c.readOnly {
+		return fmt.Sprintf("file:%s?mode=ro", file)
+	}
+	return fmt.Sprintf("file:%s?_txlock=immediate", file)
+}
+
+func (c config) readerDSN(file string) string {
+	if c.inMemory {
+		return fmt.Sprintf("file:%s?mode=memory&cache=shared", file)
+	}
+	return fmt.Sprintf("file:%s?mode=ro", file)
+}
+
+type Option func(*config)
+
+// WithDriver selects the SQLite driver, see DefaultDriver
+func WithDriver(d Driver) Option {
+	return func(c *config) {
+		c.driver = d
+	}
+}
+
+// WithInMemory opens a shared-cache in-memory database, which is named by the file argument of NewDB.
+// The database lives as long as the DB isn't closed. Shared-cache uses table level locks,
+// so concurrent readers and writers may fail with busy errors, which are retried by ReadTx and WriteTx.
+func WithInMemory() Option {
+	return func(c *config) {
+		c.inMemory = true
+	}
+}
+
+// WithReadOnly opens the writer pool read-only as well, so the file isn't changed, not even its journal mode
+func WithReadOnly() Option {
+	return func(c *config) {
+		c.readOnly = true
+	}
+}
+
+// WithJournalMode defaults to JournalWAL
+func WithJournalMode(m JournalMode) Option {
+	return func(c *config) {
+		c.journalMode = m
+	}
+}
+
+// WithSynchronous defaults to SynchronousNormal
+func WithSynchronous(s Synchronous) Option {
+	return func(c *config) {
+		c.synchronous = s
+	}
+}
+
+// WithBusyTimeout defaults to 5 seconds
+func WithBusyTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.busyTimeout = d
+	}
+}
+
+// WithCacheSize sets the page cache size per connection in KiB. Zero keeps the sqlite default.
+func WithCacheSize(kib int) Option {
+	return func(c *config) {
+		c.cacheSizeKiB = kib
+	}
+}
+
+// WithMmapSize sets the max number of bytes used for memory mapped I/O per connection. Zero disables it.
+func WithMmapSize(size int64) Option {
+	return func(c *config) {
+		c.mmapSize = size
+	}
+}
+
+// WithForeignKeys enables the enforcement of foreign key constraints
+func WithForeignKeys(on bool) Option {
+	return func(c *config) {
+		c.foreignKeys = on
+	}
+}
+
+// WithReaderPoolSize limits the number of open reader connections, which defaults to 5000
+func WithReaderPoolSize(n int) Option {
+	return func(c *config) {
+		c.readerPoolSize = n
+	}
+}
+
+// WithPragma runs "PRAGMA name = value" on every new connection of the writer and reader pool
+func WithPragma(name string, value string) Option {
+	return func(c *config) {
+		c.pragmas = append(c.pragmas, pragma{name: strings.ToLower(name), value: value})
+	}
+}
+
+// WithRetryPolicy defaults to DefaultRetryPolicy
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(c *config) {
+		c.retry = p
+	}
+}
+
+// Settings are the effective settings of a DB as reported by sqlite
+type Settings struct {
+	Driver         Driver
+	InMemory       bool
+	ReadOnly       bool
+	JournalMode    JournalMode
+	Synchronous    Synchronous
+	BusyTimeout    time.Duration
+	CacheSizeKiB   int
+	MmapSize       int64
+	ForeignKeys    bool
+	ReaderPoolSize int
+}
+
+// Settings queries the effective settings on a writer connection
+func (db *DB) Settings(ctx context.Context) (Settings, error) {
+	s := Settings{
+		Driver:         db.driver,
+		InMemory:       db.cfg.inMemory,
+		ReadOnly:       db.cfg.readOnly,
+		ReaderPoolSize: db.cfg.readerPoolSize,
+	}
+	conn, err := db.writer.Conn(ctx)
+	if err != nil {
+		return s, fmt.Errorf("writer.conn: %w", err)
+	}
+	defer conn.Close()
+
+	var (
+		journalMode string
+		synchronous int
+		busyTimeout int64
+		cacheSize   int
+		pageSize    int
+		foreignKeys bool
+	)
+	for _, q := range []struct {
+		pragma string
+		dest   any
+	}{
+		{"journal_mode", &journalMode},
+		{"synchronous", &synchronous},
+		{"busy_timeout", &busyTimeout},
+		{"cache_size", &cacheSize},
+		{"page_size", &pageSize},
+		{"mmap_size", &s.MmapSize},
+		{"foreign_keys", &foreignKeys},
+	} {
+		err := conn.QueryRowContext(ctx, fmt.Sprintf("PRAGMA %s;", q.pragma)).Scan(q.dest)
+		if errors.Is(err, sql.ErrNoRows) {
+			// e.g. mmap_size of in-memory databases
+			continue
+		}
+		if err != nil {
+			return s, fmt.Errorf("query pragma %q: %w", q.pragma, err)
+		}
+	}
+	s.JournalMode = JournalMode(strings.ToUpper(journalMode))
+	if synchronous >= 0 && synchronous < len(synchronousModes) {
+		s.Synchronous = synchronousModes[synchronous]
+	}
+	s.BusyTimeout = time.Duration(busyTimeout) * time.Millisecond
+	if cacheSize < 0 {
+		s.CacheSizeKiB = -cacheSize
+	} else {
+		s.CacheSizeKiB = cacheSize * pageSize / 1024
+	}
+	s.ForeignKeys = foreignKeys
+	return s, nil
+}
@@ -0,0 +1,161 @@
+package sqlitex
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mazzegi/mbox/testx"
+)
+
+func TestOptions(t *testing.T) {
+	for _, d := range Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testOptions(t, d)
+		})
+	}
+}
+
+func testOptions(t *testing.T, d Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_options_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+	ctx := context.Background()
+
+	db, err := NewDB(filepath.Join(tmpFolderName, "default.db"), WithDriver(d))
+	tx.AssertNoErr(err)
+	defer db.Close()
+	s, err := db.Settings(ctx)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(d, s.Driver)
+	tx.AssertEqual(JournalWAL, s.JournalMode)
+	tx.AssertEqual(SynchronousNormal, s.Synchronous)
+	tx.AssertEqual(5*time.Second, s.BusyTimeout)
+	tx.AssertEqual(false, s.ForeignKeys)
+	tx.AssertEqual(5000, s.ReaderPoolSize)
+
+	db, err = NewDB(filepath.Join(tmpFolderName, "custom.db"),
+		WithDriver(d),
+		WithJournalMode(JournalDelete),
+		WithSynchronous(SynchronousFull),
+		WithBusyTimeout(time.Second),
+		WithCacheSize(4096),
+		WithMmapSize(1<<20),
+		WithForeignKeys(true),
+		WithReaderPoolSize(4),
+		WithPragma("temp_store", "MEMORY"),
+	)
+	tx.AssertNoErr(err)
+	defer db.Close()
+	s, err = db.Settings(ctx)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(JournalDelete, s.JournalMode)
+	tx.AssertEqual(SynchronousFull, s.Synchronous)
+	tx.AssertEqual(time.Second, s.BusyTimeout)
+	tx.AssertEqual(4096, s.CacheSizeKiB)
+	tx.AssertEqual(int64(1<<20), s.MmapSize)
+	tx.AssertEqual(true, s.ForeignKeys)
+	tx.AssertEqual(4, s.ReaderPoolSize)
+	var tempStore int
+	err = db.QueryRow("PRAGMA temp_store;").Scan(&tempStore)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(2, tempStore)
+
+	_, err = db.Exec(`
+		CREATE TABLE parents (id INTEGER PRIMARY KEY);
+		CREATE TABLE children (id INTEGER PRIMARY KEY, parent_id INTEGER REFERENCES parents(id));`)
+	tx.AssertNoErr(err)
+	err = db.WriteTx(ctx, func(stx *sql.Tx) error {
+		_, err := stx.Exec("INSERT INTO children (id, parent_id) VALUES(1, 1);")
+		return err
+	})
+	var cerr *ConstraintError
+	tx.AssertEqual(true, errors.As(err, &cerr))
+	tx.AssertEqual(ConstraintForeignKey, cerr.Kind)
+
+	_, err = NewDB(filepath.Join(tmpFolderName, "invalid.db"), WithDriver(d), WithSynchronous("FAST"))
+	tx.AssertErr(err)
+	_, err = NewDB(filepath.Join(tmpFolderName, "invalid.db"), WithDriver(d), WithPragma("user_version = 1; DROP TABLE x", "1"))
+	tx.AssertErr(err)
+	_, err = NewDB(filepath.Join(tmpFolderName, "invalid.db"), WithDriver(d), WithReaderPoolSize(0))
+	tx.AssertErr(err)
+	_, err = NewDB("invalid", WithDriver(d), WithInMemory(), WithReadOnly())
+	tx.AssertErr(err)
+
+	// read-only keeps the journal mode of the file and rejects writes
+	db, err = NewDB(filepath.Join(tmpFolderName, "custom.db"), WithDriver(d), WithReadOnly())
+	tx.AssertNoErr(err)
+	defer db.Close()
+	s, err = db.Settings(ctx)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(true, s.ReadOnly)
+	tx.AssertEqual(JournalDelete, s.JournalMode)
+	_, err = db.Exec("INSERT INTO parents (id) VALUES(1);")
+	tx.AssertErr(err)
+	var numParents int
+	err = db.QueryRow("SELECT COUNT(*) FROM parents;").Scan(&numParents)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(0, numParents)
+}
+
+func TestInMemory(t *testing.T) {
+	for _, d := range Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testInMemory(t, d)
+		})
+	}
+}
+
+func testInMemory(t *testing.T, d Driver) {
+	tx := testx.NewTx(t)
+	ctx := context.Background()
+
+	name := fmt.Sprintf("test_in_memory_%s", d)
+	db, err := NewDB(name, WithDriver(d), WithInMemory())
+	tx.AssertNoErr(err)
+	s, err := db.Settings(ctx)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(true, s.InMemory)
+	tx.AssertEqual(JournalMemory, s.JournalMode)
+
+	_, err = db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT);")
+	tx.AssertNoErr(err)
+	_, err = db.Exec("INSERT INTO items (id, name) VALUES(1, 'a');")
+	tx.AssertNoErr(err)
+	count := func(db *DB) int {
+		var n int
+		err := db.QueryRow("SELECT COUNT(*) FROM items;").Scan(&n)
+		tx.AssertNoErr(err)
+		return n
+	}
+	// the reader pool sees the data of the writer, but can't write
+	tx.AssertEqual(1, count(db))
+	err = db.ReadTx(ctx, func(rtx *sql.Tx) error {
+		_, err := rtx.Exec("DELETE FROM items;")
+		return err
+	})
+	tx.AssertErr(err)
+
+	// other names are other databases
+	other, err := NewDB(name+"_other", WithDriver(d), WithInMemory())
+	tx.AssertNoErr(err)
+	defer other.Close()
+	err = other.QueryRow("SELECT COUNT(*) FROM items;").Scan(new(int))
+	tx.AssertErr(err)
+
+	// the database is gone after close
+	db.Close()
+	db, err = NewDB(name, WithDriver(d), WithInMemory())
+	tx.AssertNoErr(err)
+	defer db.Close()
+	err = db.QueryRow("SELECT COUNT(*) FROM items;").Scan(new(int))
+	tx.AssertErr(err)
+}
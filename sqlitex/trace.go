@@ -0,0 +1,225 @@
+package sqlitex
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// tracingConnector opens driver connections, which report every statement to the instrumentation of the db
+type tracingConnector struct {
+	driver  driver.Driver
+	dsn     string
+	pragmas []string
+	pool    string
+	inst    *instrumentation
+}
+
+func (c *tracingConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	for _, pragma := range c.pragmas {
+		err = execConn(ctx, conn, "PRAGMA "+pragma+";")
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("pragma %q: %w", pragma, err)
+		}
+	}
+	return &tracedConn{Conn: conn, pool: c.pool, inst: c.inst}, nil
+}
+
+func execConn(ctx context.Context, conn driver.Conn, query string) error {
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		_, err := execer.ExecContext(ctx, query, nil)
+		if err != driver.ErrSkip {
+			return err
+		}
+	}
+	stmt, err := conn.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	_, err = stmt.Exec(nil)
+	return err
+}
+
+func (c *tracingConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type tracedConn struct {
+	driver.Conn
+	pool string
+	inst *instrumentation
+}
+
+func (c *tracedConn) observe(ctx context.Context, op string, query string, args []driver.NamedValue, start time.Time, err error) {
+	if err == driver.ErrSkip {
+		// database/sql falls back to a prepared statement, which is observed instead
+		return
+	}
+	c.inst.observe(ctx, QueryEvent{
+		Pool:     c.pool,
+		Op:       op,
+		Query:    query,
+		Args:     args,
+		Duration: time.Since(start),
+		Err:      err,
+	})
+}
+
+func (c *tracedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	res, err := execer.ExecContext(ctx, query, args)
+	c.observe(ctx, OpExec, query, args, start, err)
+	return res, err
+}
+
+func (c *tracedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	c.observe(ctx, OpQuery, query, args, start, err)
+	return rows, err
+}
+
+func (c *tracedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tracedStmt{Stmt: stmt, conn: c, query: query}, nil
+}
+
+func (c *tracedConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *tracedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	var tx driver.Tx
+	var err error
+	if beginner, ok := c.Conn.(driver.ConnBeginTx); ok {
+		tx, err = beginner.BeginTx(ctx, opts)
+	} else {
+		tx, err = c.Conn.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tracedTx{Tx: tx, conn: c, ctx: ctx}, nil
+}
+
+func (c *tracedConn) Ping(ctx context.Context) error {
+	if pinger, ok := c.Conn.(driver.Pinger); ok {
+		return pinger.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *tracedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (c *tracedConn) ResetSession(ctx context.Context) error {
+	if resetter, ok := c.Conn.(driver.SessionResetter); ok {
+		return resetter.ResetSession(ctx)
+	}
+	return nil
+}
+
+// Raw returns the connection of the wrapped driver, e.g. for driver specific APIs
+func (c *tracedConn) Raw() driver.Conn {
+	return c.Conn
+}
+
+type tracedStmt struct {
+	driver.Stmt
+	conn  *tracedConn
+	query string
+}
+
+func (s *tracedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var res driver.Result
+	var err error
+	if execer, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = execer.ExecContext(ctx, args)
+	} else {
+		var vals []driver.Value
+		vals, err = namedValuesToValues(args)
+		if err == nil {
+			res, err = s.Stmt.Exec(vals)
+		}
+	}
+	s.conn.observe(ctx, OpExec, s.query, args, start, err)
+	return res, err
+}
+
+func (s *tracedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var rows driver.Rows
+	var err error
+	if queryer, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = queryer.QueryContext(ctx, args)
+	} else {
+		var vals []driver.Value
+		vals, err = namedValuesToValues(args)
+		if err == nil {
+			rows, err = s.Stmt.Query(vals)
+		}
+	}
+	s.conn.observe(ctx, OpQuery, s.query, args, start, err)
+	return rows, err
+}
+
+func (s *tracedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return s.conn.CheckNamedValue(nv)
+}
+
+func namedValuesToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	vals := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, fmt.Errorf("driver doesn't support named args")
+		}
+		vals[i] = arg.Value
+	}
+	return vals, nil
+}
+
+// tracedTx observes commits, which include the sync to disk
+type tracedTx struct {
+	driver.Tx
+	conn *tracedConn
+	ctx  context.Context
+}
+
+func (tx *tracedTx) Commit() error {
+	start := time.Now()
+	err := tx.Tx.Commit()
+	tx.conn.observe(tx.ctx, OpCommit, "COMMIT", nil, start, err)
+	return err
+}
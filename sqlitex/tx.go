@@ -0,0 +1,148 @@
+package sqlitex
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrBusy is returned when the database stayed busy or locked for all retries
+	ErrBusy       = fmt.Errorf("busy")
+	ErrConstraint = fmt.Errorf("constraint")
+)
+
+type ConstraintKind string
+
+const (
+	ConstraintUnique     ConstraintKind = "unique"
+	ConstraintPrimaryKey ConstraintKind = "primary-key"
+	ConstraintForeignKey ConstraintKind = "foreign-key"
+	ConstraintNotNull    ConstraintKind = "not-null"
+	ConstraintCheck      ConstraintKind = "check"
+	ConstraintOther      ConstraintKind = "other"
+)
+
+// ConstraintError is a constraint violation. It matches ErrConstraint with errors.Is.
+type ConstraintError struct {
+	Kind ConstraintKind
+	Err  error
+}
+
+func (e *ConstraintError) Error() string {
+	return fmt.Sprintf("%s constraint: %v", e.Kind, e.Err)
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ConstraintError) Is(target error) bool {
+	return target == ErrConstraint
+}
+
+// RetryPolicy controls how often and how long WriteTx and ReadTx retry on busy or locked databases
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     time.Second,
+}
+
+// SetRetryPolicy replaces the policy for transactions started afterwards. It's safe for concurrent use.
+func (db *DB) SetRetryPolicy(p RetryPolicy) {
+	db.retry.Store(&p)
+}
+
+// IsBusy reports whether err is caused by a busy or locked database
+func IsBusy(err error) bool {
+	if errors.Is(err, ErrBusy) {
+		return true
+	}
+	code, ok := resultCode(err)
+	return ok && (code&0xff == codeBusy || code&0xff == codeLocked)
+}
+
+// ClassifyError wraps constraint violations into a ConstraintError. Other errors are returned as they are.
+func ClassifyError(err error) error {
+	var cerr *ConstraintError
+	if err == nil || errors.As(err, &cerr) {
+		return err
+	}
+	code, ok := resultCode(err)
+	if !ok || code&0xff != codeConstraint {
+		return err
+	}
+	kind := ConstraintOther
+	switch code {
+	case codeConstraintUnique:
+		kind = ConstraintUnique
+	case codeConstraintPrimaryKey, codeConstraintRowID:
+		kind = ConstraintPrimaryKey
+	case codeConstraintForeignKey:
+		kind = ConstraintForeignKey
+	case codeConstraintNotNull:
+		kind = ConstraintNotNull
+	case codeConstraintCheck:
+		kind = ConstraintCheck
+	}
+	return &ConstraintError{Kind: kind, Err: err}
+}
+
+// WriteTx runs fn in a write transaction, which is committed if fn returns nil.
+// If the database is busy or locked, the whole transaction is retried, so fn may be called multiple times.
+func (db *DB) WriteTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return db.retryTx(ctx, db.writer, fn)
+}
+
+// ReadTx runs fn in a read transaction on the reader pool, so all reads of fn see the same snapshot of the database
+func (db *DB) ReadTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	return db.retryTx(ctx, db.reader, fn)
+}
+
+func (db *DB) retryTx(ctx context.Context, sdb *sql.DB, fn func(tx *sql.Tx) error) error {
+	retry := db.retry.Load()
+	backoff := retry.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := runTx(ctx, sdb, fn)
+		if err == nil {
+			return nil
+		}
+		if !IsBusy(err) {
+			return ClassifyError(err)
+		}
+		if attempt >= retry.MaxAttempts {
+			return fmt.Errorf("giving up after %d attempts: %w: %w", attempt, ErrBusy, err)
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, retry.MaxBackoff)
+	}
+}
+
+func runTx(ctx context.Context, sdb *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := sdb.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin-tx: %w", err)
+	}
+	defer tx.Rollback()
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package sqlitex
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mazzegi/mbox/testx"
+)
+
+func TestTx(t *testing.T) {
+	for _, d := range Drivers() {
+		t.Run(string(d), func(t *testing.T) {
+			testTx(t, d)
+		})
+	}
+}
+
+func testTx(t *testing.T, d Driver) {
+	tx := testx.NewTx(t)
+
+	tmpFolderName := fmt.Sprintf("test_tx_%s_%s", d, time.Now().Format("20060102_150405"))
+	err := os.MkdirAll(tmpFolderName, os.ModePerm)
+	tx.AssertNoErr(err)
+	defer os.RemoveAll(tmpFolderName)
+
+	db, err := NewDB(filepath.Join(tmpFolderName, "test.db"), WithDriver(d))
+	tx.AssertNoErr(err)
+	defer db.Close()
+	db.SetRetryPolicy(RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond})
+	ctx := context.Background()
+
+	err = db.WriteTx(ctx, func(stx *sql.Tx) error {
+		_, err := stx.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT NOT NULL UNIQUE, qty INTEGER CHECK (qty >= 0));")
+		return err
+	})
+	tx.AssertNoErr(err)
+	insert := func(id int, name any, qty int) error {
+		return db.WriteTx(ctx, func(stx *sql.Tx) error {
+			_, err := stx.Exec("INSERT INTO items (id, name, qty) VALUES(?,?,?);", id, name, qty)
+			return err
+		})
+	}
+	tx.AssertNoErr(insert(1, "a", 1))
+
+	assertConstraint := func(err error, kind ConstraintKind) {
+		tx.AssertEqual(true, errors.Is(err, ErrConstraint))
+		var cerr *ConstraintError
+		tx.AssertEqual(true, errors.As(err, &cerr))
+		tx.AssertEqual(kind, cerr.Kind)
+	}
+	assertConstraint(insert(1, "b", 1), ConstraintPrimaryKey)
+	assertConstraint(insert(2, "a", 1), ConstraintUnique)
+	assertConstraint(insert(2, nil, 1), ConstraintNotNull)
+	assertConstraint(insert(2, "b", -1), ConstraintCheck)
+
+	// busy errors are retried, other errors are not
+	var calls int
+	err = db.WriteTx(ctx, func(stx *sql.Tx) error {
+		calls++
+		if calls < 3 {
+			return fmt.Errorf("exec: %w", ErrBusy)
+		}
+		_, err := stx.Exec("INSERT INTO items (id, name, qty) VALUES(2, 'b', 2);")
+		return err
+	})
+	tx.AssertNoErr(err)
+	tx.AssertEqual(3, calls)
+
+	calls = 0
+	err = db.WriteTx(ctx, func(stx *sql.Tx) error {
+		calls++
+		_, err := stx.Exec("INSERT INTO items (id, name, qty) VALUES(3, 'c', 3);")
+		tx.AssertNoErr(err)
+		return ErrBusy
+	})
+	tx.AssertEqual(true, errors.Is(err, ErrBusy))
+	tx.AssertEqual(3, calls)
+
+	errOther := errors.New("other")
+	calls = 0
+	err = db.WriteTx(ctx, func(stx *sql.Tx) error {
+		calls++
+		return errOther
+	})
+	tx.AssertEqual(true, errors.Is(err, errOther))
+	tx.AssertEqual(1, calls)
+
+	cctx, cancel := context.WithCancel(ctx)
+	cancel()
+	err = db.WriteTx(cctx, func(stx *sql.Tx) error { return nil })
+	tx.AssertEqual(true, errors.Is(err, context.Canceled))
+
+	// reads within a read tx see one snapshot
+	count := func(q interface{ QueryRow(string, ...any) *sql.Row }) int {
+		var n int
+		err := q.QueryRow("SELECT COUNT(*) FROM items;").Scan(&n)
+		tx.AssertNoErr(err)
+		return n
+	}
+	err = db.ReadTx(ctx, func(rtx *sql.Tx) error {
+		before := count(rtx)
+		tx.AssertNoErr(insert(10, "x", 1))
+		tx.AssertEqual(before, count(rtx))
+		tx.AssertEqual(before+1, count(db))
+		return nil
+	})
+	tx.AssertNoErr(err)
+	err = db.ReadTx(ctx, func(rtx *sql.Tx) error {
+		_, err := rtx.Exec("DELETE FROM items;")
+		return err
+	})
+	tx.AssertErr(err)
+}
@@ -0,0 +1,160 @@
+package sqlx
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// fieldMapping maps a struct field to a column. The field is tagged like `sql:"name,pk,omitempty,readonly,json"`.
+type fieldMapping struct {
+	index     []int
+	name      string
+	column    string
+	pk        bool
+	omitEmpty bool
+	readOnly  bool
+	json      bool
+}
+
+// value returns the value written to the column, which is a JSON string for json fields
+func (f fieldMapping) value(rv reflect.Value) (any, error) {
+	fv := rv.FieldByIndex(f.index)
+	if !f.json {
+		return fv.Interface(), nil
+	}
+	if fv.Kind() == reflect.Pointer && fv.IsNil() {
+		return nil, nil
+	}
+	bs, err := json.Marshal(fv.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("json.marshal %q: %w", f.column, err)
+	}
+	return string(bs), nil
+}
+
+type typeMapping struct {
+	ty     reflect.Type
+	fields []fieldMapping
+	// invalid is the first invalid tag of ty. Reads ignore it, writes are refused, as they use the columns as identifiers.
+	invalid error
+}
+
+// writable returns an error if ty has tags which are not valid for writes
+func (m *typeMapping) writable() error {
+	return m.invalid
+}
+
+var typeMappings sync.Map // reflect.Type => *typeMapping
+
+var columnNameRx = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// mappingOf returns the cached mapping of struct type ty
+func mappingOf(ty reflect.Type) (*typeMapping, error) {
+	if m, ok := typeMappings.Load(ty); ok {
+		return m.(*typeMapping), nil
+	}
+	if ty.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("cannot map non-struct type %s", ty.String())
+	}
+	fields, invalid := mapFields(ty, nil)
+	m := &typeMapping{ty: ty, invalid: invalid}
+	columns := map[string]bool{}
+	for _, fm := range fields {
+		// outer fields are mapped first and shadow fields of embedded structs
+		if columns[fm.column] {
+			continue
+		}
+		columns[fm.column] = true
+		m.fields = append(m.fields, fm)
+	}
+	actual, _ := typeMappings.LoadOrStore(ty, m)
+	return actual.(*typeMapping), nil
+}
+
+// mapFields returns the fields of ty followed by the fields of its embedded structs.
+// Invalid column names, duplicate columns and unknown options don't stop the mapping, the first of them is returned as error.
+func mapFields(ty reflect.Type, parent []int) ([]fieldMapping, error) {
+	var fields []fieldMapping
+	var embedded []reflect.StructField
+	var invalid error
+	columns := map[string]bool{}
+	for i := 0; i < ty.NumField(); i++ {
+		sf := ty.Field(i)
+		tag := sf.Tag.Get("sql")
+		if tag == "-" {
+			continue
+		}
+		if sf.Anonymous && tag == "" && sf.Type.Kind() == reflect.Struct && !scanTarget(sf.Type) {
+			embedded = append(embedded, sf)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		fm := fieldMapping{
+			index:  append(append([]int{}, parent...), sf.Index...),
+			name:   sf.Name,
+			column: name,
+		}
+		if fm.column == "" {
+			fm.column = sf.Name
+		}
+		if !columnNameRx.MatchString(fm.column) && invalid == nil {
+			invalid = fmt.Errorf("invalid column name %q of field %s.%s", fm.column, ty.Name(), sf.Name)
+		}
+		if columns[fm.column] && invalid == nil {
+			invalid = fmt.Errorf("duplicate column name %q in %s", fm.column, ty.Name())
+		}
+		columns[fm.column] = true
+		for _, opt := range strings.Split(opts, ",") {
+			switch opt {
+			case "":
+			case "pk":
+				fm.pk = true
+			case "omitempty":
+				fm.omitEmpty = true
+			case "readonly":
+				fm.readOnly = true
+			case "json":
+				fm.json = true
+			default:
+				if invalid == nil {
+					invalid = fmt.Errorf("unknown option %q of field %s.%s", opt, ty.Name(), sf.Name)
+				}
+			}
+		}
+		fields = append(fields, fm)
+	}
+	for _, sf := range embedded {
+		efs, err := mapFields(sf.Type, append(append([]int{}, parent...), sf.Index...))
+		if err != nil && invalid == nil {
+			invalid = fmt.Errorf("embedded %s: %w", sf.Name, err)
+		}
+		fields = append(fields, efs...)
+	}
+	return fields, invalid
+}
+
+// structValue dereferences v, which has to be a struct or a pointer to one
+func structValue(v any) (reflect.Value, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return reflect.Value{}, fmt.Errorf("nil pointer")
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return reflect.Value{}, fmt.Errorf("cannot map non-struct type %T", v)
+	}
+	return rv, nil
+}
+
+func quoteIdent(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
+}
@@ -0,0 +1,71 @@
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"iter"
+
+	"github.com/mazzegi/mbox/query"
+)
+
+// Queryer is implemented by *sql.DB, *sql.Tx and *sqlitex.DB
+type Queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// QueryAll scans all rows of stmt into Ts, see ScanRow
+func QueryAll[T any](ctx context.Context, db Queryer, stmt string, args ...any) ([]T, error) {
+	var ts []T
+	for t, err := range QueryIter[T](ctx, db, stmt, args...) {
+		if err != nil {
+			return nil, err
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+// QueryOne scans the first row of stmt into T. Further rows are ignored.
+func QueryOne[T any](ctx context.Context, db Queryer, stmt string, args ...any) (T, query.Found, error) {
+	for t, err := range QueryIter[T](ctx, db, stmt, args...) {
+		if err != nil {
+			return t, false, err
+		}
+		return t, true, nil
+	}
+	var t T
+	return t, false, nil
+}
+
+// QueryIter iterates the rows of stmt scanned into Ts. Iteration stops after the first error.
+func QueryIter[T any](ctx context.Context, db Queryer, stmt string, args ...any) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		rows, err := db.QueryContext(ctx, stmt, args...)
+		if err != nil {
+			yield(zero, fmt.Errorf("query: %w", err))
+			return
+		}
+		defer rows.Close()
+		sc, err := NewScanner(rows, nil)
+		if err != nil {
+			yield(zero, fmt.Errorf("new-scanner: %w", err))
+			return
+		}
+		for sc.Next() {
+			t, err := ScanRow[T](sc)
+			if err != nil {
+				yield(zero, fmt.Errorf("scan-row: %w", err))
+				return
+			}
+			if !yield(t, nil) {
+				return
+			}
+		}
+		err = rows.Err()
+		if err != nil {
+			yield(zero, fmt.Errorf("rows: %w", err))
+		}
+	}
+}
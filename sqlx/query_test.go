@@ -0,0 +1,84 @@
+package sqlx
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/mazzegi/mbox/query"
+	"github.com/mazzegi/mbox/testx"
+)
+
+func TestQuery(t *testing.T) {
+	tx := testx.NewTx(t)
+	ctx := context.Background()
+
+	vals := [][3]any{}
+	for i := 0; i < 10; i++ {
+		vals = append(vals, [3]any{
+			fmt.Sprintf("%04d", i+1), i + 1, float64(i+1) + 0.1,
+		})
+	}
+	db, err := setupDB(vals)
+	tx.AssertNoErr(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	type testData struct {
+		Str  string `sql:"string"`
+		Int  int
+		Real float64 `sql:"real"`
+	}
+	expect := func(i int) testData {
+		return testData{Str: vals[i][0].(string), Int: vals[i][1].(int), Real: vals[i][2].(float64)}
+	}
+
+	tds, err := QueryAll[testData](ctx, db, `SELECT string, int AS Int, real FROM test WHERE int > ? ORDER BY string ASC;`, 7)
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]testData{expect(7), expect(8), expect(9)}, tds)
+
+	td, found, err := QueryOne[testData](ctx, db, `SELECT string, int AS Int, real FROM test WHERE int = ?;`, 3)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(true), found)
+	tx.AssertEqual(expect(2), td)
+	_, found, err = QueryOne[testData](ctx, db, `SELECT string, int AS Int, real FROM test WHERE int = ?;`, 42)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(query.Found(false), found)
+
+	// single columns scan into non-struct types
+	ints, err := QueryAll[int](ctx, db, `SELECT int FROM test ORDER BY int DESC LIMIT 3;`)
+	tx.AssertNoErr(err)
+	tx.AssertEqual([]int{10, 9, 8}, ints)
+	_, err = QueryAll[int](ctx, db, `SELECT int, real FROM test;`)
+	tx.AssertErr(err)
+
+	// iteration may stop early, which releases the connection
+	var n int
+	for td, err := range QueryIter[testData](ctx, db, `SELECT string, int AS Int, real FROM test ORDER BY string ASC;`) {
+		tx.AssertNoErr(err)
+		tx.AssertEqual(expect(n), td)
+		n++
+		if n == 5 {
+			break
+		}
+	}
+	tx.AssertEqual(5, n)
+	cnt, _, err := QueryOne[int](ctx, db, `SELECT COUNT(*) FROM test;`)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(10, cnt)
+
+	for _, err := range QueryIter[testData](ctx, db, `SELECT nope FROM test;`) {
+		tx.AssertErr(err)
+	}
+
+	// reads accept tags which are no valid identifiers for writes
+	type aggData struct {
+		Count int    `sql:"COUNT(*)"`
+		Max   string `sql:"my-col,unknown"`
+	}
+	agg, _, err := QueryOne[aggData](ctx, db, `SELECT COUNT(*), MAX(string) AS "my-col" FROM test;`)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(aggData{Count: 10, Max: "0010"}, agg)
+	_, err = Insert(ctx, db, "test", agg)
+	tx.AssertErr(err)
+}
@@ -34,8 +34,8 @@ func NewScanner(rows Rows, options *ScanOptions) (*Scanner, error) {
 	}
 	// prebuild values
 	sc.values = make([]any, len(columns))
-	for i, colType := range sc.columns {
-		sc.values[i] = nullType(colType)
+	for i := range sc.columns {
+		sc.values[i] = new(any)
 	}
 	return sc, nil
 }
@@ -45,65 +45,93 @@ type Scanner struct {
 	rows    Rows
 	columns []*sql.ColumnType
 	values  []any
+	plans   map[reflect.Type][]*fieldMapping
 }
 
 func (sc *Scanner) Next() bool {
 	return sc.rows.Next()
 }
 
-func Scan[T any](sc *Scanner, rows *sql.Rows) (T, error) {
-	var t T
-	if reflect.TypeOf(t).Kind() != reflect.Struct {
-		return t, fmt.Errorf("cannot scan into non-struct type %T", t)
+// plan returns the struct field of ty per column, which is nil for unmapped columns
+func (sc *Scanner) plan(ty reflect.Type) ([]*fieldMapping, error) {
+	if p, ok := sc.plans[ty]; ok {
+		return p, nil
 	}
-	// scan row into values
-	err := sc.rows.Scan(sc.values...)
+	m, err := mappingOf(ty)
 	if err != nil {
-		return t, fmt.Errorf("rows.scan: %w", err)
+		return nil, fmt.Errorf("mapping: %w", err)
 	}
-
-	rv := reflect.ValueOf(&t).Elem()
+	p := make([]*fieldMapping, len(sc.columns))
 	for i, col := range sc.columns {
-		// find related struct field
-		toElem, ok := findStructFieldByName(rv, col.Name(), sc.options)
+		f, ok := m.findField(col.Name(), sc.options)
 		if !ok {
 			if sc.options.DisallowUnknownFields {
-				return t, fmt.Errorf("no matching field in target for column %q", col.Name())
+				return nil, fmt.Errorf("no matching field in target for column %q", col.Name())
 			}
-			// otherwise
 			continue
 		}
-		if !toElem.CanSet() {
-			return t, fmt.Errorf("cannot set %s", toElem.Type().String())
+		p[i] = f
+	}
+	if sc.plans == nil {
+		sc.plans = map[reflect.Type][]*fieldMapping{}
+	}
+	sc.plans[ty] = p
+	return p, nil
+}
+
+// Deprecated: use ScanRow, rows are read from the scanner anyway
+func Scan[T any](sc *Scanner, rows *sql.Rows) (T, error) {
+	return ScanRow[T](sc)
+}
+
+// ScanRow scans the current row into a struct T. T may also be a non-struct type, if there is only one column.
+func ScanRow[T any](sc *Scanner) (T, error) {
+	var t T
+	// scan row into values
+	err := sc.rows.Scan(sc.values...)
+	if err != nil {
+		return t, fmt.Errorf("rows.scan: %w", err)
+	}
+
+	rv := reflect.ValueOf(&t).Elem()
+	if rv.Kind() != reflect.Struct || scanTarget(rv.Type()) {
+		if len(sc.values) != 1 {
+			return t, fmt.Errorf("cannot scan %d columns into non-struct type %T", len(sc.values), t)
 		}
-		conv, ok := sc.values[i].(converter)
-		if !ok {
-			return t, fmt.Errorf("source is not a converter but %T", sc.values[i])
+		return t, assignValue(sc.values[0], rv, false)
+	}
+	p, err := sc.plan(rv.Type())
+	if err != nil {
+		return t, err
+	}
+	for i, f := range p {
+		if f == nil {
+			continue
 		}
-		err := conv.convert(toElem)
+		err := assignValue(sc.values[i], rv.FieldByIndex(f.index), f.json)
 		if err != nil {
-			return t, fmt.Errorf("convert: %w", err)
+			return t, fmt.Errorf("column %q: %w", sc.columns[i].Name(), err)
 		}
 	}
-
 	return t, nil
 }
 
-func findStructFieldByName(sv reflect.Value, name string, options ScanOptions) (reflect.Value, bool) {
-	ty := sv.Type()
-	for i := 0; i < ty.NumField(); i++ {
-		sf := ty.Field(i)
-		if namesMatch(sf.Name, name, options) {
-			return sv.Field(i), true
-		}
-		if sqlTag := sf.Tag.Get("sql"); sqlTag != "" {
-			sqlName, _, _ := strings.Cut(sqlTag, ",")
-			if namesMatch(sqlName, name, options) {
-				return sv.Field(i), true
-			}
+func assignValue(value any, toElem reflect.Value, asJSON bool) error {
+	err := assign(*value.(*any), toElem, asJSON)
+	if err != nil {
+		return fmt.Errorf("assign: %w", err)
+	}
+	return nil
+}
+
+// findField returns the first field whose name or column matches name
+func (m *typeMapping) findField(name string, options ScanOptions) (*fieldMapping, bool) {
+	for i, f := range m.fields {
+		if namesMatch(f.name, name, options) || namesMatch(f.column, name, options) {
+			return &m.fields[i], true
 		}
 	}
-	return reflect.Value{}, false
+	return nil, false
 }
 
 func namesMatch(s1, s2 string, options ScanOptions) bool {
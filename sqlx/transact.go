@@ -1,6 +1,7 @@
 package sqlx
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 )
@@ -23,3 +24,21 @@ func Transact(db TransactionStarter, fn func(tx *sql.Tx) error) error {
 	}
 	return tx.Commit()
 }
+
+type TransactionStarterContext interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// TransactContext encapsulates the call to fn into a transaction started with ctx
+func TransactContext(ctx context.Context, db TransactionStarterContext, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin-tx: %w", err)
+	}
+	err = fn(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -2,92 +2,246 @@ package sqlx
 
 import (
 	"database/sql"
+	"encoding"
+	"encoding/json"
 	"fmt"
 	"reflect"
+	"strconv"
+	"time"
 )
 
-func nullType(colType *sql.ColumnType) any {
-	sct := colType.ScanType()
-	if sct == nil {
-		return &nullString{}
-	}
-
-	switch colType.ScanType().Kind() {
-	case reflect.Bool:
-		return &nullBool{}
-	case reflect.Int,
-		reflect.Int8,
-		reflect.Int16,
-		reflect.Int32,
-		reflect.Int64,
-		reflect.Uint,
-		reflect.Uint8,
-		reflect.Uint16,
-		reflect.Uint32,
-		reflect.Uint64:
-		return &nullInt{}
-	case reflect.Float32,
-		reflect.Float64:
-		return &nullFloat{}
-	default:
-		return &nullString{}
-	}
-}
-
-type converter interface {
-	convert(reflect.Value) error
-}
-
-type nullString struct {
-	sql.NullString
-}
-
-type nullInt struct {
-	sql.NullInt64
-}
+var (
+	scannerType         = reflect.TypeFor[sql.Scanner]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+	timeType            = reflect.TypeFor[time.Time]()
+)
 
-type nullFloat struct {
-	sql.NullFloat64
+// TimeLayouts are tried in order to parse time values stored as text
+var TimeLayouts = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
 }
 
-type nullBool struct {
-	sql.NullBool
+// scanTarget reports whether values of ty are set as a whole, even if ty is a struct
+func scanTarget(ty reflect.Type) bool {
+	pty := reflect.PointerTo(ty)
+	return ty == timeType || pty.Implements(scannerType) || pty.Implements(textUnmarshalerType)
 }
 
-func (n *nullString) convert(toElem reflect.Value) error {
-	if !n.Valid {
+// assign sets dst from src, which is a value returned by the driver.
+// NULL sets the zero value, so pointer fields are nil.
+func assign(src any, dst reflect.Value, asJSON bool) error {
+	if !dst.CanSet() {
+		return fmt.Errorf("cannot set %s", dst.Type().String())
+	}
+	if src == nil {
+		dst.SetZero()
 		return nil
 	}
-	return convert(n.String, toElem)
-}
-
-func (n *nullInt) convert(toElem reflect.Value) error {
-	if !n.Valid {
+	if dst.Kind() == reflect.Pointer {
+		nv := reflect.New(dst.Type().Elem())
+		err := assign(src, nv.Elem(), asJSON)
+		if err != nil {
+			return err
+		}
+		dst.Set(nv)
+		return nil
+	}
+	if asJSON {
+		s, err := text(src)
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal([]byte(s), dst.Addr().Interface())
+		if err != nil {
+			return fmt.Errorf("json.unmarshal: %w", err)
+		}
 		return nil
 	}
-	return convert(n.Int64, toElem)
+	if sc, ok := dst.Addr().Interface().(sql.Scanner); ok {
+		return sc.Scan(src)
+	}
+	if dst.Type() == timeType {
+		t, err := parseTime(src)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(t))
+		return nil
+	}
+	if tu, ok := dst.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		s, err := text(src)
+		if err != nil {
+			return err
+		}
+		return tu.UnmarshalText([]byte(s))
+	}
+	return assignBasic(src, dst)
 }
 
-func (n *nullFloat) convert(toElem reflect.Value) error {
-	if !n.Valid {
+func assignBasic(src any, dst reflect.Value) error {
+	switch dst.Kind() {
+	case reflect.String:
+		s, err := text(src)
+		if err != nil {
+			return err
+		}
+		dst.SetString(s)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		switch v := src.(type) {
+		case int64:
+			n = v
+		case float64:
+			// REAL columns are truncated, as the reflect conversion of the former scanner did
+			n = int64(v)
+		case bool:
+			if v {
+				n = 1
+			}
+		case string, []byte:
+			s, _ := text(v)
+			pn, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return fmt.Errorf("parse %q as int: %w", s, err)
+			}
+			n = pn
+		default:
+			return fmt.Errorf("cannot convert %T to %s", src, dst.Type().String())
+		}
+		if dst.OverflowInt(n) {
+			return fmt.Errorf("%d overflows %s", n, dst.Type().String())
+		}
+		dst.SetInt(n)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var n uint64
+		switch v := src.(type) {
+		case int64:
+			if v < 0 {
+				return fmt.Errorf("cannot convert negative %d to %s", v, dst.Type().String())
+			}
+			n = uint64(v)
+		case float64:
+			if v < 0 {
+				return fmt.Errorf("cannot convert negative %v to %s", v, dst.Type().String())
+			}
+			n = uint64(v)
+		case string, []byte:
+			s, _ := text(v)
+			pn, err := strconv.ParseUint(s, 10, 64)
+			if err != nil {
+				return fmt.Errorf("parse %q as uint: %w", s, err)
+			}
+			n = pn
+		default:
+			return fmt.Errorf("cannot convert %T to %s", src, dst.Type().String())
+		}
+		if dst.OverflowUint(n) {
+			return fmt.Errorf("%d overflows %s", n, dst.Type().String())
+		}
+		dst.SetUint(n)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		switch v := src.(type) {
+		case float64:
+			f = v
+		case int64:
+			f = float64(v)
+		case string, []byte:
+			s, _ := text(v)
+			pf, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return fmt.Errorf("parse %q as float: %w", s, err)
+			}
+			f = pf
+		default:
+			return fmt.Errorf("cannot convert %T to %s", src, dst.Type().String())
+		}
+		dst.SetFloat(f)
+		return nil
+	case reflect.Bool:
+		switch v := src.(type) {
+		case bool:
+			dst.SetBool(v)
+		case int64:
+			dst.SetBool(v != 0)
+		case string, []byte:
+			s, _ := text(v)
+			b, err := strconv.ParseBool(s)
+			if err != nil {
+				return fmt.Errorf("parse %q as bool: %w", s, err)
+			}
+			dst.SetBool(b)
+		default:
+			return fmt.Errorf("cannot convert %T to %s", src, dst.Type().String())
+		}
+		return nil
+	case reflect.Slice:
+		if dst.Type().Elem().Kind() == reflect.Uint8 {
+			switch v := src.(type) {
+			case []byte:
+				dst.SetBytes(append([]byte(nil), v...))
+				return nil
+			case string:
+				dst.SetBytes([]byte(v))
+				return nil
+			}
+		}
+	}
+	rvSrc := reflect.ValueOf(src)
+	if rvSrc.Type().AssignableTo(dst.Type()) {
+		dst.Set(rvSrc)
 		return nil
 	}
-	return convert(n.Float64, toElem)
+	return fmt.Errorf("cannot convert %T to %s", src, dst.Type().String())
 }
 
-func (n *nullBool) convert(toElem reflect.Value) error {
-	if !n.Valid {
-		return nil
+// text returns the text representation of driver value src
+func text(src any) (string, error) {
+	switch v := src.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	default:
+		return "", fmt.Errorf("cannot convert %T to text", src)
 	}
-	return convert(n.Bool, toElem)
 }
 
-func convert(src any, toElem reflect.Value) error {
-	rvSrc := reflect.ValueOf(src)
-	if !rvSrc.CanConvert(toElem.Type()) {
-		return fmt.Errorf("cannot convert %T to %s", src, toElem.Type().String())
+// parseTime accepts times, text in one of TimeLayouts and unix seconds
+func parseTime(src any) (time.Time, error) {
+	switch v := src.(type) {
+	case time.Time:
+		return v, nil
+	case int64:
+		return time.Unix(v, 0).UTC(), nil
+	case string, []byte:
+		s, _ := text(v)
+		for _, layout := range TimeLayouts {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("cannot parse %q as time", s)
+	default:
+		return time.Time{}, fmt.Errorf("cannot convert %T to time", src)
 	}
-	crv := rvSrc.Convert(toElem.Type())
-	toElem.Set(crv)
-	return nil
 }
@@ -0,0 +1,129 @@
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mazzegi/mbox/clock"
+	"github.com/mazzegi/mbox/date"
+	"github.com/mazzegi/mbox/money"
+	"github.com/mazzegi/mbox/testx"
+	_ "modernc.org/sqlite"
+)
+
+type typesTestBase struct {
+	ID      int64     `sql:"id,pk"`
+	Created time.Time `sql:"created"`
+}
+
+type typesTestAttrs struct {
+	Tags  []string          `sql:"tags,json"`
+	Props map[string]string `sql:"props,json"`
+}
+
+type typesTestItem struct {
+	typesTestBase
+	Attrs typesTestAttrs `sql:"attrs,json"`
+	Day   date.Date      `sql:"day"`
+	At    clock.Clock    `sql:"at"`
+	Price money.Money    `sql:"price"`
+	IP    net.IP         `sql:"ip"`
+	Note  *string        `sql:"note"`
+	Count *int           `sql:"count"`
+	Alias sql.NullString `sql:"alias"`
+}
+
+func TestScanTypes(t *testing.T) {
+	tx := testx.NewTx(t)
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite", ":memory:")
+	tx.AssertNoErr(err)
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`
+		CREATE TABLE items (
+			id		INTEGER PRIMARY KEY,
+			created	TEXT,
+			attrs	TEXT,
+			day		TEXT,
+			at		TEXT,
+			price	TEXT,
+			ip		TEXT,
+			note	TEXT,
+			count	INTEGER,
+			alias	TEXT
+		);
+	`)
+	tx.AssertNoErr(err)
+
+	note := "note"
+	count := 3
+	item := typesTestItem{
+		typesTestBase: typesTestBase{ID: 1, Created: time.Date(2024, 5, 6, 7, 8, 9, 10, time.UTC)},
+		Attrs:         typesTestAttrs{Tags: []string{"a", "b"}, Props: map[string]string{"k": "v"}},
+		Day:           date.Make(2024, 5, 6),
+		At:            clock.Make(7, 8, 9),
+		Price:         money.Euro(12.34),
+		IP:            net.ParseIP("10.0.0.1"),
+		Note:          &note,
+		Count:         &count,
+		Alias:         sql.NullString{String: "alias", Valid: true},
+	}
+	_, err = Insert(ctx, db, "items", item)
+	tx.AssertNoErr(err)
+	// net.IP is written as bytes, but text unmarshalers read text
+	_, err = db.Exec("UPDATE items SET ip = '10.0.0.1' WHERE id = 1;")
+	tx.AssertNoErr(err)
+	read, found, err := QueryOne[typesTestItem](ctx, db, "SELECT * FROM items WHERE id = ?;", 1)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(true, bool(found))
+	tx.AssertEqual(true, item.Created.Equal(read.Created))
+	tx.AssertEqual(item.Attrs, read.Attrs)
+	tx.AssertEqual(item.Day, read.Day)
+	tx.AssertEqual(item.At, read.At)
+	tx.AssertEqual(item.Price, read.Price)
+	tx.AssertEqual(item.IP.String(), read.IP.String())
+	tx.AssertEqual(note, *read.Note)
+	tx.AssertEqual(count, *read.Count)
+	tx.AssertEqual(item.Alias, read.Alias)
+
+	// NULLs leave pointers nil and values zero
+	_, err = db.Exec("INSERT INTO items (id) VALUES (2);")
+	tx.AssertNoErr(err)
+	read, _, err = QueryOne[typesTestItem](ctx, db, "SELECT * FROM items WHERE id = ?;", 2)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(true, read.Note == nil)
+	tx.AssertEqual(true, read.Count == nil)
+	tx.AssertEqual(false, read.Alias.Valid)
+	tx.AssertEqual(true, read.Created.IsZero())
+
+	// times are parsed from the text layouts sqlite uses
+	for _, s := range []string{"2024-05-06 07:08:09", "2024-05-06T07:08:09Z", "2024-05-06 07:08:09.000+00:00"} {
+		created, _, err := QueryOne[time.Time](ctx, db, "SELECT ?;", s)
+		tx.AssertNoErr(err)
+		tx.AssertEqual(true, created.Equal(time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)))
+	}
+	_, _, err = QueryOne[time.Time](ctx, db, "SELECT 'no time';")
+	tx.AssertErr(err)
+
+	// numbers are parsed from text and not converted to runes
+	n, _, err := QueryOne[int](ctx, db, "SELECT '42';")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(42, n)
+	s, _, err := QueryOne[string](ctx, db, "SELECT 65;")
+	tx.AssertNoErr(err)
+	tx.AssertEqual("65", s)
+	_, _, err = QueryOne[int8](ctx, db, "SELECT 1000;")
+	tx.AssertErr(err)
+	// reals are truncated into ints
+	n, _, err = QueryOne[int](ctx, db, "SELECT 2.7;")
+	tx.AssertNoErr(err)
+	tx.AssertEqual(2, n)
+	// numbers have no currency
+	_, _, err = QueryOne[money.Money](ctx, db, "SELECT 12.5;")
+	tx.AssertErr(err)
+}
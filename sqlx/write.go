@@ -0,0 +1,274 @@
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mazzegi/mbox/slicesx"
+)
+
+// Execer is implemented by *sql.DB, *sql.Tx and *sqlitex.DB
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// maxBatchParams is the default limit of host parameters per statement of sqlite
+const maxBatchParams = 32766
+
+type column struct {
+	name  string
+	value any
+}
+
+// writeColumns returns the columns of rv which are written. Omitempty fields with zero values are skipped.
+func (m *typeMapping) writeColumns(rv reflect.Value) ([]column, error) {
+	var cs []column
+	for _, f := range m.fields {
+		if f.readOnly {
+			continue
+		}
+		if f.omitEmpty && rv.FieldByIndex(f.index).IsZero() {
+			continue
+		}
+		v, err := f.value(rv)
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, column{name: f.column, value: v})
+	}
+	return cs, nil
+}
+
+func (m *typeMapping) pkColumns(rv reflect.Value) ([]column, error) {
+	var cs []column
+	for _, f := range m.fields {
+		if !f.pk {
+			continue
+		}
+		v, err := f.value(rv)
+		if err != nil {
+			return nil, err
+		}
+		cs = append(cs, column{name: f.column, value: v})
+	}
+	return cs, nil
+}
+
+func insertStatement(table string, cs []column) (string, []any) {
+	var names, params []string
+	var args []any
+	for _, c := range cs {
+		names = append(names, quoteIdent(c.name))
+		params = append(params, ":"+c.name)
+		args = append(args, sql.Named(c.name, c.value))
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", quoteIdent(table), strings.Join(names, ", "), strings.Join(params, ", ")), args
+}
+
+func mapValue(v any) (*typeMapping, reflect.Value, error) {
+	rv, err := structValue(v)
+	if err != nil {
+		return nil, rv, err
+	}
+	m, err := mappingOf(rv.Type())
+	if err != nil {
+		return nil, rv, fmt.Errorf("mapping: %w", err)
+	}
+	err = m.writable()
+	if err != nil {
+		return nil, rv, fmt.Errorf("mapping: %w", err)
+	}
+	return m, rv, nil
+}
+
+// Insert inserts the non-readonly fields of struct v into table
+func Insert(ctx context.Context, db Execer, table string, v any) (sql.Result, error) {
+	m, rv, err := mapValue(v)
+	if err != nil {
+		return nil, err
+	}
+	cs, err := m.writeColumns(rv)
+	if err != nil {
+		return nil, err
+	}
+	if len(cs) == 0 {
+		return nil, fmt.Errorf("no columns to insert for %s", m.ty.Name())
+	}
+	query, args := insertStatement(table, cs)
+	res, err := db.ExecContext(ctx, query+";", args...)
+	if err != nil {
+		return nil, fmt.Errorf("exec %q: %w", query, err)
+	}
+	return res, nil
+}
+
+// Update updates the non-readonly fields of struct v in the row of table which matches the pk fields of v.
+// It returns ErrNotFound if no row matches.
+func Update(ctx context.Context, db Execer, table string, v any) (sql.Result, error) {
+	m, rv, err := mapValue(v)
+	if err != nil {
+		return nil, err
+	}
+	pks, err := m.pkColumns(rv)
+	if err != nil {
+		return nil, err
+	}
+	if len(pks) == 0 {
+		return nil, fmt.Errorf("no pk fields in %s", m.ty.Name())
+	}
+	cs, err := m.writeColumns(rv)
+	if err != nil {
+		return nil, err
+	}
+	var sets []string
+	var args []any
+	for _, c := range cs {
+		if m.isPK(c.name) {
+			continue
+		}
+		sets = append(sets, fmt.Sprintf("%s = :%s", quoteIdent(c.name), c.name))
+		args = append(args, sql.Named(c.name, c.value))
+	}
+	if len(sets) == 0 {
+		return nil, fmt.Errorf("no columns to update for %s", m.ty.Name())
+	}
+	var wheres []string
+	for _, c := range pks {
+		wheres = append(wheres, fmt.Sprintf("%s = :%s", quoteIdent(c.name), c.name))
+		args = append(args, sql.Named(c.name, c.value))
+	}
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE %s", quoteIdent(table), strings.Join(sets, ", "), strings.Join(wheres, " AND "))
+	res, err := db.ExecContext(ctx, query+";", args...)
+	if err != nil {
+		return nil, fmt.Errorf("exec %q: %w", query, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("rows-affected: %w", err)
+	}
+	if n == 0 {
+		return nil, ErrNotFound
+	}
+	return res, nil
+}
+
+// Upsert inserts struct v into table or updates the row which conflicts on the pk fields
+func Upsert(ctx context.Context, db Execer, table string, v any) (sql.Result, error) {
+	m, rv, err := mapValue(v)
+	if err != nil {
+		return nil, err
+	}
+	pks, err := m.pkColumns(rv)
+	if err != nil {
+		return nil, err
+	}
+	if len(pks) == 0 {
+		return nil, fmt.Errorf("no pk fields in %s", m.ty.Name())
+	}
+	cs, err := m.writeColumns(rv)
+	if err != nil {
+		return nil, err
+	}
+	if len(cs) == 0 {
+		return nil, fmt.Errorf("no columns to insert for %s", m.ty.Name())
+	}
+	query, args := insertStatement(table, cs)
+	var conflicts, sets []string
+	for _, c := range pks {
+		conflicts = append(conflicts, quoteIdent(c.name))
+	}
+	for _, c := range cs {
+		if m.isPK(c.name) {
+			continue
+		}
+		sets = append(sets, fmt.Sprintf("%s = excluded.%s", quoteIdent(c.name), quoteIdent(c.name)))
+	}
+	if len(sets) == 0 {
+		query += fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", strings.Join(conflicts, ", "))
+	} else {
+		query += fmt.Sprintf(" ON CONFLICT (%s) DO UPDATE SET %s", strings.Join(conflicts, ", "), strings.Join(sets, ", "))
+	}
+	res, err := db.ExecContext(ctx, query+";", args...)
+	if err != nil {
+		return nil, fmt.Errorf("exec %q: %w", query, err)
+	}
+	return res, nil
+}
+
+func (m *typeMapping) isPK(column string) bool {
+	for _, f := range m.fields {
+		if f.column == column {
+			return f.pk
+		}
+	}
+	return false
+}
+
+// InsertMany inserts ts into table with one statement per chunk of chunkSize rows.
+// All rows have the same columns, so omitempty fields with zero values are inserted as NULL.
+// Pass a *sql.Tx as db to insert all or nothing.
+func InsertMany[T any](ctx context.Context, db Execer, table string, ts []T, chunkSize int) (int64, error) {
+	if len(ts) == 0 {
+		return 0, nil
+	}
+	if chunkSize <= 0 {
+		return 0, fmt.Errorf("chunk size must be positive")
+	}
+	m, err := mappingOf(reflect.TypeFor[T]())
+	if err != nil {
+		return 0, fmt.Errorf("mapping: %w", err)
+	}
+	err = m.writable()
+	if err != nil {
+		return 0, fmt.Errorf("mapping: %w", err)
+	}
+	var fields []fieldMapping
+	var names []string
+	for _, f := range m.fields {
+		if f.readOnly {
+			continue
+		}
+		fields = append(fields, f)
+		names = append(names, quoteIdent(f.column))
+	}
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("no columns to insert for %s", m.ty.Name())
+	}
+	chunkSize = min(chunkSize, maxBatchParams/len(fields))
+	rowParams := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(fields)), ", ") + ")"
+
+	var inserted int64
+	for _, chunk := range slicesx.Chunks(ts, chunkSize) {
+		rows := make([]string, len(chunk))
+		args := make([]any, 0, len(chunk)*len(fields))
+		for i, t := range chunk {
+			rows[i] = rowParams
+			rv := reflect.ValueOf(t)
+			for _, f := range fields {
+				if f.omitEmpty && rv.FieldByIndex(f.index).IsZero() {
+					args = append(args, nil)
+					continue
+				}
+				v, err := f.value(rv)
+				if err != nil {
+					return inserted, err
+				}
+				args = append(args, v)
+			}
+		}
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s;", quoteIdent(table), strings.Join(names, ", "), strings.Join(rows, ", "))
+		res, err := db.ExecContext(ctx, query, args...)
+		if err != nil {
+			return inserted, fmt.Errorf("exec insert of %d rows: %w", len(chunk), err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return inserted, fmt.Errorf("rows-affected: %w", err)
+		}
+		inserted += n
+	}
+	return inserted, nil
+}
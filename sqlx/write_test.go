@@ -0,0 +1,130 @@
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/mazzegi/mbox/testx"
+	_ "modernc.org/sqlite"
+)
+
+type writeTestItem struct {
+	ID      int64  `sql:"id,pk,omitempty"`
+	Name    string `sql:"name"`
+	Qty     int    `sql:"qty,omitempty"`
+	Created string `sql:"created,readonly"`
+	Note    string `sql:"-"`
+}
+
+func setupWriteDB() (*sql.DB, error) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return nil, fmt.Errorf("open memory db: %w", err)
+	}
+	// every connection has its own memory db
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`
+		CREATE TABLE items (
+			id		INTEGER PRIMARY KEY,
+			name	TEXT NOT NULL,
+			qty		INTEGER DEFAULT 7,
+			created	TEXT DEFAULT 'now'
+		);
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("exec create table: %w", err)
+	}
+	return db, nil
+}
+
+func TestWrite(t *testing.T) {
+	tx := testx.NewTx(t)
+	ctx := context.Background()
+
+	db, err := setupWriteDB()
+	tx.AssertNoErr(err)
+	defer db.Close()
+
+	type row struct {
+		name    string
+		qty     int
+		created string
+	}
+	find := func(id int64) (row, error) {
+		var r row
+		err := db.QueryRow("SELECT name, qty, created FROM items WHERE id = ?;", id).Scan(&r.name, &r.qty, &r.created)
+		return r, err
+	}
+
+	// omitempty zero values leave the column default
+	res, err := Insert(ctx, db, "items", writeTestItem{Name: "a", Created: "ignored", Note: "ignored"})
+	tx.AssertNoErr(err)
+	id, err := res.LastInsertId()
+	tx.AssertNoErr(err)
+	r, err := find(id)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(row{"a", 7, "now"}, r)
+
+	_, err = Insert(ctx, db, "items", &writeTestItem{ID: 10, Name: "b", Qty: 2})
+	tx.AssertNoErr(err)
+	r, err = find(10)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(row{"b", 2, "now"}, r)
+
+	_, err = Update(ctx, db, "items", writeTestItem{ID: 10, Name: "b2", Qty: 3, Created: "ignored"})
+	tx.AssertNoErr(err)
+	r, err = find(10)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(row{"b2", 3, "now"}, r)
+	_, err = Update(ctx, db, "items", writeTestItem{ID: 11, Name: "x"})
+	tx.AssertEqual(true, errors.Is(err, ErrNotFound))
+
+	_, err = Upsert(ctx, db, "items", writeTestItem{ID: 10, Name: "b3", Qty: 4})
+	tx.AssertNoErr(err)
+	r, err = find(10)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(row{"b3", 4, "now"}, r)
+	_, err = Upsert(ctx, db, "items", writeTestItem{ID: 11, Name: "c", Qty: 5})
+	tx.AssertNoErr(err)
+	r, err = find(11)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(row{"c", 5, "now"}, r)
+
+	// errors
+	_, err = Insert(ctx, db, "items", 42)
+	tx.AssertErr(err)
+	_, err = Update(ctx, db, "items", struct {
+		Name string `sql:"name"`
+	}{Name: "x"})
+	tx.AssertErr(err)
+	_, err = Insert(ctx, db, "items", struct {
+		Name string `sql:"name; DROP TABLE items"`
+	}{Name: "x"})
+	tx.AssertErr(err)
+	_, err = Insert(ctx, db, "items", struct {
+		Name string `sql:"name,unknown"`
+	}{Name: "x"})
+	tx.AssertErr(err)
+
+	// batches
+	var items []writeTestItem
+	for n := range 25 {
+		items = append(items, writeTestItem{Name: fmt.Sprintf("batch_%02d", n), Qty: n})
+	}
+	n, err := InsertMany(ctx, db, "items", items, 10)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(int64(25), n)
+	var count, nullQtys int
+	err = db.QueryRow("SELECT COUNT(*), COUNT(*) - COUNT(qty) FROM items WHERE name LIKE 'batch_%';").Scan(&count, &nullQtys)
+	tx.AssertNoErr(err)
+	tx.AssertEqual(25, count)
+	// qty 0 is omitted and inserted as NULL
+	tx.AssertEqual(1, nullQtys)
+
+	n, err = InsertMany(ctx, db, "items", []writeTestItem{{Name: "ok"}, {ID: 10, Name: "dup"}}, 1)
+	tx.AssertErr(err)
+	tx.AssertEqual(int64(1), n)
+}